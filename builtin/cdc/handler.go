@@ -0,0 +1,356 @@
+package cdc
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/akaumov/cube"
+	"github.com/akaumov/cubes/db"
+	"github.com/lib/pq"
+	"github.com/satori/go.uuid"
+)
+
+const Version = "1"
+
+const listenerPingInterval = 90 * time.Second
+
+// The snapshot is read again when a notification has an unknown table or
+// column, but not more often than the interval
+const snapshotReloadInterval = 10 * time.Second
+
+// ChangeEvent is params of published messages, the method of a message is
+// the operation: insert, update or delete. Keys are primary key columns of
+// the new row or of the old row for deletes. Truncated events of tables
+// without a primary key, or with too big keys, have no keys and rows.
+type ChangeEvent struct {
+	Table     string `json:"table"`
+	Operation string `json:"operation"`
+	Keys      *Row   `json:"keys"`
+	Old       *Row   `json:"old"`
+	New       *Row   `json:"new"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+// Row keeps values in the order of columns of the table
+type Row struct {
+	Columns []string
+	Values  map[string]json.RawMessage
+}
+
+func newRow(columns []string, values map[string]json.RawMessage) *Row {
+	row := &Row{Columns: []string{}, Values: map[string]json.RawMessage{}}
+
+	for _, column := range columns {
+		value, ok := values[column]
+		if !ok {
+			continue
+		}
+
+		row.Columns = append(row.Columns, column)
+		row.Values[column] = value
+	}
+
+	return row
+}
+
+func (r *Row) MarshalJSON() ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteString("{")
+
+	for index, column := range r.Columns {
+		if index > 0 {
+			buffer.WriteString(",")
+		}
+
+		packedColumn, _ := json.Marshal(column)
+		buffer.Write(packedColumn)
+		buffer.WriteString(":")
+		buffer.Write(r.Values[column])
+	}
+
+	buffer.WriteString("}")
+	return buffer.Bytes(), nil
+}
+
+// Handler listens to postgres channels of notify triggers and publishes
+// every change to the channel named after the table
+type Handler struct {
+	cubeInstance cube.Cube
+	database     *sql.DB
+	listener     *pq.Listener
+	snapshot     *db.Snapshot
+	snapshotTime time.Time
+	stop         chan struct{}
+}
+
+func (h *Handler) OnInitInstance() []cube.InputChannel {
+	return []cube.InputChannel{}
+}
+
+func (h *Handler) OnStart(cubeInstance cube.Cube) {
+	fmt.Println("Starting cdc...")
+
+	h.cubeInstance = cubeInstance
+	h.stop = make(chan struct{})
+
+	dsn := cubeInstance.GetParam("dsn")
+	if dsn == "" {
+		cubeInstance.LogFatal("dsn param is required")
+		return
+	}
+
+	database, err := sql.Open("postgres", dsn)
+	if err != nil {
+		cubeInstance.LogFatal(fmt.Sprintf("can't connect to db: %v", err))
+		return
+	}
+
+	h.database = database
+
+	err = h.reloadSnapshot()
+	if err != nil {
+		cubeInstance.LogFatal(err.Error())
+		return
+	}
+
+	h.listener = pq.NewListener(dsn, 10*time.Second, time.Minute, h.onListenerEvent)
+
+	for _, channel := range h.getChannels() {
+		err = h.listener.Listen(channel)
+		if err != nil {
+			cubeInstance.LogFatal(fmt.Sprintf("can't listen channel '%v': %v", channel, err))
+			return
+		}
+	}
+
+	go h.listen()
+}
+
+func (h *Handler) OnStop(c cube.Cube) {
+	if h.stop != nil {
+		close(h.stop)
+	}
+
+	if h.listener != nil {
+		h.listener.Close()
+	}
+
+	if h.database != nil {
+		h.database.Close()
+	}
+}
+
+func (h *Handler) OnReceiveMessage(instance cube.Cube, channel cube.Channel, message cube.Message) {
+	fmt.Println("OnReceiveMessage: is not implemented")
+	instance.LogError("OnReceiveMessage: is not implemented")
+}
+
+func (h *Handler) OnReceiveRequest(instance cube.Cube, channel cube.Channel, request cube.Request) (*cube.Response, error) {
+	fmt.Println("OnReceiveRequest: is not implemented")
+	instance.LogError("OnReceiveRequest: is not implemented")
+	return &cube.Response{
+		Version: Version,
+		Result:  nil,
+		Errors: &[]cube.Error{
+			{
+				Code:        "400",
+				Name:        "NotImplemented",
+				Description: "OnReceiveRequest: is not implemented",
+			},
+		},
+	}, nil
+}
+
+func (h *Handler) getChannels() []string {
+	channels := []string{}
+
+	for _, channel := range strings.Split(h.cubeInstance.GetParam("channels"), ",") {
+		channel = strings.TrimSpace(channel)
+		if channel != "" {
+			channels = append(channels, channel)
+		}
+	}
+
+	if len(channels) == 0 {
+		return []string{db.DefaultNotifyChannel}
+	}
+
+	return channels
+}
+
+func (h *Handler) onListenerEvent(event pq.ListenerEventType, err error) {
+	if err != nil {
+		h.cubeInstance.LogError(fmt.Sprintf("postgres listener: %v", err))
+	}
+}
+
+func (h *Handler) listen() {
+	ticker := time.NewTicker(listenerPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.stop:
+			return
+		case notification, ok := <-h.listener.Notify:
+			if !ok {
+				return
+			}
+
+			// Nil is sent after the connection is restored, changes made while it was lost aren't published
+			if notification == nil {
+				h.cubeInstance.LogWarning("connection to db is restored, some changes may be lost")
+				continue
+			}
+
+			h.publish(notification.Extra)
+		case <-ticker.C:
+			go h.listener.Ping()
+		}
+	}
+}
+
+func (h *Handler) publish(payload string) {
+	var notification db.ChangeNotification
+
+	err := json.Unmarshal([]byte(payload), &notification)
+	if err != nil {
+		h.cubeInstance.LogError(fmt.Sprintf("can't parse notification: %v", err))
+		return
+	}
+
+	packedEvent, _ := json.Marshal(h.getChangeEvent(notification))
+	id := uuid.NewV4().String()
+
+	err = h.cubeInstance.PublishMessage(cube.Channel(notification.Table), cube.Message{
+		Version: Version,
+		Id:      &id,
+		Method:  notification.Operation,
+		Params:  (*json.RawMessage)(&packedEvent),
+	})
+	if err != nil {
+		h.cubeInstance.LogError(fmt.Sprintf("can't publish change of table '%v': %v", notification.Table, err))
+	}
+}
+
+// getChangeEvent drops values of columns which aren't in the snapshot, values
+// of unknown tables are kept and ordered by column names
+func (h *Handler) getChangeEvent(notification db.ChangeNotification) ChangeEvent {
+
+	event := ChangeEvent{
+		Table:     notification.Table,
+		Operation: notification.Operation,
+		Truncated: notification.Truncated,
+	}
+
+	columns := []string{}
+	keys := []string{}
+
+	table := h.getTable(notification)
+	if table != nil {
+		for _, column := range table.Columns {
+			columns = append(columns, column.Name)
+		}
+
+		for _, key := range table.PrimaryKeys {
+			keys = append(keys, string(key))
+		}
+	} else {
+		h.cubeInstance.LogWarning(fmt.Sprintf("table '%v' doesn't exist in synced migrations", notification.Table))
+		columns = getNotificationColumns(notification)
+	}
+
+	if notification.Old != nil {
+		event.Old = newRow(columns, notification.Old)
+	}
+
+	if notification.New != nil {
+		event.New = newRow(columns, notification.New)
+	}
+
+	keyValues := notification.New
+	if keyValues == nil {
+		keyValues = notification.Old
+	}
+
+	if len(keys) > 0 && keyValues != nil {
+		event.Keys = newRow(keys, keyValues)
+	}
+
+	return event
+}
+
+// getTable reads the snapshot again if the table or some of the columns are
+// unknown, they are added by migrations synced after the cube started
+func (h *Handler) getTable(notification db.ChangeNotification) *db.Table {
+
+	table := h.snapshot.GetTable(notification.Table)
+	if table != nil && !hasUnknownColumns(table, notification) {
+		return table
+	}
+
+	if time.Since(h.snapshotTime) < snapshotReloadInterval {
+		return table
+	}
+
+	err := h.reloadSnapshot()
+	if err != nil {
+		h.cubeInstance.LogError(err.Error())
+		return table
+	}
+
+	return h.snapshot.GetTable(notification.Table)
+}
+
+func (h *Handler) reloadSnapshot() error {
+	snapshot, err := db.GetSyncedSnapshot(h.database)
+	if err != nil {
+		return fmt.Errorf("can't read snapshot: %v", err)
+	}
+
+	h.snapshot = snapshot
+	h.snapshotTime = time.Now()
+	return nil
+}
+
+func hasUnknownColumns(table *db.Table, notification db.ChangeNotification) bool {
+	for _, column := range getNotificationColumns(notification) {
+		isKnown := false
+		for _, tableColumn := range table.Columns {
+			if tableColumn.Name == column {
+				isKnown = true
+				break
+			}
+		}
+
+		if !isKnown {
+			return true
+		}
+	}
+
+	return false
+}
+
+func getNotificationColumns(notification db.ChangeNotification) []string {
+	columnsSet := map[string]bool{}
+	for column := range notification.Old {
+		columnsSet[column] = true
+	}
+
+	for column := range notification.New {
+		columnsSet[column] = true
+	}
+
+	columns := []string{}
+	for column := range columnsSet {
+		columns = append(columns, column)
+	}
+
+	sort.Strings(columns)
+	return columns
+}
@@ -0,0 +1,296 @@
+package data
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/akaumov/cube"
+	"github.com/akaumov/cubes/db"
+	_ "github.com/lib/pq"
+)
+
+const Version = "1"
+
+const defaultMaxLimit = 1000
+
+// Input channels of operations, bus channels are set by channelsMapping of the instance
+const (
+	GetChannel    = cube.InputChannel("get")
+	ListChannel   = cube.InputChannel("list")
+	InsertChannel = cube.InputChannel("insert")
+	UpdateChannel = cube.InputChannel("update")
+	DeleteChannel = cube.InputChannel("delete")
+)
+
+// RequestParams are params of requests of all operations. Get, update and
+// delete find the row by keys with all primary key columns. Include has
+// relation paths separated by dots, for example comments.author.
+type RequestParams struct {
+	Table   string                 `json:"table"`
+	Keys    map[string]interface{} `json:"keys"`
+	Values  map[string]interface{} `json:"values"`
+	Filters []Filter               `json:"filters"`
+	OrderBy []Order                `json:"orderBy"`
+	Limit   int                    `json:"limit"`
+	Offset  int                    `json:"offset"`
+	Include []string               `json:"include"`
+}
+
+// ListResult is the result of list, other operations return the row
+type ListResult struct {
+	Rows []json.RawMessage `json:"rows"`
+}
+
+type requestError struct {
+	code string
+	name string
+	err  error
+}
+
+func badRequest(err error) *requestError {
+	return &requestError{code: "400", name: "BadRequest", err: err}
+}
+
+// Handler answers requests to tables of the snapshot of synced migrations
+type Handler struct {
+	cubeInstance cube.Cube
+	database     *sql.DB
+	snapshot     *db.Snapshot
+	tables       map[string]bool
+	table        string
+	maxLimit     int
+}
+
+func (h *Handler) OnInitInstance() []cube.InputChannel {
+	return []cube.InputChannel{GetChannel, ListChannel, InsertChannel, UpdateChannel, DeleteChannel}
+}
+
+func (h *Handler) OnStart(cubeInstance cube.Cube) {
+	fmt.Println("Starting data cube...")
+
+	h.cubeInstance = cubeInstance
+	h.table = cubeInstance.GetParam("table")
+	h.tables = map[string]bool{}
+
+	for _, table := range strings.Split(cubeInstance.GetParam("tables"), ",") {
+		table = strings.TrimSpace(table)
+		if table != "" {
+			h.tables[table] = true
+		}
+	}
+
+	// The table of requests is available with tables of the param
+	if h.table != "" {
+		h.tables[h.table] = true
+	}
+
+	h.maxLimit = defaultMaxLimit
+	maxLimitString := cubeInstance.GetParam("maxLimit")
+
+	if maxLimitString != "" {
+		maxLimit, err := strconv.Atoi(maxLimitString)
+		if err != nil || maxLimit < 1 {
+			cubeInstance.LogError(fmt.Sprintf("wrong maxLimit param '%v', default %v is used", maxLimitString, defaultMaxLimit))
+		} else {
+			h.maxLimit = maxLimit
+		}
+	}
+
+	dsn := cubeInstance.GetParam("dsn")
+	if dsn == "" {
+		cubeInstance.LogFatal("dsn param is required")
+		return
+	}
+
+	database, err := sql.Open("postgres", dsn)
+	if err != nil {
+		cubeInstance.LogFatal(fmt.Sprintf("can't connect to db: %v", err))
+		return
+	}
+
+	h.database = database
+
+	snapshot, err := db.GetSyncedSnapshot(database)
+	if err != nil {
+		cubeInstance.LogFatal(fmt.Sprintf("can't read snapshot: %v", err))
+		return
+	}
+
+	h.snapshot = snapshot
+}
+
+func (h *Handler) OnStop(c cube.Cube) {
+	if h.database != nil {
+		h.database.Close()
+	}
+}
+
+func (h *Handler) OnReceiveMessage(instance cube.Cube, channel cube.Channel, message cube.Message) {
+	fmt.Println("OnReceiveMessage: is not implemented")
+	instance.LogError("OnReceiveMessage: is not implemented")
+}
+
+func (h *Handler) OnReceiveRequest(instance cube.Cube, channel cube.Channel, request cube.Request) (*cube.Response, error) {
+
+	result, requestErr := h.handleRequest(cube.InputChannel(channel), request)
+	if requestErr != nil {
+		if requestErr.code == "500" {
+			instance.LogError(requestErr.err.Error())
+		}
+
+		return &cube.Response{
+			Version: Version,
+			Result:  nil,
+			Errors: &[]cube.Error{
+				{
+					Code:        requestErr.code,
+					Name:        requestErr.name,
+					Description: requestErr.err.Error(),
+				},
+			},
+		}, nil
+	}
+
+	return &cube.Response{
+		Version: Version,
+		Result:  &result,
+	}, nil
+}
+
+func (h *Handler) handleRequest(channel cube.InputChannel, request cube.Request) (json.RawMessage, *requestError) {
+
+	if h.snapshot == nil {
+		return nil, &requestError{code: "503", name: "NotStarted", err: fmt.Errorf("data cube isn't started")}
+	}
+
+	var params RequestParams
+	if request.Params != nil {
+		// Numbers are kept as text, so big integers and numerics don't lose precision
+		decoder := json.NewDecoder(bytes.NewReader(*request.Params))
+		decoder.UseNumber()
+
+		err := decoder.Decode(&params)
+		if err != nil {
+			return nil, badRequest(fmt.Errorf("can't parse params: %v", err))
+		}
+	}
+
+	table, err := h.getTable(params.Table)
+	if err != nil {
+		return nil, badRequest(err)
+	}
+
+	// History tables of audited tables can be read, but not changed
+	isWrite := channel == InsertChannel || channel == UpdateChannel || channel == DeleteChannel
+	auditedTable := h.snapshot.GetAuditedTable(table.Name)
+	if isWrite && auditedTable != nil {
+		return nil, &requestError{code: "403", name: "Forbidden", err: fmt.Errorf("table '%v' is history of audited table '%v', it's read only", table.Name, auditedTable.Name)}
+	}
+
+	builder := newQueryBuilder(h.snapshot, h.tables, h.maxLimit)
+
+	var query string
+	switch channel {
+	case GetChannel:
+		query, err = builder.buildGet(table, params)
+	case ListChannel:
+		query, err = builder.buildList(table, params, h.getLimit(params))
+	case InsertChannel:
+		query, err = builder.buildInsert(table, params)
+	case UpdateChannel:
+		query, err = builder.buildUpdate(table, params)
+	case DeleteChannel:
+		query, err = builder.buildDelete(table, params)
+	default:
+		return nil, badRequest(fmt.Errorf("unknown channel '%v'", channel))
+	}
+
+	if err != nil {
+		return nil, badRequest(err)
+	}
+
+	if channel == ListChannel {
+		return h.queryRows(query, builder.arguments)
+	}
+
+	var row []byte
+	err = h.database.QueryRow(query, builder.arguments...).Scan(&row)
+	if err == sql.ErrNoRows {
+		return nil, &requestError{code: "404", name: "NotFound", err: fmt.Errorf("row of table '%v' doesn't exist", table.Name)}
+	}
+
+	if err != nil {
+		return nil, &requestError{code: "500", name: "DbError", err: fmt.Errorf("can't %v row of table '%v': %v", channel, table.Name, err)}
+	}
+
+	return json.RawMessage(row), nil
+}
+
+func (h *Handler) queryRows(query string, arguments []interface{}) (json.RawMessage, *requestError) {
+
+	rows, err := h.database.Query(query, arguments...)
+	if err != nil {
+		return nil, &requestError{code: "500", name: "DbError", err: fmt.Errorf("can't list rows: %v", err)}
+	}
+	defer rows.Close()
+
+	result := ListResult{Rows: []json.RawMessage{}}
+	for rows.Next() {
+		var row []byte
+
+		err = rows.Scan(&row)
+		if err != nil {
+			return nil, &requestError{code: "500", name: "DbError", err: fmt.Errorf("can't list rows: %v", err)}
+		}
+
+		result.Rows = append(result.Rows, json.RawMessage(row))
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, &requestError{code: "500", name: "DbError", err: fmt.Errorf("can't list rows: %v", err)}
+	}
+
+	packedResult, _ := json.Marshal(result)
+	return json.RawMessage(packedResult), nil
+}
+
+// getTable returns the table of the instance param if it's set, requests can
+// use only tables of the tables and table params unless both are empty
+func (h *Handler) getTable(tableName string) (*db.Table, error) {
+
+	if h.table != "" {
+		if tableName != "" && tableName != h.table {
+			return nil, fmt.Errorf("table '%v' isn't available", tableName)
+		}
+
+		tableName = h.table
+	}
+
+	if tableName == "" {
+		return nil, fmt.Errorf("table is required")
+	}
+
+	if !isTableAvailable(h.tables, tableName) {
+		return nil, fmt.Errorf("table '%v' isn't available", tableName)
+	}
+
+	table := h.snapshot.GetTable(tableName)
+	if table == nil {
+		return nil, fmt.Errorf("table '%v' doesn't exist", tableName)
+	}
+
+	return table, nil
+}
+
+func (h *Handler) getLimit(params RequestParams) int {
+	if params.Limit < 1 || params.Limit > h.maxLimit {
+		return h.maxLimit
+	}
+
+	return params.Limit
+}
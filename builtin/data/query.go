@@ -0,0 +1,564 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/akaumov/cubes/db"
+)
+
+// Filter compares the column with the value, in takes an array of values,
+// isNull and notNull don't have a value. Like and ilike match only text columns,
+// array and json columns can be filtered only by isNull and notNull.
+type Filter struct {
+	Column   string      `json:"column"`
+	Operator string      `json:"operator"`
+	Value    interface{} `json:"value"`
+}
+
+type Order struct {
+	Column string `json:"column"`
+	Desc   bool   `json:"desc"`
+}
+
+var filterOperators = map[string]string{
+	"eq":    "=",
+	"neq":   "<>",
+	"lt":    "<",
+	"lte":   "<=",
+	"gt":    ">",
+	"gte":   ">=",
+	"like":  "LIKE",
+	"ilike": "ILIKE",
+}
+
+// Types which can be matched by like and ilike
+var textTypes = map[string]bool{
+	"text":              true,
+	"character varying": true,
+	"character":         true,
+	"citext":            true,
+}
+
+// Bit sizes of integer types
+var integerTypes = map[string]int{
+	"smallint": 16,
+	"integer":  32,
+	"bigint":   64,
+}
+
+var numberTypes = map[string]bool{
+	"real":             true,
+	"double precision": true,
+	"numeric":          true,
+}
+
+// includeTree keeps relations to include, nested relations are included into rows of their relation
+type includeTree map[string]includeTree
+
+// parseIncludes reads relation paths separated by dots, for example comments.author
+func parseIncludes(paths []string) includeTree {
+	tree := includeTree{}
+
+	for _, path := range paths {
+		node := tree
+		for _, name := range strings.Split(path, ".") {
+			if node[name] == nil {
+				node[name] = includeTree{}
+			}
+
+			node = node[name]
+		}
+	}
+
+	return tree
+}
+
+// queryBuilder builds statements of one request, names of tables, columns
+// and relations are checked against the snapshot, values are passed as arguments.
+// Included relations can lead only to available tables, all tables are
+// available if tables are empty. Array relations have at most maxRows rows.
+type queryBuilder struct {
+	snapshot  *db.Snapshot
+	tables    map[string]bool
+	maxRows   int
+	arguments []interface{}
+	aliases   int
+}
+
+func newQueryBuilder(snapshot *db.Snapshot, tables map[string]bool, maxRows int) *queryBuilder {
+	return &queryBuilder{
+		snapshot:  snapshot,
+		tables:    tables,
+		maxRows:   maxRows,
+		arguments: []interface{}{},
+	}
+}
+
+func isTableAvailable(tables map[string]bool, tableName string) bool {
+	return len(tables) == 0 || tables[tableName]
+}
+
+func (b *queryBuilder) newAlias() string {
+	b.aliases++
+	return fmt.Sprintf("t%v", b.aliases)
+}
+
+func (b *queryBuilder) addArgument(value interface{}) (string, error) {
+
+	switch typedValue := value.(type) {
+	case nil, string, bool:
+	case json.Number:
+		value = typedValue.String()
+	default:
+		// Objects and arrays are values of json columns
+		packedValue, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+
+		value = string(packedValue)
+	}
+
+	b.arguments = append(b.arguments, value)
+	return fmt.Sprintf("$%v", len(b.arguments)), nil
+}
+
+func getColumn(table *db.Table, columnName string) (*db.Column, error) {
+	for index := range table.Columns {
+		if table.Columns[index].Name == columnName {
+			return &table.Columns[index], nil
+		}
+	}
+
+	return nil, fmt.Errorf("column '%v' doesn't exist in table '%v'", columnName, table.Name)
+}
+
+func getRelation(table *db.Table, relationName string) (*db.Relation, error) {
+	for index := range table.Relations {
+		if table.Relations[index].Name == relationName {
+			return &table.Relations[index], nil
+		}
+	}
+
+	return nil, fmt.Errorf("relation '%v' doesn't exist in table '%v'", relationName, table.Name)
+}
+
+// getRowExpression returns jsonb of the row with included relations, an object
+// relation is a row or null, an array relation is an array of rows. Relations
+// replace values of columns with the same names.
+func (b *queryBuilder) getRowExpression(table *db.Table, alias string, include includeTree) (string, error) {
+
+	if len(include) == 0 {
+		return fmt.Sprintf("to_jsonb(%v)", alias), nil
+	}
+
+	relationNames := []string{}
+	for relationName := range include {
+		relationNames = append(relationNames, relationName)
+	}
+	sort.Strings(relationNames)
+
+	fields := []string{}
+
+	for _, relationName := range relationNames {
+		relation, err := getRelation(table, relationName)
+		if err != nil {
+			return "", err
+		}
+
+		remoteTable := b.snapshot.GetTable(relation.RemoteTable)
+		if remoteTable == nil {
+			return "", fmt.Errorf("table '%v' doesn't exist", relation.RemoteTable)
+		}
+
+		if !isTableAvailable(b.tables, remoteTable.Name) {
+			return "", fmt.Errorf("relation '%v' of table '%v' leads to table '%v', it isn't available", relationName, table.Name, remoteTable.Name)
+		}
+
+		remoteAlias := b.newAlias()
+
+		remoteRow, err := b.getRowExpression(remoteTable, remoteAlias, include[relationName])
+		if err != nil {
+			return "", err
+		}
+
+		var subquery string
+		if relation.Type == db.Array {
+			// Rows are limited in a derived table, so the aggregate doesn't read all rows of the relation
+			limitedAlias := b.newAlias()
+
+			conditions := []string{}
+			for _, mapping := range relation.ColumnsMapping {
+				conditions = append(conditions, fmt.Sprintf(`%v."%v" = %v."%v"`, limitedAlias, mapping.RemoteColumn, alias, mapping.Column))
+			}
+
+			orders := []string{}
+			for _, key := range remoteTable.PrimaryKeys {
+				orders = append(orders, fmt.Sprintf(`%v."%v"`, limitedAlias, key))
+			}
+
+			order := ""
+			if len(orders) > 0 {
+				order = " ORDER BY " + strings.Join(orders, ", ")
+			}
+
+			subquery = fmt.Sprintf(`(SELECT COALESCE(jsonb_agg(%v), '[]'::jsonb) FROM (SELECT %v.* FROM "%v" %v WHERE %v%v LIMIT %d) %v)`,
+				remoteRow, limitedAlias, remoteTable.Name, limitedAlias, strings.Join(conditions, " AND "), order, b.maxRows, remoteAlias)
+		} else {
+			conditions := []string{}
+			for _, mapping := range relation.ColumnsMapping {
+				conditions = append(conditions, fmt.Sprintf(`%v."%v" = %v."%v"`, remoteAlias, mapping.RemoteColumn, alias, mapping.Column))
+			}
+
+			subquery = fmt.Sprintf(`(SELECT %v FROM "%v" %v WHERE %v LIMIT 1)`,
+				remoteRow, remoteTable.Name, remoteAlias, strings.Join(conditions, " AND "))
+		}
+
+		fields = append(fields, fmt.Sprintf("'%v', %v", strings.Replace(relationName, "'", "''", -1), subquery))
+	}
+
+	return fmt.Sprintf("to_jsonb(%v) || jsonb_build_object(%v)", alias, strings.Join(fields, ", ")), nil
+}
+
+// getKeysCondition finds one row by all columns of the primary key
+func (b *queryBuilder) getKeysCondition(table *db.Table, alias string, keys map[string]interface{}) (string, error) {
+
+	if len(table.PrimaryKeys) == 0 {
+		return "", fmt.Errorf("table '%v' doesn't have primary key", table.Name)
+	}
+
+	if len(keys) != len(table.PrimaryKeys) {
+		return "", fmt.Errorf("keys should have all primary key columns of table '%v'", table.Name)
+	}
+
+	conditions := []string{}
+	for _, key := range table.PrimaryKeys {
+		value, ok := keys[string(key)]
+		if !ok || value == nil {
+			return "", fmt.Errorf("key '%v' is required", key)
+		}
+
+		argument, err := b.addArgument(value)
+		if err != nil {
+			return "", err
+		}
+
+		conditions = append(conditions, fmt.Sprintf(`%v."%v" = %v`, alias, key, argument))
+	}
+
+	return strings.Join(conditions, " AND "), nil
+}
+
+func (b *queryBuilder) getFilterCondition(table *db.Table, alias string, filter Filter) (string, error) {
+
+	tableColumn, err := getColumn(table, filter.Column)
+	if err != nil {
+		return "", err
+	}
+
+	err = checkFilter(tableColumn, filter)
+	if err != nil {
+		return "", err
+	}
+
+	column := fmt.Sprintf(`%v."%v"`, alias, filter.Column)
+
+	switch filter.Operator {
+	case "isNull":
+		return column + " IS NULL", nil
+	case "notNull":
+		return column + " IS NOT NULL", nil
+	case "in":
+		values, ok := filter.Value.([]interface{})
+		if !ok {
+			return "", fmt.Errorf("value of filter 'in' should be an array")
+		}
+
+		if len(values) == 0 {
+			return "FALSE", nil
+		}
+
+		arguments := []string{}
+		for _, value := range values {
+			argument, err := b.addArgument(value)
+			if err != nil {
+				return "", err
+			}
+
+			arguments = append(arguments, argument)
+		}
+
+		return fmt.Sprintf("%v IN (%v)", column, strings.Join(arguments, ", ")), nil
+	}
+
+	operator, ok := filterOperators[filter.Operator]
+	if !ok {
+		return "", fmt.Errorf("unknown filter operator '%v'", filter.Operator)
+	}
+
+	if filter.Value == nil {
+		return "", fmt.Errorf("value of filter '%v' is required, use isNull to find empty values", filter.Operator)
+	}
+
+	argument, err := b.addArgument(filter.Value)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%v %v %v", column, operator, argument), nil
+}
+
+// checkFilter checks that the operator and values fit the type of the column,
+// so wrong filters are bad requests and don't reach the database
+func checkFilter(column *db.Column, filter Filter) error {
+
+	if filter.Operator == "isNull" || filter.Operator == "notNull" {
+		return nil
+	}
+
+	columnType := db.NormalizeColumnType(column.Type)
+
+	// Arrays and json are passed as json text, they can't be compared with it
+	if strings.HasSuffix(columnType, "[]") || columnType == "json" {
+		return fmt.Errorf("column '%v' of type '%v' can be filtered only by isNull and notNull", column.Name, column.Type)
+	}
+
+	if (filter.Operator == "like" || filter.Operator == "ilike") && !textTypes[columnType] {
+		return fmt.Errorf("filter '%v' needs a text column, column '%v' has type '%v'", filter.Operator, column.Name, column.Type)
+	}
+
+	values := []interface{}{filter.Value}
+	if filter.Operator == "in" {
+		inValues, ok := filter.Value.([]interface{})
+		if !ok {
+			return fmt.Errorf("value of filter 'in' should be an array")
+		}
+
+		values = inValues
+	}
+
+	for _, value := range values {
+		if value == nil {
+			continue
+		}
+
+		err := checkFilterValue(column, columnType, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func checkFilterValue(column *db.Column, columnType string, value interface{}) error {
+
+	number, isNumber := value.(json.Number)
+
+	if bitSize, ok := integerTypes[columnType]; ok {
+		if _, err := strconv.ParseInt(number.String(), 10, bitSize); !isNumber || err != nil {
+			return fmt.Errorf("value '%v' of column '%v' should be an integer of type '%v'", value, column.Name, column.Type)
+		}
+	}
+
+	if numberTypes[columnType] && !isNumber {
+		return fmt.Errorf("value '%v' of column '%v' should be a number", value, column.Name)
+	}
+
+	if _, isBool := value.(bool); columnType == "boolean" && !isBool {
+		return fmt.Errorf("value '%v' of column '%v' should be a boolean", value, column.Name)
+	}
+
+	return nil
+}
+
+// getWritableColumns returns sorted names of values, read only columns can't be written
+func getWritableColumns(table *db.Table, values map[string]interface{}) ([]string, error) {
+
+	columns := []string{}
+	for columnName := range values {
+		column, err := getColumn(table, columnName)
+		if err != nil {
+			return nil, err
+		}
+
+		if column.IsReadOnly {
+			return nil, fmt.Errorf("column '%v' of table '%v' is read only", columnName, table.Name)
+		}
+
+		columns = append(columns, columnName)
+	}
+
+	sort.Strings(columns)
+	return columns, nil
+}
+
+func (b *queryBuilder) buildGet(table *db.Table, params RequestParams) (string, error) {
+
+	alias := b.newAlias()
+
+	row, err := b.getRowExpression(table, alias, parseIncludes(params.Include))
+	if err != nil {
+		return "", err
+	}
+
+	condition, err := b.getKeysCondition(table, alias, params.Keys)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf(`SELECT %v FROM "%v" %v WHERE %v`, row, table.Name, alias, condition), nil
+}
+
+func (b *queryBuilder) buildList(table *db.Table, params RequestParams, limit int) (string, error) {
+
+	alias := b.newAlias()
+
+	row, err := b.getRowExpression(table, alias, parseIncludes(params.Include))
+	if err != nil {
+		return "", err
+	}
+
+	query := fmt.Sprintf(`SELECT %v FROM "%v" %v`, row, table.Name, alias)
+
+	conditions := []string{}
+	for _, filter := range params.Filters {
+		condition, err := b.getFilterCondition(table, alias, filter)
+		if err != nil {
+			return "", err
+		}
+
+		conditions = append(conditions, condition)
+	}
+
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	orders := []string{}
+	for _, order := range params.OrderBy {
+		_, err := getColumn(table, order.Column)
+		if err != nil {
+			return "", err
+		}
+
+		direction := "ASC"
+		if order.Desc {
+			direction = "DESC"
+		}
+
+		orders = append(orders, fmt.Sprintf(`%v."%v" %v`, alias, order.Column, direction))
+	}
+
+	// Pages are stable only if rows are ordered, the primary key is the default order
+	if len(orders) == 0 {
+		for _, key := range table.PrimaryKeys {
+			orders = append(orders, fmt.Sprintf(`%v."%v"`, alias, key))
+		}
+	}
+
+	if len(orders) > 0 {
+		query += " ORDER BY " + strings.Join(orders, ", ")
+	}
+
+	if params.Offset < 0 {
+		return "", fmt.Errorf("offset can't be negative")
+	}
+
+	limitArgument, _ := b.addArgument(json.Number(fmt.Sprint(limit)))
+	offsetArgument, _ := b.addArgument(json.Number(fmt.Sprint(params.Offset)))
+
+	return query + fmt.Sprintf(" LIMIT %v OFFSET %v", limitArgument, offsetArgument), nil
+}
+
+func (b *queryBuilder) buildInsert(table *db.Table, params RequestParams) (string, error) {
+
+	columns, err := getWritableColumns(table, params.Values)
+	if err != nil {
+		return "", err
+	}
+
+	alias := b.newAlias()
+
+	quotedColumns := []string{}
+	arguments := []string{}
+	for _, column := range columns {
+		argument, err := b.addArgument(params.Values[column])
+		if err != nil {
+			return "", err
+		}
+
+		quotedColumns = append(quotedColumns, fmt.Sprintf(`"%v"`, column))
+		arguments = append(arguments, argument)
+	}
+
+	row, err := b.getRowExpression(table, alias, parseIncludes(params.Include))
+	if err != nil {
+		return "", err
+	}
+
+	if len(columns) == 0 {
+		return fmt.Sprintf(`INSERT INTO "%v" AS %v DEFAULT VALUES RETURNING %v`, table.Name, alias, row), nil
+	}
+
+	return fmt.Sprintf(`INSERT INTO "%v" AS %v (%v) VALUES (%v) RETURNING %v`,
+		table.Name, alias, strings.Join(quotedColumns, ", "), strings.Join(arguments, ", "), row), nil
+}
+
+func (b *queryBuilder) buildUpdate(table *db.Table, params RequestParams) (string, error) {
+
+	columns, err := getWritableColumns(table, params.Values)
+	if err != nil {
+		return "", err
+	}
+
+	if len(columns) == 0 {
+		return "", fmt.Errorf("values are required")
+	}
+
+	alias := b.newAlias()
+
+	assignments := []string{}
+	for _, column := range columns {
+		argument, err := b.addArgument(params.Values[column])
+		if err != nil {
+			return "", err
+		}
+
+		assignments = append(assignments, fmt.Sprintf(`"%v" = %v`, column, argument))
+	}
+
+	condition, err := b.getKeysCondition(table, alias, params.Keys)
+	if err != nil {
+		return "", err
+	}
+
+	row, err := b.getRowExpression(table, alias, parseIncludes(params.Include))
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf(`UPDATE "%v" AS %v SET %v WHERE %v RETURNING %v`,
+		table.Name, alias, strings.Join(assignments, ", "), condition, row), nil
+}
+
+func (b *queryBuilder) buildDelete(table *db.Table, params RequestParams) (string, error) {
+
+	alias := b.newAlias()
+
+	condition, err := b.getKeysCondition(table, alias, params.Keys)
+	if err != nil {
+		return "", err
+	}
+
+	row, err := b.getRowExpression(table, alias, parseIncludes(params.Include))
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf(`DELETE FROM "%v" AS %v WHERE %v RETURNING %v`, table.Name, alias, condition, row), nil
+}
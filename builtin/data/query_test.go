@@ -0,0 +1,152 @@
+package data
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/akaumov/cubes/db"
+)
+
+func getTestSnapshot() *db.Snapshot {
+	return &db.Snapshot{Tables: []db.Table{
+		{
+			Name: "users",
+			Columns: []db.Column{
+				{Name: "id", Type: "int4"},
+				{Name: "name", Type: "varchar(255)"},
+				{Name: "age", Type: "smallint", IsNullable: true},
+				{Name: "rating", Type: "numeric(3,1)", IsNullable: true},
+				{Name: "active", Type: "bool"},
+				{Name: "tags", Type: "text[]", IsNullable: true},
+				{Name: "settings", Type: "jsonb", IsNullable: true},
+			},
+			PrimaryKeys: []db.ColumnName{"id"},
+		},
+		{
+			Name: "posts",
+			Columns: []db.Column{
+				{Name: "id", Type: "bigint"},
+				{Name: "author_id", Type: "integer"},
+			},
+			PrimaryKeys: []db.ColumnName{"id"},
+			Relations: []db.Relation{
+				{Name: "author", Type: db.Object, RemoteTable: "users", ColumnsMapping: []db.ColumnsMap{{Column: "author_id", RemoteColumn: "id"}}},
+			},
+		},
+	}}
+}
+
+func TestBuildListFilters(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		filter Filter
+		err    string
+	}{
+		{name: "integer", filter: Filter{Column: "age", Operator: "gte", Value: json.Number("18")}},
+		{name: "integers in", filter: Filter{Column: "id", Operator: "in", Value: []interface{}{json.Number("1"), json.Number("2")}}},
+		{name: "like text", filter: Filter{Column: "name", Operator: "ilike", Value: "a%"}},
+		{name: "number", filter: Filter{Column: "rating", Operator: "lt", Value: json.Number("4.5")}},
+		{name: "boolean", filter: Filter{Column: "active", Operator: "eq", Value: true}},
+		{name: "null array", filter: Filter{Column: "tags", Operator: "isNull"}},
+		{name: "jsonb", filter: Filter{Column: "settings", Operator: "eq", Value: "{}"}},
+		{
+			name:   "integer out of range",
+			filter: Filter{Column: "age", Operator: "eq", Value: json.Number("40000")},
+			err:    "value '40000' of column 'age' should be an integer of type 'smallint'",
+		},
+		{
+			name:   "fraction of integer",
+			filter: Filter{Column: "id", Operator: "in", Value: []interface{}{json.Number("1"), json.Number("1.5")}},
+			err:    "value '1.5' of column 'id' should be an integer of type 'int4'",
+		},
+		{
+			name:   "text of number",
+			filter: Filter{Column: "rating", Operator: "eq", Value: "high"},
+			err:    "value 'high' of column 'rating' should be a number",
+		},
+		{
+			name:   "text of boolean",
+			filter: Filter{Column: "active", Operator: "eq", Value: "yes"},
+			err:    "value 'yes' of column 'active' should be a boolean",
+		},
+		{
+			name:   "like number",
+			filter: Filter{Column: "age", Operator: "like", Value: "1%"},
+			err:    "filter 'like' needs a text column, column 'age' has type 'smallint'",
+		},
+		{
+			name:   "compare array",
+			filter: Filter{Column: "tags", Operator: "eq", Value: []interface{}{"a"}},
+			err:    "column 'tags' of type 'text[]' can be filtered only by isNull and notNull",
+		},
+		{
+			name:   "in without array",
+			filter: Filter{Column: "id", Operator: "in", Value: json.Number("1")},
+			err:    "value of filter 'in' should be an array",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			snapshot := getTestSnapshot()
+			builder := newQueryBuilder(snapshot, nil, 10)
+
+			_, err := builder.buildList(snapshot.GetTable("users"), RequestParams{Filters: []Filter{test.filter}}, 10)
+
+			if test.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected error %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestBuildListOffset(t *testing.T) {
+
+	snapshot := getTestSnapshot()
+
+	_, err := newQueryBuilder(snapshot, nil, 10).buildList(snapshot.GetTable("users"), RequestParams{Offset: -1}, 10)
+	if err == nil || err.Error() != "offset can't be negative" {
+		t.Fatalf("expected error about negative offset, got %v", err)
+	}
+
+	builder := newQueryBuilder(snapshot, nil, 10)
+	query, err := builder.buildList(snapshot.GetTable("users"), RequestParams{Offset: 20}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasSuffix(query, `ORDER BY t1."id" LIMIT $1 OFFSET $2`) {
+		t.Fatalf("unexpected query %v", query)
+	}
+
+	if len(builder.arguments) != 2 || builder.arguments[0] != "10" || builder.arguments[1] != "20" {
+		t.Fatalf("unexpected arguments %v", builder.arguments)
+	}
+}
+
+func TestBuildGetInclude(t *testing.T) {
+
+	snapshot := getTestSnapshot()
+	params := RequestParams{Keys: map[string]interface{}{"id": json.Number("1")}, Include: []string{"author"}}
+
+	_, err := newQueryBuilder(snapshot, map[string]bool{"posts": true}, 10).buildGet(snapshot.GetTable("posts"), params)
+
+	expected := "relation 'author' of table 'posts' leads to table 'users', it isn't available"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("expected error %q, got %v", expected, err)
+	}
+
+	_, err = newQueryBuilder(snapshot, map[string]bool{"posts": true, "users": true}, 10).buildGet(snapshot.GetTable("posts"), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
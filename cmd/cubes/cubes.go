@@ -1,12 +1,15 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/akaumov/cube_executor"
 	"github.com/akaumov/cubes/db"
@@ -21,7 +24,7 @@ func main() {
 	app.Commands = []cli.Command{
 		{
 			Name:   "init",
-			Usage:  "init project",
+			Usage:  "init project, the .cubes directory with caches is added to .gitignore",
 			ArgsUsage: "projectName [description]",
 			Action: initProject,
 		},		{
@@ -45,6 +48,27 @@ func main() {
 				},
 			},
 		},
+		{
+			Name:  "db",
+			Usage: "project database",
+			Subcommands: []cli.Command{
+				{
+					Name:   "start",
+					Usage:  "start project database container",
+					Action: startDb,
+				},
+				{
+					Name:   "stop",
+					Usage:  "stop project database container",
+					Action: stopDb,
+				},
+				{
+					Name:   "reset",
+					Usage:  "drop project database data and apply all migrations of the default and named databases",
+					Action: resetDb,
+				},
+			},
+		},
 		{
 			Name:  "instance",
 			Usage: "cube instance",
@@ -123,13 +147,102 @@ func main() {
 					Usage:  "return snapshot",
 					Action: migrationSnapshot,
 				},
+				{
+					Name:      "generate",
+					Usage:     "add migration changing the current schema to the desired schema file",
+					ArgsUsage: "[--schema] 'description'",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "schema",
+							Usage: "desired schema in snapshot format, default schema.json of the project",
+						},
+					},
+					Action: generateMigration,
+				},
+				{
+					Name:      "convert",
+					Usage:     "rewrite migration files in another format, all migrations are converted if ids are empty",
+					ArgsUsage: "--to [migrationId...]",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "to",
+							Usage: "json or yaml",
+						},
+					},
+					Action: convertMigrations,
+				},
+				{
+					Name:      "apply-plan",
+					Usage:     "add actions of the plan file to the last migration, nothing is added if any action is invalid",
+					ArgsUsage: "plan.yaml",
+					Action:    applyPlan,
+				},
+				{
+					Name:      "diff",
+					Usage:     "show schema changes between git revisions, working directory is used if rev2 is empty",
+					ArgsUsage: "[--json] rev1 [rev2]",
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  "json",
+							Usage: "print diff as json",
+						},
+					},
+					Action: diffMigrations,
+				},
+				{
+					Name:  "docs",
+					Usage: "generate schema documentation",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "out",
+							Value: "docs/schema",
+							Usage: "output directory",
+						},
+						cli.StringFlag{
+							Name:  "format",
+							Value: "markdown",
+							Usage: "markdown or html",
+						},
+					},
+					Action: generateDocs,
+				},
+				{
+					Name:  "export",
+					Usage: "export migrations for other tools",
+					Subcommands: []cli.Command{
+						{
+							Name:      "sql",
+							Usage:     "write V<id>__<description>.sql file with statements of every migration",
+							ArgsUsage: "[--out] [--full-ddl]",
+							Flags: []cli.Flag{
+								cli.StringFlag{
+									Name:  "out",
+									Value: "sql",
+									Usage: "output directory",
+								},
+								cli.BoolFlag{
+									Name:  "full-ddl",
+									Usage: "write one schema.sql script creating the current schema instead",
+								},
+							},
+							Action: exportSql,
+						},
+					},
+				},
 				{
 					Name:  "table",
 					Usage: "operations with tables",
 					Subcommands: []cli.Command{
 						{
-							Name:   "add",
-							Usage:  "add tableName",
+							Name:      "add",
+							Usage:     "add table, a preset adds columns, primary key and updated at trigger",
+							ArgsUsage: "[--preset] tableName",
+							Flags: []cli.Flag{
+								cli.StringFlag{
+									Name:  "preset",
+									Usage: "table preset from project.json or built-in: standard, softDelete",
+								},
+							},
 							Action: addTable,
 						},
 						{
@@ -137,6 +250,120 @@ func main() {
 							Usage:  "delete tableName",
 							Action: deleteTable,
 						},
+						{
+							Name:      "rename",
+							Usage:     "rename table",
+							ArgsUsage: "tableName newTableName",
+							Action:    renameTable,
+						},
+						{
+							Name:      "comment",
+							Usage:     "set table comment, empty comment removes it",
+							ArgsUsage: "tableName 'comment'",
+							Action:    setTableComment,
+						},
+						{
+							Name:      "updated-at",
+							Usage:     "set trigger updating the column on every update of a row",
+							ArgsUsage: "tableName columnName",
+							Action:    setUpdatedAtTrigger,
+						},
+						{
+							Name:      "drop-updated-at",
+							Usage:     "drop updated at trigger",
+							ArgsUsage: "tableName",
+							Action:    dropUpdatedAtTrigger,
+						},
+						{
+							Name:      "notify",
+							Usage:     "set trigger notifying the channel on every insert, update and delete of a row",
+							ArgsUsage: "[--channel] tableName [tableName...]",
+							Action:    setChangeNotify,
+							Flags: []cli.Flag{
+								cli.StringFlag{
+									Name:  "channel",
+									Usage: "postgres channel, default is " + db.DefaultNotifyChannel,
+								},
+							},
+						},
+						{
+							Name:      "drop-notify",
+							Usage:     "drop notify trigger",
+							ArgsUsage: "tableName",
+							Action:    dropChangeNotify,
+						},
+						{
+							Name:  "audit",
+							Usage: "history of row changes",
+							Subcommands: []cli.Command{
+								{
+									Name:      "enable",
+									Usage:     "add history table and triggers recording old and new rows on every change",
+									ArgsUsage: "[--history] tableName",
+									Action:    enableAudit,
+									Flags: []cli.Flag{
+										cli.StringFlag{
+											Name:  "history",
+											Usage: "history table, default is tableName_history",
+										},
+									},
+								},
+								{
+									Name:      "disable",
+									Usage:     "drop audit triggers, the history table is kept",
+									ArgsUsage: "tableName",
+									Action:    disableAudit,
+								},
+							},
+						},
+					},
+				},
+				{
+					Name:  "sequence",
+					Usage: "operations with sequences",
+					Subcommands: []cli.Command{
+						{
+							Name:      "add",
+							Usage:     "add sequence",
+							ArgsUsage: "[--type] [--start] [--increment] [--min] [--max] [--cache] [--cycle] sequenceName",
+							Flags: []cli.Flag{
+								cli.StringFlag{
+									Name:  "type",
+									Usage: "sequence type: smallint, integer or bigint",
+								},
+								cli.Int64Flag{
+									Name:  "start",
+									Usage: "start value",
+								},
+								cli.Int64Flag{
+									Name:  "increment",
+									Usage: "increment",
+								},
+								cli.Int64Flag{
+									Name:  "min",
+									Usage: "min value",
+								},
+								cli.Int64Flag{
+									Name:  "max",
+									Usage: "max value",
+								},
+								cli.Int64Flag{
+									Name:  "cache",
+									Usage: "cache size",
+								},
+								cli.BoolFlag{
+									Name:  "cycle",
+									Usage: "sequence cycles after max value",
+								},
+							},
+							Action: addSequence,
+						},
+						{
+							Name:      "delete",
+							Usage:     "delete sequence",
+							ArgsUsage: "sequenceName",
+							Action:    deleteSequence,
+						},
 					},
 				},
 				{
@@ -153,7 +380,43 @@ func main() {
 								},
 								cli.StringFlag{
 									Name:  "default",
-									Usage: "default value",
+									Usage: "literal default value: --default 'text'",
+								},
+								cli.StringFlag{
+									Name:  "default-expr",
+									Usage: "sql expression default value: --default-expr 'now()'",
+								},
+								cli.StringFlag{
+									Name:  "identity",
+									Usage: "identity column: --identity always|byDefault",
+								},
+								cli.StringFlag{
+									Name:  "generated",
+									Usage: "stored generated column: --generated 'price * quantity'",
+								},
+								cli.Int64Flag{
+									Name:  "start",
+									Usage: "identity sequence start value",
+								},
+								cli.Int64Flag{
+									Name:  "increment",
+									Usage: "identity sequence increment",
+								},
+								cli.Int64Flag{
+									Name:  "min",
+									Usage: "identity sequence min value",
+								},
+								cli.Int64Flag{
+									Name:  "max",
+									Usage: "identity sequence max value",
+								},
+								cli.Int64Flag{
+									Name:  "cache",
+									Usage: "identity sequence cache size",
+								},
+								cli.BoolFlag{
+									Name:  "cycle",
+									Usage: "identity sequence cycles after max value",
 								},
 							},
 							Action: addColumn,
@@ -163,6 +426,18 @@ func main() {
 							Usage:  "delete tableName columName",
 							Action: deleteColumn,
 						},
+						{
+							Name:      "rename",
+							Usage:     "rename column",
+							ArgsUsage: "tableName columnName newColumnName",
+							Action:    renameColumn,
+						},
+						{
+							Name:      "comment",
+							Usage:     "set column comment, empty comment removes it",
+							ArgsUsage: "tableName columnName 'comment'",
+							Action:    setColumnComment,
+						},
 					},
 				},
 
@@ -171,22 +446,124 @@ func main() {
 					Usage: "operations with primary keys",
 					Subcommands: []cli.Command{
 						{
-							Name:   "add",
-							Usage:  "add tableName columnName",
-							Action: addPrimaryKey,
+							Name:      "set",
+							Usage:     "set primary key of table",
+							ArgsUsage: "[--name] tableName 'columnName1;columnName2'",
+							Flags: []cli.Flag{
+								cli.StringFlag{
+									Name:  "name",
+									Usage: "constraint name, default tableName_pkey",
+								},
+							},
+							Action: setPrimaryKey,
 						},
 						{
-							Name:   "delete",
-							Usage:  "delete tableName columnName",
-							Action: deletePrimaryKey,
+							Name:      "drop",
+							Usage:     "drop primary key of table",
+							ArgsUsage: "tableName",
+							Action:    dropPrimaryKey,
 						},
 					},
 				},
 				{
-					Name:   "sync",
-					Usage:  "sync migrations",
+					Name:  "sync",
+					Usage: "sync migrations",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "profile",
+							Usage: "db profile from project.json, default profile is used if empty",
+						},
+						cli.StringFlag{
+							Name:  "transaction",
+							Value: "all",
+							Usage: "all - one transaction for all migrations, per-migration - commit after every migration, none - apply every action separately",
+						},
+						cli.DurationFlag{
+							Name:  "lock-timeout",
+							Value: time.Minute,
+							Usage: "how long to wait for another sync of the project, 0 waits forever",
+						},
+						cli.BoolFlag{
+							Name:  "all",
+							Usage: "sync the default and all named databases of the project",
+						},
+						cli.StringFlag{
+							Name:  "tenant-pattern",
+							Usage: "sync every schema matching the LIKE pattern, for example 'tenant_%'",
+						},
+						cli.StringFlag{
+							Name:  "tenant-query",
+							Usage: "sync every schema returned by the query",
+						},
+						cli.IntFlag{
+							Name:  "parallel",
+							Value: 4,
+							Usage: "number of tenant schemas synced at the same time",
+						},
+					},
 					Action: syncMigrations,
 				},
+				{
+					Name:  "status",
+					Usage: "show applied and pending migrations",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "profile",
+							Usage: "db profile from project.json, default profile is used if empty",
+						},
+					},
+					Action: migrationStatus,
+				},
+				{
+					Name:  "rollback",
+					Usage: "revert the last applied migration, data of dropped tables and columns isn't restored",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "profile",
+							Usage: "db profile from project.json, default profile is used if empty",
+						},
+						cli.DurationFlag{
+							Name:  "lock-timeout",
+							Value: time.Minute,
+							Usage: "how long to wait for another sync of the project, 0 waits forever",
+						},
+					},
+					Action: rollbackMigration,
+				},
+				{
+					Name:  "action",
+					Usage: "edit actions of a migration which isn't applied to databases of the project",
+					Subcommands: []cli.Command{
+						{
+							Name:      "list",
+							Usage:     "list actions",
+							ArgsUsage: "[--migration]",
+							Flags:     []cli.Flag{migrationIdFlag},
+							Action:    listActions,
+						},
+						{
+							Name:      "remove",
+							Usage:     "remove action",
+							ArgsUsage: "[--migration] [--force] actionIndex",
+							Flags:     []cli.Flag{migrationIdFlag, forceCheckFlag},
+							Action:    removeAction,
+						},
+						{
+							Name:      "move",
+							Usage:     "move action to another position",
+							ArgsUsage: "[--migration] [--force] actionIndex newIndex",
+							Flags:     []cli.Flag{migrationIdFlag, forceCheckFlag},
+							Action:    moveAction,
+						},
+						{
+							Name:      "undo",
+							Usage:     "remove the last action",
+							ArgsUsage: "[--migration] [--force]",
+							Flags:     []cli.Flag{migrationIdFlag, forceCheckFlag},
+							Action:    undoAction,
+						},
+					},
+				},
 				{
 					Name:  "relation",
 					Usage: "define table relations",
@@ -201,6 +578,18 @@ func main() {
 							ArgsUsage: "relation delete table relationName",
 							Action:    deleteRelation,
 						},
+						{
+							Name:      "many-to-many",
+							Usage:     "add junction table with composite primary key and relations to both tables",
+							ArgsUsage: "[--table] tableName remoteTableName",
+							Flags: []cli.Flag{
+								cli.StringFlag{
+									Name:  "table",
+									Usage: "junction table name, default tableName_remoteTableName",
+								},
+							},
+							Action: addManyToManyRelation,
+						},
 					},
 				},
 				{
@@ -219,10 +608,48 @@ func main() {
 						},
 					},
 				},
+				{
+					Name:  "index",
+					Usage: "define table indexes",
+					Subcommands: []cli.Command{
+						{
+							Name:      "add",
+							ArgsUsage: "index add [--unique] [--concurrently] indexName tableName 'columnName1;columnName2'",
+							Flags: []cli.Flag{
+								cli.BoolFlag{
+									Name:  "unique",
+									Usage: "create unique index",
+								},
+								cli.BoolFlag{
+									Name:  "concurrently",
+									Usage: "create index without locking writes, runs outside of transaction",
+								},
+							},
+							Action: addIndex,
+						},
+						{
+							Name:      "delete",
+							ArgsUsage: "index delete [--concurrently] table indexName",
+							Flags: []cli.Flag{
+								cli.BoolFlag{
+									Name:  "concurrently",
+									Usage: "drop index without locking the table, runs outside of transaction",
+								},
+							},
+							Action: deleteIndex,
+						},
+					},
+				},
 			},
 		},
 	}
 
+	for index := range app.Commands {
+		if app.Commands[index].Name == "migration" {
+			app.Commands[index].Subcommands = addDatabaseFlag(app.Commands[index].Subcommands)
+		}
+	}
+
 	err := app.Run(os.Args)
 	if err != nil {
 		log.Fatal(err)
@@ -342,6 +769,18 @@ func startProject(c *cli.Context) error {
 	return global.StartProject()
 }
 
+func startDb(c *cli.Context) error {
+	return global.StartDb()
+}
+
+func stopDb(c *cli.Context) error {
+	return global.StopDb()
+}
+
+func resetDb(c *cli.Context) error {
+	return global.ResetDb()
+}
+
 func instanceAdd(c *cli.Context) error {
 	args := c.Args()
 
@@ -450,7 +889,12 @@ func addMigration(c *cli.Context) error {
 	args := c.Args()
 	description := args.Get(0)
 
-	migrationFileName, err := db.AddMigration(description)
+	format, err := global.GetMigrationFormat()
+	if err != nil {
+		return err
+	}
+
+	migrationFileName, err := db.AddMigration(description, format)
 	if err == nil {
 		fmt.Println(migrationFileName)
 	}
@@ -466,7 +910,23 @@ func addTable(c *cli.Context) error {
 		return fmt.Errorf("table name is required")
 	}
 
-	updatedMigrationId, err := db.AddTable(tableName)
+	presetName := c.String("preset")
+	if presetName == "" {
+		updatedMigrationId, err := db.AddTable(tableName)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(updatedMigrationId)
+		return nil
+	}
+
+	preset, err := global.GetTablePreset(presetName)
+	if err != nil {
+		return err
+	}
+
+	updatedMigrationId, err := db.AddTableWithPreset(tableName, *preset)
 	if err != nil {
 		return err
 	}
@@ -475,15 +935,20 @@ func addTable(c *cli.Context) error {
 	return nil
 }
 
-func deleteTable(c *cli.Context) error {
+func setUpdatedAtTrigger(c *cli.Context) error {
 	args := c.Args()
 	tableName := args.Get(0)
+	columnName := args.Get(1)
 
 	if tableName == "" {
 		return fmt.Errorf("table name is required")
 	}
 
-	updatedMigrationId, err := db.DeleteTable(tableName)
+	if columnName == "" {
+		return fmt.Errorf("column name is required")
+	}
+
+	updatedMigrationId, err := db.SetUpdatedAtTrigger(tableName, columnName)
 	if err != nil {
 		return err
 	}
@@ -492,28 +957,31 @@ func deleteTable(c *cli.Context) error {
 	return nil
 }
 
-func addColumn(c *cli.Context) error {
+func dropUpdatedAtTrigger(c *cli.Context) error {
 	args := c.Args()
-
 	tableName := args.Get(0)
+
 	if tableName == "" {
 		return fmt.Errorf("table name is required")
 	}
 
-	columnName := args.Get(1)
-	if columnName == "" {
-		return fmt.Errorf("column name is required")
+	updatedMigrationId, err := db.DropUpdatedAtTrigger(tableName)
+	if err != nil {
+		return err
 	}
 
-	columnType := args.Get(2)
-	if columnType == "" {
-		return fmt.Errorf("column type is required")
-	}
+	fmt.Println(updatedMigrationId)
+	return nil
+}
 
-	isNullable := c.BoolT("nullable")
-	defaultValue := c.String("default")
+func setChangeNotify(c *cli.Context) error {
+	tableNames := []string(c.Args())
 
-	updatedMigrationId, err := db.AddColumn(tableName, columnName, columnType, isNullable, defaultValue)
+	if len(tableNames) == 0 {
+		return fmt.Errorf("table name is required")
+	}
+
+	updatedMigrationId, err := db.SetChangeNotify(tableNames, c.String("channel"))
 	if err != nil {
 		return err
 	}
@@ -522,20 +990,15 @@ func addColumn(c *cli.Context) error {
 	return nil
 }
 
-func deleteColumn(c *cli.Context) error {
+func dropChangeNotify(c *cli.Context) error {
 	args := c.Args()
-
 	tableName := args.Get(0)
+
 	if tableName == "" {
 		return fmt.Errorf("table name is required")
 	}
 
-	columnName := args.Get(1)
-	if columnName == "" {
-		return fmt.Errorf("column name is required")
-	}
-
-	updatedMigrationId, err := db.DeleteColumn(tableName, columnName)
+	updatedMigrationId, err := db.DropChangeNotify(tableName)
 	if err != nil {
 		return err
 	}
@@ -544,20 +1007,15 @@ func deleteColumn(c *cli.Context) error {
 	return nil
 }
 
-func addPrimaryKey(c *cli.Context) error {
+func enableAudit(c *cli.Context) error {
 	args := c.Args()
-
 	tableName := args.Get(0)
+
 	if tableName == "" {
 		return fmt.Errorf("table name is required")
 	}
 
-	columnName := args.Get(1)
-	if columnName == "" {
-		return fmt.Errorf("column name is required")
-	}
-
-	updatedMigrationId, err := db.AddPrimaryKey(tableName, columnName)
+	updatedMigrationId, err := db.EnableAudit(tableName, c.String("history"))
 	if err != nil {
 		return err
 	}
@@ -566,20 +1024,15 @@ func addPrimaryKey(c *cli.Context) error {
 	return nil
 }
 
-func deletePrimaryKey(c *cli.Context) error {
+func disableAudit(c *cli.Context) error {
 	args := c.Args()
-
 	tableName := args.Get(0)
+
 	if tableName == "" {
 		return fmt.Errorf("table name is required")
 	}
 
-	columnName := args.Get(1)
-	if columnName == "" {
-		return fmt.Errorf("column name is required")
-	}
-
-	updatedMigrationId, err := db.DeletePrimaryKey(tableName, columnName)
+	updatedMigrationId, err := db.DisableAudit(tableName)
 	if err != nil {
 		return err
 	}
@@ -588,10 +1041,269 @@ func deletePrimaryKey(c *cli.Context) error {
 	return nil
 }
 
-func listMigrations(c *cli.Context) error {
-	migrations, err := db.GetList()
-	if err != nil {
-		return err
+func deleteTable(c *cli.Context) error {
+	args := c.Args()
+	tableName := args.Get(0)
+
+	if tableName == "" {
+		return fmt.Errorf("table name is required")
+	}
+
+	updatedMigrationId, err := db.DeleteTable(tableName)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(updatedMigrationId)
+	return nil
+}
+
+func renameTable(c *cli.Context) error {
+	args := c.Args()
+
+	updatedMigrationId, err := db.RenameTable(args.Get(0), args.Get(1))
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(updatedMigrationId)
+	return nil
+}
+
+func setTableComment(c *cli.Context) error {
+	args := c.Args()
+
+	tableName := args.Get(0)
+	if tableName == "" {
+		return fmt.Errorf("table name is required")
+	}
+
+	updatedMigrationId, err := db.SetTableComment(tableName, args.Get(1))
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(updatedMigrationId)
+	return nil
+}
+
+func setColumnComment(c *cli.Context) error {
+	args := c.Args()
+
+	tableName := args.Get(0)
+	if tableName == "" {
+		return fmt.Errorf("table name is required")
+	}
+
+	columnName := args.Get(1)
+	if columnName == "" {
+		return fmt.Errorf("column name is required")
+	}
+
+	updatedMigrationId, err := db.SetColumnComment(tableName, columnName, args.Get(2))
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(updatedMigrationId)
+	return nil
+}
+
+func addColumn(c *cli.Context) error {
+	args := c.Args()
+
+	tableName := args.Get(0)
+	if tableName == "" {
+		return fmt.Errorf("table name is required")
+	}
+
+	columnName := args.Get(1)
+	if columnName == "" {
+		return fmt.Errorf("column name is required")
+	}
+
+	columnType := args.Get(2)
+	if columnType == "" {
+		return fmt.Errorf("column type is required")
+	}
+
+	params := db.AddColumnParams{
+		Table:      tableName,
+		Column:     columnName,
+		Type:       columnType,
+		IsNullable: c.BoolT("nullable"),
+		Generated:  c.String("generated"),
+	}
+
+	if c.IsSet("default") && c.IsSet("default-expr") {
+		return fmt.Errorf("only one of --default and --default-expr can be used")
+	}
+
+	if c.IsSet("default") {
+		params.Default = &db.Default{
+			Kind:  db.DefaultLiteral,
+			Value: c.String("default"),
+		}
+	} else if c.IsSet("default-expr") {
+		params.Default = &db.Default{
+			Kind:  db.DefaultExpression,
+			Value: c.String("default-expr"),
+		}
+	}
+
+	identity := c.String("identity")
+	if identity != "" {
+		params.Identity = &db.Identity{
+			Generation:      db.IdentityGeneration(identity),
+			SequenceOptions: parseSequenceOptions(c),
+		}
+	}
+
+	updatedMigrationId, err := db.AddColumn(params)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(updatedMigrationId)
+	return nil
+}
+
+func parseSequenceOptions(c *cli.Context) db.SequenceOptions {
+	options := db.SequenceOptions{
+		Cycle: c.Bool("cycle"),
+	}
+
+	getValue := func(name string) *int64 {
+		if !c.IsSet(name) {
+			return nil
+		}
+
+		value := c.Int64(name)
+		return &value
+	}
+
+	options.Start = getValue("start")
+	options.Increment = getValue("increment")
+	options.MinValue = getValue("min")
+	options.MaxValue = getValue("max")
+	options.Cache = getValue("cache")
+
+	return options
+}
+
+func addSequence(c *cli.Context) error {
+	args := c.Args()
+
+	name := args.Get(0)
+	if name == "" {
+		return fmt.Errorf("sequence name is required")
+	}
+
+	updatedMigrationId, err := db.AddSequence(name, c.String("type"), parseSequenceOptions(c))
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(updatedMigrationId)
+	return nil
+}
+
+func deleteSequence(c *cli.Context) error {
+	args := c.Args()
+
+	name := args.Get(0)
+	if name == "" {
+		return fmt.Errorf("sequence name is required")
+	}
+
+	updatedMigrationId, err := db.DeleteSequence(name)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(updatedMigrationId)
+	return nil
+}
+
+func renameColumn(c *cli.Context) error {
+	args := c.Args()
+
+	updatedMigrationId, err := db.RenameColumn(args.Get(0), args.Get(1), args.Get(2))
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(updatedMigrationId)
+	return nil
+}
+
+func deleteColumn(c *cli.Context) error {
+	args := c.Args()
+
+	tableName := args.Get(0)
+	if tableName == "" {
+		return fmt.Errorf("table name is required")
+	}
+
+	columnName := args.Get(1)
+	if columnName == "" {
+		return fmt.Errorf("column name is required")
+	}
+
+	updatedMigrationId, err := db.DeleteColumn(tableName, columnName)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(updatedMigrationId)
+	return nil
+}
+
+func setPrimaryKey(c *cli.Context) error {
+	args := c.Args()
+
+	tableName := args.Get(0)
+	if tableName == "" {
+		return fmt.Errorf("table name is required")
+	}
+
+	rawColumns := args.Get(1)
+	if rawColumns == "" {
+		return fmt.Errorf("columns are required")
+	}
+
+	columns := strings.Split(rawColumns, ";")
+
+	updatedMigrationId, err := db.SetPrimaryKey(tableName, columns, c.String("name"))
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(updatedMigrationId)
+	return nil
+}
+
+func dropPrimaryKey(c *cli.Context) error {
+	args := c.Args()
+
+	tableName := args.Get(0)
+	if tableName == "" {
+		return fmt.Errorf("table name is required")
+	}
+
+	updatedMigrationId, err := db.DropPrimaryKey(tableName)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(updatedMigrationId)
+	return nil
+}
+
+func listMigrations(c *cli.Context) error {
+	migrations, err := db.GetList()
+	if err != nil {
+		return err
 	}
 
 	packedMigrations, _ := json.MarshalIndent(migrations, "", "  ")
@@ -647,6 +1359,18 @@ func addRelation(c *cli.Context) error {
 	return nil
 }
 
+func addManyToManyRelation(c *cli.Context) error {
+	args := c.Args()
+
+	updatedMigrationId, err := db.AddManyToManyRelation(args.Get(0), args.Get(1), c.String("table"))
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(updatedMigrationId)
+	return nil
+}
+
 func deleteRelation(c *cli.Context) error {
 	args := c.Args()
 
@@ -695,6 +1419,39 @@ func deleteUniqueConstraint(c *cli.Context) error {
 	return nil
 }
 
+func addIndex(c *cli.Context) error {
+	args := c.Args()
+
+	indexName := args.Get(0)
+	table := args.Get(1)
+	rawColumns := args.Get(2)
+
+	columns := strings.Split(rawColumns, ";")
+
+	updatedMigrationId, err := db.AddIndex(indexName, table, columns, c.Bool("unique"), c.Bool("concurrently"))
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(updatedMigrationId)
+	return nil
+}
+
+func deleteIndex(c *cli.Context) error {
+	args := c.Args()
+
+	table := args.Get(0)
+	indexName := args.Get(1)
+
+	updatedMigrationId, err := db.DeleteIndex(table, indexName, c.Bool("concurrently"))
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(updatedMigrationId)
+	return nil
+}
+
 func migrationSnapshot(c *cli.Context) error {
 	snapshot, err := db.GetCurrentSnapshot()
 	if err != nil {
@@ -706,6 +1463,490 @@ func migrationSnapshot(c *cli.Context) error {
 	return nil
 }
 
+var stdinReader = bufio.NewReader(os.Stdin)
+
+func confirmRename(kind string, table string, name string, newName string) bool {
+	if table != "" {
+		name = table + "." + name
+	}
+
+	fmt.Printf("Is %v '%v' renamed to '%v'? [y/N] ", kind, name, newName)
+
+	answer, _ := stdinReader.ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+func generateMigration(c *cli.Context) error {
+	description := c.Args().Get(0)
+
+	schemaPath := c.String("schema")
+	if schemaPath == "" {
+		var err error
+		schemaPath, err = db.GetDesiredSchemaPath()
+		if err != nil {
+			return err
+		}
+	}
+
+	format, err := global.GetMigrationFormat()
+	if err != nil {
+		return err
+	}
+
+	fileName, err := db.GenerateMigration(description, schemaPath, format, confirmRename)
+	if err != nil {
+		return err
+	}
+
+	if fileName == "" {
+		fmt.Println("schema is up to date")
+		return nil
+	}
+
+	fmt.Println(fileName)
+	return nil
+}
+
+var migrationIdFlag = cli.StringFlag{
+	Name:  "migration",
+	Usage: "migration id, default is the last migration",
+}
+
+var forceCheckFlag = cli.BoolFlag{
+	Name:  "force",
+	Usage: "skip unreachable databases while checking that the migration isn't applied",
+}
+
+func parseActionIndex(rawIndex string) (int, error) {
+	if rawIndex == "" {
+		return 0, fmt.Errorf("action index is required")
+	}
+
+	index, err := strconv.Atoi(rawIndex)
+	if err != nil {
+		return 0, fmt.Errorf("wrong action index: %v", rawIndex)
+	}
+
+	return index, nil
+}
+
+// getEditableMigrationId returns id of the migration if it isn't applied to databases of the project
+func getEditableMigrationId(c *cli.Context) (string, error) {
+	migration, err := db.GetEditableMigration(c.String("migration"))
+	if err != nil {
+		return "", err
+	}
+
+	err = global.CheckMigrationIsNotApplied(migration.Id, c.Bool("force"))
+	if err != nil {
+		return "", err
+	}
+
+	return migration.Id, nil
+}
+
+func listActions(c *cli.Context) error {
+	migration, err := db.GetEditableMigration(c.String("migration"))
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(migration.Id, migration.Description)
+
+	for index, action := range migration.Actions {
+		var params bytes.Buffer
+		err = json.Compact(&params, action.Params)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("#%v %v %v\n", index, action.Method, params.String())
+	}
+
+	return nil
+}
+
+func removeAction(c *cli.Context) error {
+	index, err := parseActionIndex(c.Args().Get(0))
+	if err != nil {
+		return err
+	}
+
+	migrationId, err := getEditableMigrationId(c)
+	if err != nil {
+		return err
+	}
+
+	updatedMigrationId, err := db.RemoveAction(migrationId, index)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(updatedMigrationId)
+	return nil
+}
+
+func moveAction(c *cli.Context) error {
+	args := c.Args()
+
+	from, err := parseActionIndex(args.Get(0))
+	if err != nil {
+		return err
+	}
+
+	to, err := parseActionIndex(args.Get(1))
+	if err != nil {
+		return err
+	}
+
+	migrationId, err := getEditableMigrationId(c)
+	if err != nil {
+		return err
+	}
+
+	updatedMigrationId, err := db.MoveAction(migrationId, from, to)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(updatedMigrationId)
+	return nil
+}
+
+func undoAction(c *cli.Context) error {
+	migrationId, err := getEditableMigrationId(c)
+	if err != nil {
+		return err
+	}
+
+	updatedMigrationId, err := db.UndoAction(migrationId)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(updatedMigrationId)
+	return nil
+}
+
+func exportSql(c *cli.Context) error {
+	if c.Bool("full-ddl") {
+		filePath, err := db.ExportFullDdl(c.String("out"))
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(filePath)
+		return nil
+	}
+
+	files, err := db.ExportSql(c.String("out"))
+	for _, filePath := range files {
+		fmt.Println(filePath)
+	}
+
+	return err
+}
+
+func convertMigrations(c *cli.Context) error {
+	if c.String("to") == "" {
+		return fmt.Errorf("format is required")
+	}
+
+	format, err := db.ParseMigrationFormat(c.String("to"))
+	if err != nil {
+		return err
+	}
+
+	converted, err := db.ConvertMigrations(format, c.Args())
+	for _, fileName := range converted {
+		fmt.Println(fileName)
+	}
+
+	return err
+}
+
+func applyPlan(c *cli.Context) error {
+	planPath := c.Args().Get(0)
+
+	if planPath == "" {
+		return fmt.Errorf("plan file is required")
+	}
+
+	updatedMigrationId, err := db.ApplyPlan(planPath)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(updatedMigrationId)
+	return nil
+}
+
+func diffMigrations(c *cli.Context) error {
+	args := c.Args()
+
+	if args.Get(0) == "" {
+		return fmt.Errorf("revision is required")
+	}
+
+	before, err := db.GetSnapshotAtRevision(args.Get(0))
+	if err != nil {
+		return err
+	}
+
+	after, err := db.GetSnapshotAtRevision(args.Get(1))
+	if err != nil {
+		return err
+	}
+
+	changes := db.DiffSchemas(before, after)
+
+	if c.Bool("json") {
+		textChanges, _ := json.MarshalIndent(changes, "", "  ")
+		fmt.Println(string(textChanges))
+		return nil
+	}
+
+	for _, change := range changes {
+		fmt.Println(change)
+	}
+
+	return nil
+}
+
+func generateDocs(c *cli.Context) error {
+	files, err := db.GenerateDocs(c.String("out"), db.DocsFormat(c.String("format")))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		fmt.Println(file)
+	}
+
+	return nil
+}
+
+var databaseFlag = cli.StringFlag{
+	Name:  "db",
+	Usage: "named database of the project with migrations in migrations/<db>, default database if empty",
+}
+
+// addDatabaseFlag adds the database selector to every command of the tree
+func addDatabaseFlag(commands []cli.Command) []cli.Command {
+	for index := range commands {
+		command := &commands[index]
+
+		if len(command.Subcommands) > 0 {
+			command.Subcommands = addDatabaseFlag(command.Subcommands)
+			continue
+		}
+
+		command.Flags = append(command.Flags, databaseFlag)
+
+		before := command.Before
+		command.Before = func(c *cli.Context) error {
+			err := db.SelectDatabase(c.String("db"))
+			if err != nil {
+				return err
+			}
+
+			if before != nil {
+				return before(c)
+			}
+
+			return nil
+		}
+	}
+
+	return commands
+}
+
+func openMigrator(c *cli.Context) (*db.Migrator, func(), error) {
+	profile, err := global.GetDbProfile(c.String("profile"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lockName, err := global.GetSyncLockName()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	migrator, connection, err := db.OpenProjectMigrator(*profile, db.SyncOptions{
+		LockName:        lockName,
+		LockWaitTimeout: c.Duration("lock-timeout"),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return migrator, func() { connection.Close() }, nil
+}
+
+func migrationStatus(c *cli.Context) error {
+	migrator, closeMigrator, err := openMigrator(c)
+	if err != nil {
+		return err
+	}
+	defer closeMigrator()
+
+	statuses, err := migrator.Status()
+	if err != nil {
+		return err
+	}
+
+	for _, status := range statuses {
+		fmt.Printf("%v\t%v\t%v/%v\t%v\n", status.Id, status.State, status.AppliedActions, status.ActionsCount, status.Description)
+	}
+
+	return nil
+}
+
+func rollbackMigration(c *cli.Context) error {
+	migrator, closeMigrator, err := openMigrator(c)
+	if err != nil {
+		return err
+	}
+	defer closeMigrator()
+
+	return migrator.Rollback()
+}
+
 func syncMigrations(c *cli.Context) error {
-	return db.Sync()
+	if !c.Bool("all") {
+		return syncDatabase(c)
+	}
+
+	if c.String("db") != "" {
+		return fmt.Errorf("--all and --db can't be used together")
+	}
+
+	names, err := global.GetDatabaseNames()
+	if err != nil {
+		return err
+	}
+
+	// Databases sharing a connection would share the migrations table too,
+	// so the same connection is rejected before anything is synced
+	syncedNames := []string{}
+	connections := map[string]string{}
+
+	for _, name := range names {
+		err = db.SelectDatabase(name)
+		if err != nil {
+			return err
+		}
+
+		displayName := getDatabaseDisplayName(name)
+		if name == "" {
+			// The default database may be unused when the project has only named databases
+			migrations, err := db.GetList()
+			if err == nil && len(*migrations) == 0 {
+				continue
+			}
+		}
+
+		syncedNames = append(syncedNames, name)
+
+		profile, err := global.GetDbProfile(c.String("profile"))
+		if err != nil {
+			continue
+		}
+
+		connection := profile.ConnectionString()
+		if otherName, ok := connections[connection]; ok {
+			return fmt.Errorf("databases %v and %v use the same db profile connection, their migrations would be mixed in one migrations table", otherName, displayName)
+		}
+		connections[connection] = displayName
+	}
+
+	failed := []string{}
+
+	for _, name := range syncedNames {
+		err = db.SelectDatabase(name)
+		if err != nil {
+			return err
+		}
+
+		displayName := getDatabaseDisplayName(name)
+		fmt.Printf("database %v\n", displayName)
+
+		err = syncDatabase(c)
+		if err != nil {
+			log.Printf("can't sync database %v: %v", displayName, err)
+			failed = append(failed, displayName)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("can't sync databases: %v", strings.Join(failed, ", "))
+	}
+
+	return nil
+}
+
+func getDatabaseDisplayName(name string) string {
+	if name == "" {
+		return "default"
+	}
+
+	return name
+}
+
+// syncDatabase syncs the database selected in db package
+func syncDatabase(c *cli.Context) error {
+	profile, err := global.GetDbProfile(c.String("profile"))
+	if err != nil {
+		return err
+	}
+
+	lockName, err := global.GetSyncLockName()
+	if err != nil {
+		return err
+	}
+
+	options := db.SyncOptions{
+		Transaction:     db.TransactionMode(c.String("transaction")),
+		LockName:        lockName,
+		LockWaitTimeout: c.Duration("lock-timeout"),
+	}
+
+	if c.String("tenant-pattern") == "" && c.String("tenant-query") == "" {
+		return db.Sync(*profile, options)
+	}
+
+	migrator, connection, err := db.OpenProjectMigrator(*profile, options)
+	if err != nil {
+		return err
+	}
+	defer connection.Close()
+
+	results, err := migrator.SyncTenants(db.TenantOptions{
+		SchemaPattern: c.String("tenant-pattern"),
+		SchemaQuery:   c.String("tenant-query"),
+		Parallelism:   c.Int("parallel"),
+	})
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+			fmt.Printf("%v\terror: %v\n", result.Schema, strings.TrimSpace(result.Err.Error()))
+			continue
+		}
+
+		fmt.Printf("%v\tok\n", result.Schema)
+	}
+
+	fmt.Printf("%v of %v tenants synced\n", len(results)-failed, len(results))
+
+	if failed > 0 {
+		return fmt.Errorf("can't sync %v tenants", failed)
+	}
+
+	return nil
 }
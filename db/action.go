@@ -0,0 +1,138 @@
+package db
+
+import (
+	"fmt"
+)
+
+// GetEditableMigration returns the migration with the id or the last migration if the id is empty
+func GetEditableMigration(migrationId string) (*Migration, error) {
+
+	migrations, err := GetList()
+	if err != nil {
+		return nil, fmt.Errorf("can't get migrations: %v", err)
+	}
+
+	index, err := getMigrationIndex(*migrations, migrationId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &(*migrations)[index], nil
+}
+
+func getMigrationIndex(migrations []Migration, migrationId string) (int, error) {
+
+	if len(migrations) == 0 {
+		return -1, fmt.Errorf("migration doesn't exist, please add migration")
+	}
+
+	if migrationId == "" {
+		return len(migrations) - 1, nil
+	}
+
+	for index, migration := range migrations {
+		if migration.Id == migrationId {
+			return index, nil
+		}
+	}
+
+	return -1, fmt.Errorf("migration %v doesn't exist", migrationId)
+}
+
+func checkActionIndex(migration *Migration, index int) error {
+	if index < 0 || index >= len(migration.Actions) {
+		return fmt.Errorf("migration %v doesn't have action #%v", migration.Id, index)
+	}
+
+	return nil
+}
+
+// editMigrationActions changes actions of the migration, all migrations are
+// replayed with the changed actions before the migration file is written
+func editMigrationActions(migrationId string, edit func(migration *Migration) error) (string, error) {
+
+	migrations, err := GetList()
+	if err != nil {
+		return "", fmt.Errorf("can't get migrations: %v", err)
+	}
+
+	migrationIndex, err := getMigrationIndex(*migrations, migrationId)
+	if err != nil {
+		return "", err
+	}
+
+	migration := &(*migrations)[migrationIndex]
+
+	err = edit(migration)
+	if err != nil {
+		return "", err
+	}
+
+	snapshot := newSnapshot()
+	for _, replayedMigration := range *migrations {
+		for index, action := range replayedMigration.Actions {
+			err = applyActionsToSnapshot(snapshot, []Action{action})
+			if err != nil {
+				return "", fmt.Errorf("migration %v action #%v becomes invalid: %v", replayedMigration.Id, index, err)
+			}
+		}
+	}
+
+	migrationPath, err := getMigrationPath(migration.Id)
+	if err != nil {
+		return "", err
+	}
+
+	err = writeMigrationFile(migrationPath, *migration)
+	if err != nil {
+		return "", fmt.Errorf("can't write migration: %v", err)
+	}
+
+	return migration.Id, nil
+}
+
+func RemoveAction(migrationId string, index int) (string, error) {
+	return editMigrationActions(migrationId, func(migration *Migration) error {
+		err := checkActionIndex(migration, index)
+		if err != nil {
+			return err
+		}
+
+		migration.Actions = append(migration.Actions[:index], migration.Actions[index+1:]...)
+		return nil
+	})
+}
+
+// MoveAction moves the action to the position, actions between them are shifted
+func MoveAction(migrationId string, from int, to int) (string, error) {
+	return editMigrationActions(migrationId, func(migration *Migration) error {
+		err := checkActionIndex(migration, from)
+		if err != nil {
+			return err
+		}
+
+		err = checkActionIndex(migration, to)
+		if err != nil {
+			return err
+		}
+
+		action := migration.Actions[from]
+		actions := append(migration.Actions[:from:from], migration.Actions[from+1:]...)
+		actions = append(actions[:to], append([]Action{action}, actions[to:]...)...)
+
+		migration.Actions = actions
+		return nil
+	})
+}
+
+// UndoAction removes the last action of the migration
+func UndoAction(migrationId string) (string, error) {
+	return editMigrationActions(migrationId, func(migration *Migration) error {
+		if len(migration.Actions) == 0 {
+			return fmt.Errorf("migration %v doesn't have actions", migration.Id)
+		}
+
+		migration.Actions = migration.Actions[:len(migration.Actions)-1]
+		return nil
+	})
+}
@@ -0,0 +1,143 @@
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+func setupActionsProject(t *testing.T) {
+	t.Helper()
+
+	setupTestProject(t, []Migration{
+		{SchemaVersion: "1", Id: "0001", Actions: []Action{
+			newAction("addTable", AddTableParams{Name: "users"}),
+			newAction("addColumn", AddColumnParams{Table: "users", Column: "id", Type: "integer"}),
+			newAction("addColumn", AddColumnParams{Table: "users", Column: "name", Type: "text"}),
+		}},
+		{SchemaVersion: "1", Id: "0002", Actions: []Action{
+			newAction("setPrimaryKey", SetPrimaryKeyParams{Table: "users", Columns: []string{"id"}}),
+			newAction("addColumn", AddColumnParams{Table: "users", Column: "email", Type: "text", IsNullable: true}),
+		}},
+	})
+}
+
+func getMigrationMethods(t *testing.T, migrationId string) string {
+	t.Helper()
+
+	migration, err := GetEditableMigration(migrationId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	methods := []string{}
+	for _, action := range migration.Actions {
+		methods = append(methods, action.Method)
+	}
+
+	return strings.Join(methods, ", ")
+}
+
+func TestEditMigrationActions(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		edit        func() (string, error)
+		migrationId string
+		methods     string
+	}{
+		{
+			name:        "remove action",
+			edit:        func() (string, error) { return RemoveAction("0002", 1) },
+			migrationId: "0002",
+			methods:     "setPrimaryKey",
+		},
+		{
+			name:        "move action",
+			edit:        func() (string, error) { return MoveAction("0002", 1, 0) },
+			migrationId: "0002",
+			methods:     "addColumn, setPrimaryKey",
+		},
+		{
+			name:        "undo last migration action",
+			edit:        func() (string, error) { return UndoAction("") },
+			migrationId: "0002",
+			methods:     "setPrimaryKey",
+		},
+		{
+			name:        "move action to its own position",
+			edit:        func() (string, error) { return MoveAction("0001", 0, 0) },
+			migrationId: "0001",
+			methods:     "addTable, addColumn, addColumn",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setupActionsProject(t)
+
+			migrationId, err := test.edit()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if migrationId != test.migrationId {
+				t.Fatalf("expected migration %v, got %v", test.migrationId, migrationId)
+			}
+
+			methods := getMigrationMethods(t, test.migrationId)
+			if methods != test.methods {
+				t.Fatalf("expected actions %v, got %v", test.methods, methods)
+			}
+		})
+	}
+}
+
+func TestEditMigrationActionsErrors(t *testing.T) {
+
+	tests := []struct {
+		name string
+		edit func() (string, error)
+		err  string
+	}{
+		{
+			name: "action used by later migration",
+			edit: func() (string, error) { return RemoveAction("0001", 1) },
+			err:  "migration 0002 action #0 becomes invalid",
+		},
+		{
+			name: "action moved before its table",
+			edit: func() (string, error) { return MoveAction("0001", 0, 2) },
+			err:  "migration 0001 action #0 becomes invalid",
+		},
+		{
+			name: "wrong action index",
+			edit: func() (string, error) { return RemoveAction("0002", 2) },
+			err:  "migration 0002 doesn't have action #2",
+		},
+		{
+			name: "wrong migration",
+			edit: func() (string, error) { return UndoAction("0003") },
+			err:  "migration 0003 doesn't exist",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setupActionsProject(t)
+
+			_, err := test.edit()
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected error %q, got %v", test.err, err)
+			}
+
+			// The migration file isn't written when the edit fails
+			if methods := getMigrationMethods(t, "0001"); methods != "addTable, addColumn, addColumn" {
+				t.Fatalf("migration 0001 is changed: %v", methods)
+			}
+
+			if methods := getMigrationMethods(t, "0002"); methods != "setPrimaryKey, addColumn" {
+				t.Fatalf("migration 0002 is changed: %v", methods)
+			}
+		})
+	}
+}
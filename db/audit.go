@@ -0,0 +1,118 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+const auditHistorySuffix = "_history"
+
+// auditHistoryColumns are columns of history tables, the trigger writes all of them except the id
+var auditHistoryColumns = []Column{
+	{Name: "id", Type: "bigint", Identity: &Identity{Generation: IdentityAlways}},
+	{Name: "operation", Type: "text"},
+	{Name: "changed_at", Type: "timestamp with time zone", Default: &Default{Kind: DefaultExpression, Value: "now()"}},
+	{Name: "changed_by", Type: "text", IsNullable: true},
+	{Name: "old_row", Type: "jsonb", IsNullable: true},
+	{Name: "new_row", Type: "jsonb", IsNullable: true},
+}
+
+// GetAuditHistoryTableName returns the default name of the history table
+func GetAuditHistoryTableName(tableName string) string {
+	return tableName + auditHistorySuffix
+}
+
+// EnableAudit adds the history table if it doesn't exist and triggers recording
+// changes of the table to it. Rows are recorded as json, so columns of the table
+// are changed without changes of the history table and triggers.
+func EnableAudit(tableName string, historyTableName string) (string, error) {
+
+	if strings.TrimSpace(tableName) == "" {
+		return "", fmt.Errorf("table name is required /n")
+	}
+
+	if strings.TrimSpace(historyTableName) == "" {
+		historyTableName = GetAuditHistoryTableName(tableName)
+	}
+
+	snapshot, err := GetCurrentSnapshot()
+	if err != nil {
+		return "", err
+	}
+
+	return addActionsToMigrationFile(getAuditActions(snapshot, tableName, historyTableName))
+}
+
+func DisableAudit(tableName string) (string, error) {
+
+	if strings.TrimSpace(tableName) == "" {
+		return "", fmt.Errorf("table name is required /n")
+	}
+
+	params := DisableAuditParams{
+		Table: tableName,
+	}
+
+	return addActionToMigrationFile("disableAudit", params)
+}
+
+// getAuditActions adds the history table unless it's kept from the audit
+// disabled before, actions are validated when added to the migration
+func getAuditActions(snapshot *Snapshot, tableName string, historyTableName string) []Action {
+
+	actions := []Action{}
+
+	if getTableFromSnapshot(snapshot, historyTableName) == nil {
+		actions = append(actions, newAction("addTable", AddTableParams{Name: historyTableName}))
+		actions = append(actions, newAction("setTableComment", SetTableCommentParams{Table: historyTableName, Comment: "history of " + tableName}))
+
+		for _, column := range auditHistoryColumns {
+			actions = append(actions, newAction("addColumn", AddColumnParams{
+				Table:      historyTableName,
+				Column:     column.Name,
+				Type:       column.Type,
+				IsNullable: column.IsNullable,
+				Default:    column.Default,
+				Identity:   column.Identity,
+			}))
+		}
+
+		actions = append(actions, newAction("setPrimaryKey", SetPrimaryKeyParams{Table: historyTableName, Columns: []string{"id"}}))
+	}
+
+	actions = append(actions, newAction("enableAudit", EnableAuditParams{Table: tableName, HistoryTable: historyTableName}))
+	return actions
+}
+
+// checkAuditHistoryTable checks columns written by the trigger, the history table can have other columns
+func checkAuditHistoryTable(historyTable *Table) error {
+
+	for _, auditColumn := range auditHistoryColumns[1:] {
+		column := getColumnFromTable(historyTable, auditColumn.Name)
+		if column == nil {
+			return fmt.Errorf("history table '%v' doesn't have column '%v'", historyTable.Name, auditColumn.Name)
+		}
+
+		if !isSameColumnType(column.Type, auditColumn.Type) {
+			return fmt.Errorf("column '%v' of history table '%v' should be %v", auditColumn.Name, historyTable.Name, auditColumn.Type)
+		}
+	}
+
+	return nil
+}
+
+func checkAuditColumnIsNotUsed(snapshot *Snapshot, table *Table, columnName string) error {
+
+	auditedTable := getAuditedTable(snapshot, table.Name)
+	if auditedTable == nil {
+		return nil
+	}
+
+	for _, auditColumn := range auditHistoryColumns[1:] {
+		if auditColumn.Name == columnName {
+			return fmt.Errorf("column '%v' is used by audit of table '%v'", columnName, auditedTable.Name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,286 @@
+package db
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+)
+
+// CacheDirectoryName is the directory of the project with files which can be built again,
+// it ignores itself in git, so it isn't committed in projects created before it was ignored
+const CacheDirectoryName = ".cubes"
+const snapshotCacheFileName = "snapshot_cache.json"
+
+// snapshotCacheVersion changes with fields of the snapshot and with every build of the tool,
+// so snapshots cached by another version are replayed again
+var snapshotCacheVersion = getSnapshotCacheVersion()
+
+func getSnapshotCacheVersion() string {
+	hash := sha256.New()
+	writeTypeSchema(hash, reflect.TypeOf(Snapshot{}), map[reflect.Type]bool{})
+
+	executablePath, err := os.Executable()
+	if err == nil {
+		executableInfo, err := os.Stat(executablePath)
+		if err == nil {
+			fmt.Fprintf(hash, "%v %v %v", executablePath, executableInfo.Size(), executableInfo.ModTime().UnixNano())
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// writeTypeSchema writes names, json tags and types of fields, every struct is expanded once
+func writeTypeSchema(writer io.Writer, valueType reflect.Type, written map[reflect.Type]bool) {
+
+	switch valueType.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		fmt.Fprintf(writer, "%v(", valueType.Kind())
+		writeTypeSchema(writer, valueType.Elem(), written)
+		fmt.Fprint(writer, ")")
+	case reflect.Map:
+		fmt.Fprint(writer, "map(")
+		writeTypeSchema(writer, valueType.Key(), written)
+		fmt.Fprint(writer, ",")
+		writeTypeSchema(writer, valueType.Elem(), written)
+		fmt.Fprint(writer, ")")
+	case reflect.Struct:
+		fmt.Fprint(writer, valueType.Name())
+		if written[valueType] {
+			return
+		}
+		written[valueType] = true
+
+		fmt.Fprint(writer, "{")
+		for index := 0; index < valueType.NumField(); index++ {
+			field := valueType.Field(index)
+			fmt.Fprintf(writer, "%v %q ", field.Name, field.Tag.Get("json"))
+			writeTypeSchema(writer, field.Type, written)
+			fmt.Fprint(writer, ";")
+		}
+		fmt.Fprint(writer, "}")
+	default:
+		fmt.Fprintf(writer, "%v", valueType.Kind())
+	}
+}
+
+type snapshotCacheEntry struct {
+	Id              string `json:"id"`
+	FileName        string `json:"fileName"`
+	Checksum        string `json:"checksum"`
+	ActionsCount    int    `json:"actionsCount"`
+	ActionsChecksum string `json:"actionsChecksum"`
+}
+
+// snapshotCache keeps the snapshot produced by replaying all migrations
+// listed in Entries, so that only new migrations and actions are replayed
+type snapshotCache struct {
+	Version  string               `json:"version"`
+	Entries  []snapshotCacheEntry `json:"entries"`
+	Snapshot Snapshot             `json:"snapshot"`
+}
+
+func getSnapshotCachePath() (string, error) {
+	pwd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(pwd, CacheDirectoryName, selectedDatabase, snapshotCacheFileName), nil
+}
+
+func readSnapshotCache() *snapshotCache {
+	cachePath, err := getSnapshotCachePath()
+	if err != nil {
+		return nil
+	}
+
+	rawCache, err := ioutil.ReadFile(cachePath)
+	if err != nil {
+		return nil
+	}
+
+	var cache snapshotCache
+	err = json.Unmarshal(rawCache, &cache)
+	if err != nil || cache.Version != snapshotCacheVersion {
+		return nil
+	}
+
+	return &cache
+}
+
+func writeSnapshotCache(cache *snapshotCache) error {
+	cachePath, err := getSnapshotCachePath()
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(cachePath), 0777)
+	if err != nil {
+		return err
+	}
+
+	err = writeCacheDirectoryGitignore()
+	if err != nil {
+		return err
+	}
+
+	packedCache, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+
+	temporaryPath := cachePath + ".tmp"
+	err = ioutil.WriteFile(temporaryPath, packedCache, 0666)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(temporaryPath, cachePath)
+}
+
+// writeCacheDirectoryGitignore makes git ignore all files of the cache directory
+func writeCacheDirectoryGitignore() error {
+	pwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	gitignorePath := filepath.Join(pwd, CacheDirectoryName, ".gitignore")
+	if _, err := os.Stat(gitignorePath); err == nil {
+		return nil
+	}
+
+	return ioutil.WriteFile(gitignorePath, []byte("*\n"), 0666)
+}
+
+func getChecksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func getActionsChecksum(actions []Action) string {
+	hash := sha256.New()
+
+	for _, action := range actions {
+		packedAction, _ := json.Marshal(action)
+		hash.Write(packedAction)
+		hash.Write([]byte{'\n'})
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func newSnapshotCacheEntry(fileName string, checksum string, migration *Migration) snapshotCacheEntry {
+	return snapshotCacheEntry{
+		Id:              migration.Id,
+		FileName:        fileName,
+		Checksum:        checksum,
+		ActionsCount:    len(migration.Actions),
+		ActionsChecksum: getActionsChecksum(migration.Actions),
+	}
+}
+
+// getCachedSnapshot returns the current snapshot. Migrations whose files are
+// unchanged since the last call are taken from the cache, actions appended to
+// the last cached migration and new migrations are replayed on top of it.
+func getCachedSnapshot() (*Snapshot, error) {
+
+	files, err := getMigrationFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	rawMigrations := make([][]byte, len(files))
+	checksums := make([]string, len(files))
+
+	for index, migrationPath := range files {
+		rawMigration, err := ioutil.ReadFile(migrationPath)
+		if err != nil {
+			return nil, err
+		}
+
+		rawMigrations[index] = rawMigration
+		checksums[index] = getChecksum(rawMigration)
+	}
+
+	snapshot := newSnapshot()
+
+	entries := []snapshotCacheEntry{}
+	start := 0
+	skipActions := 0
+
+	cache := readSnapshotCache()
+	if cache != nil {
+		matched := 0
+
+		for matched < len(cache.Entries) && matched < len(files) {
+			entry := cache.Entries[matched]
+			_, fileName := filepath.Split(files[matched])
+
+			if entry.FileName != fileName || entry.Checksum != checksums[matched] {
+				break
+			}
+
+			matched++
+		}
+
+		if matched == len(cache.Entries) {
+			snapshot = &cache.Snapshot
+			entries = cache.Entries
+			start = matched
+		} else if matched == len(cache.Entries)-1 && matched < len(files) {
+			// Only the last cached migration changed, reuse the cache when actions were appended to it
+			entry := cache.Entries[matched]
+			migration, err := parseMigration(rawMigrations[matched])
+			if err != nil {
+				return nil, err
+			}
+
+			if migration.Id == entry.Id &&
+				len(migration.Actions) >= entry.ActionsCount &&
+				getActionsChecksum(migration.Actions[:entry.ActionsCount]) == entry.ActionsChecksum {
+				snapshot = &cache.Snapshot
+				entries = cache.Entries[:matched]
+				start = matched
+				skipActions = entry.ActionsCount
+			}
+		}
+	}
+
+	isChanged := cache == nil || start < len(files) || len(entries) != len(cache.Entries)
+
+	for index := start; index < len(files); index++ {
+		migration, err := parseMigration(rawMigrations[index])
+		if err != nil {
+			return nil, err
+		}
+
+		err = applyActionsToSnapshot(snapshot, migration.Actions[skipActions:])
+		if err != nil {
+			return nil, err
+		}
+
+		skipActions = 0
+
+		_, fileName := filepath.Split(files[index])
+		entries = append(entries, newSnapshotCacheEntry(fileName, checksums[index], migration))
+	}
+
+	if isChanged {
+		// The cache is an optimisation only, the snapshot is valid even if it can't be saved
+		writeSnapshotCache(&snapshotCache{
+			Version:  snapshotCacheVersion,
+			Entries:  entries,
+			Snapshot: *snapshot,
+		})
+	}
+
+	return snapshot, nil
+}
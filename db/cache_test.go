@@ -0,0 +1,206 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	benchmarkMigrations          = 100
+	benchmarkActionsPerMigration = 50
+)
+
+// getBenchmarkMigrations generates a history where every migration adds a table with columns and a primary key
+func getBenchmarkMigrations() []Migration {
+
+	migrations := []Migration{}
+
+	for migrationIndex := 0; migrationIndex < benchmarkMigrations; migrationIndex++ {
+		tableName := fmt.Sprintf("table_%v", migrationIndex)
+
+		actions := []Action{
+			newAction("addTable", AddTableParams{Name: tableName}),
+			newAction("addColumn", AddColumnParams{Table: tableName, Column: "id", Type: "bigint"}),
+		}
+
+		for len(actions) < benchmarkActionsPerMigration-1 {
+			actions = append(actions, newAction("addColumn", AddColumnParams{
+				Table:      tableName,
+				Column:     fmt.Sprintf("column_%v", len(actions)),
+				Type:       "text",
+				IsNullable: true,
+			}))
+		}
+
+		actions = append(actions, newAction("setPrimaryKey", SetPrimaryKeyParams{Table: tableName, Columns: []string{"id"}}))
+
+		migrations = append(migrations, Migration{
+			SchemaVersion: "1",
+			Id:            fmt.Sprintf("%04d", migrationIndex),
+			Actions:       actions,
+		})
+	}
+
+	return migrations
+}
+
+// setupBenchmarkProject writes generated migrations to a temporary project
+// and makes it the working directory until the benchmark finishes
+func setupBenchmarkProject(b *testing.B) []Migration {
+	b.Helper()
+
+	migrations := getBenchmarkMigrations()
+	setupTestProject(b, migrations)
+	return migrations
+}
+
+// setupTestProject writes migrations to a temporary project and makes it the working directory until the test finishes
+func setupTestProject(tb testing.TB, migrations []Migration) {
+	tb.Helper()
+
+	projectDirectory := tb.TempDir()
+	migrationsDirectory := filepath.Join(projectDirectory, getMigrationsDirectoryName())
+
+	err := os.MkdirAll(migrationsDirectory, 0777)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	for _, migration := range migrations {
+		writeTestMigration(tb, migrationsDirectory, migration)
+	}
+
+	workingDirectory, err := os.Getwd()
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	err = os.Chdir(projectDirectory)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	tb.Cleanup(func() { os.Chdir(workingDirectory) })
+}
+
+func writeTestMigration(tb testing.TB, migrationsDirectory string, migration Migration) {
+	tb.Helper()
+
+	packedMigration, err := json.MarshalIndent(migration, "", "  ")
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(migrationsDirectory, migration.Id+".json"), packedMigration, 0666)
+	if err != nil {
+		tb.Fatal(err)
+	}
+}
+
+func removeSnapshotCache(b *testing.B) {
+	b.Helper()
+
+	cachePath, err := getSnapshotCachePath()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	err = os.Remove(cachePath)
+	if err != nil && !os.IsNotExist(err) {
+		b.Fatal(err)
+	}
+}
+
+// BenchmarkGetCurrentSnapshotCold replays all actions, the cache is removed before every call
+func BenchmarkGetCurrentSnapshotCold(b *testing.B) {
+	setupBenchmarkProject(b)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		removeSnapshotCache(b)
+		b.StartTimer()
+
+		_, err := GetCurrentSnapshot()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkGetCurrentSnapshotWarm takes all migrations from the cache
+func BenchmarkGetCurrentSnapshotWarm(b *testing.B) {
+	setupBenchmarkProject(b)
+
+	_, err := GetCurrentSnapshot()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := GetCurrentSnapshot()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkGetCurrentSnapshotAppend replays only the action appended to the last migration before every call
+func BenchmarkGetCurrentSnapshotAppend(b *testing.B) {
+	migrations := setupBenchmarkProject(b)
+
+	migrationsDirectory, err := GetMigrationsDirectoryPath()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	_, err = GetCurrentSnapshot()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	lastMigration := migrations[len(migrations)-1]
+	tableName := fmt.Sprintf("table_%v", len(migrations)-1)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		lastMigration.Actions = append(lastMigration.Actions, newAction("addColumn", AddColumnParams{
+			Table:      tableName,
+			Column:     fmt.Sprintf("appended_%v", i),
+			Type:       "text",
+			IsNullable: true,
+		}))
+		writeTestMigration(b, migrationsDirectory, lastMigration)
+		b.StartTimer()
+
+		_, err := GetCurrentSnapshot()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkSyncInMemory applies all actions the way Sync does, statements are
+// recorded instead of executed, so only the snapshot work is measured
+func BenchmarkSyncInMemory(b *testing.B) {
+	migrations := getBenchmarkMigrations()
+	ignoreProgress := func(event ProgressEvent) {}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		snapshot := newSnapshot()
+
+		for _, migration := range migrations {
+			err := applyMigrationActions(&sqlRecorder{}, snapshot, migration, 0, len(migration.Actions), ignoreProgress)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
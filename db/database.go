@@ -0,0 +1,36 @@
+package db
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+)
+
+// selectedDatabase is the named database of the project used by migration
+// functions, its migrations are in migrations/<name>. The default database
+// has an empty name and keeps migrations in migrations/ directly.
+var selectedDatabase = ""
+
+var databaseNamePattern = regexp.MustCompile("^[a-zA-Z0-9_-]+$")
+
+func SelectDatabase(name string) error {
+	if name != "" && !databaseNamePattern.MatchString(name) {
+		return fmt.Errorf("wrong database name '%v', use letters, digits, '_' and '-'", name)
+	}
+
+	selectedDatabase = name
+	return nil
+}
+
+func GetSelectedDatabase() string {
+	return selectedDatabase
+}
+
+// getMigrationsDirectoryName returns the directory of migrations relative to the project
+func getMigrationsDirectoryName() string {
+	if selectedDatabase == "" {
+		return migrationsDirectoryName
+	}
+
+	return path.Join(migrationsDirectoryName, selectedDatabase)
+}
@@ -0,0 +1,154 @@
+// Package dbtest runs project migrations against a throwaway Postgres schema
+// so that tests can use the real database structure.
+package dbtest
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akaumov/cubes/db"
+)
+
+const projectConfigFileName = "project.json"
+const migrationsDirectoryName = "migrations"
+
+// Open creates a new schema in the database of dsn, applies all project
+// migrations to it the same way as db.Sync does and checks that the result
+// matches the snapshot of migrations. The returned connection uses the new
+// schema as search path, the schema is dropped when the test finishes.
+func Open(t testing.TB, dsn string) *sql.DB {
+	t.Helper()
+
+	migrationsDirectory, err := findMigrationsDirectory()
+	if err != nil {
+		t.Fatalf("dbtest: %v", err)
+	}
+
+	return OpenWithMigrations(t, dsn, migrationsDirectory)
+}
+
+// OpenDatabase works as Open for a named database of the project with migrations in migrations/<database>
+func OpenDatabase(t testing.TB, dsn string, database string) *sql.DB {
+	t.Helper()
+
+	migrationsDirectory, err := findMigrationsDirectory()
+	if err != nil {
+		t.Fatalf("dbtest: %v", err)
+	}
+
+	return OpenWithMigrations(t, dsn, filepath.Join(migrationsDirectory, database))
+}
+
+// OpenWithMigrations works as Open but reads migrations from migrationsDirectory
+func OpenWithMigrations(t testing.TB, dsn string, migrationsDirectory string) *sql.DB {
+	t.Helper()
+
+	migrations, err := db.GetListFromDirectory(migrationsDirectory)
+	if err != nil {
+		t.Fatalf("dbtest: can't read migrations: %v", err)
+	}
+
+	adminDb, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("dbtest: can't connect to db: %v", err)
+	}
+
+	schema := fmt.Sprintf("cubes_test_%v_%v", os.Getpid(), time.Now().UnixNano())
+
+	_, err = adminDb.Exec(fmt.Sprintf(`CREATE SCHEMA "%v"`, schema))
+	if err != nil {
+		adminDb.Close()
+		t.Fatalf("dbtest: can't create schema: %v", err)
+	}
+
+	testDb, err := sql.Open("postgres", withSearchPath(dsn, schema))
+	if err != nil {
+		dropSchema(t, adminDb, schema)
+		t.Fatalf("dbtest: can't connect to db: %v", err)
+	}
+
+	t.Cleanup(func() {
+		testDb.Close()
+		dropSchema(t, adminDb, schema)
+	})
+
+	err = db.SyncMigrations(testDb, *migrations, db.SyncOptions{
+		Transaction: db.TransactionPerMigration,
+		LockName:    schema,
+	})
+	if err != nil {
+		t.Fatalf("dbtest: can't apply migrations: %v", err)
+	}
+
+	actions := []db.Action{}
+	for _, migration := range *migrations {
+		actions = append(actions, migration.Actions...)
+	}
+
+	expected, err := db.GetSnapshot(actions)
+	if err != nil {
+		t.Fatalf("dbtest: can't build snapshot: %v", err)
+	}
+
+	actual, err := db.InspectSnapshot(testDb)
+	if err != nil {
+		t.Fatalf("dbtest: can't inspect schema: %v", err)
+	}
+
+	differences := db.CompareSnapshots(expected, actual)
+	if len(differences) > 0 {
+		t.Fatalf("dbtest: schema doesn't match migrations snapshot:\n%v", strings.Join(differences, "\n"))
+	}
+
+	return testDb
+}
+
+func dropSchema(t testing.TB, adminDb *sql.DB, schema string) {
+	_, err := adminDb.Exec(fmt.Sprintf(`DROP SCHEMA "%v" CASCADE`, schema))
+	if err != nil {
+		t.Errorf("dbtest: can't drop schema %v: %v", schema, err)
+	}
+
+	adminDb.Close()
+}
+
+func withSearchPath(dsn string, schema string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		separator := "?"
+		if strings.Contains(dsn, "?") {
+			separator = "&"
+		}
+
+		return dsn + separator + "search_path=" + schema
+	}
+
+	return dsn + " search_path=" + schema
+}
+
+// findMigrationsDirectory looks for the project root in the working directory
+// and its parents, go test runs in the directory of the tested package
+func findMigrationsDirectory() (string, error) {
+	directory, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		_, err := os.Stat(filepath.Join(directory, projectConfigFileName))
+		if err == nil {
+			return filepath.Join(directory, migrationsDirectoryName), nil
+		}
+
+		parent := filepath.Dir(directory)
+		if parent == directory {
+			return "", fmt.Errorf("can't find %v in working directory or its parents", projectConfigFileName)
+		}
+
+		directory = parent
+	}
+}
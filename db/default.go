@@ -0,0 +1,261 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{12}$`)
+
+var integerTypes = map[string]bool{
+	"smallint": true,
+	"integer":  true,
+	"bigint":   true,
+}
+
+var floatTypes = map[string]bool{
+	"real":             true,
+	"double precision": true,
+	"numeric":          true,
+}
+
+var decimalPattern = regexp.MustCompile(`^[+-]?([0-9]+(\.[0-9]*)?|\.[0-9]+)([eE][+-]?[0-9]+)?$`)
+var typeModifiersPattern = regexp.MustCompile(`\(\s*([0-9]+)\s*(?:,\s*([0-9]+)\s*)?\)`)
+
+// Special values of float and numeric columns, they are written as quoted typed literals
+var specialFloatLiterals = map[string]string{
+	"nan":       "NaN",
+	"infinity":  "Infinity",
+	"+infinity": "Infinity",
+	"inf":       "Infinity",
+	"+inf":      "Infinity",
+	"-infinity": "-Infinity",
+	"-inf":      "-Infinity",
+}
+
+// Postgres limits of numeric digits before and after the decimal point
+const maxNumericIntegerDigits = 131072
+const maxNumericFractionDigits = 16383
+
+var trueLiterals = map[string]bool{"true": true, "t": true, "yes": true, "y": true, "on": true, "1": true}
+var falseLiterals = map[string]bool{"false": true, "f": true, "no": true, "n": true, "off": true, "0": true}
+
+// checkDefault checks that a literal default can be stored in a column of columnType,
+// expressions are checked by the database only
+func checkDefault(columnType string, defaultValue *Default) error {
+
+	if defaultValue == nil {
+		return nil
+	}
+
+	switch defaultValue.Kind {
+	case DefaultExpression:
+		if strings.TrimSpace(defaultValue.Value) == "" {
+			return fmt.Errorf("default expression is empty")
+		}
+
+		return nil
+	case DefaultLiteral:
+		break
+	default:
+		return fmt.Errorf("wrong default kind '%v', expected '%v' or '%v'", defaultValue.Kind, DefaultLiteral, DefaultExpression)
+	}
+
+	normalizedType := NormalizeColumnType(columnType)
+	value := strings.TrimSpace(defaultValue.Value)
+
+	if strings.HasSuffix(normalizedType, "[]") {
+		return nil
+	}
+
+	if integerTypes[normalizedType] {
+		bitSize := 64
+		if normalizedType == "smallint" {
+			bitSize = 16
+		} else if normalizedType == "integer" {
+			bitSize = 32
+		}
+
+		_, err := strconv.ParseInt(value, 10, bitSize)
+		if err != nil {
+			return fmt.Errorf("'%v' is not a valid %v", defaultValue.Value, normalizedType)
+		}
+
+		return nil
+	}
+
+	if floatTypes[normalizedType] {
+		err := checkFloatDefault(columnType, normalizedType, value)
+		if err != nil {
+			return fmt.Errorf("'%v' is not a valid %v: %v", defaultValue.Value, normalizedType, err)
+		}
+
+		return nil
+	}
+
+	switch normalizedType {
+	case "boolean":
+		lowerValue := strings.ToLower(value)
+		if !trueLiterals[lowerValue] && !falseLiterals[lowerValue] {
+			return fmt.Errorf("'%v' is not a valid boolean", defaultValue.Value)
+		}
+		break
+	case "uuid":
+		if !uuidPattern.MatchString(value) {
+			return fmt.Errorf("'%v' is not a valid uuid", defaultValue.Value)
+		}
+		break
+	case "json", "jsonb":
+		if !json.Valid([]byte(defaultValue.Value)) {
+			return fmt.Errorf("'%v' is not a valid json", defaultValue.Value)
+		}
+		break
+	}
+
+	return nil
+}
+
+// checkFloatDefault accepts decimal numbers and special values, numeric values
+// are checked by limits of Postgres and by precision and scale of the type
+func checkFloatDefault(columnType string, normalizedType string, value string) error {
+
+	if specialValue, ok := specialFloatLiterals[strings.ToLower(value)]; ok {
+		if normalizedType == "numeric" && specialValue != "NaN" && typeModifiersPattern.MatchString(columnType) {
+			return fmt.Errorf("numeric with precision can't be infinite")
+		}
+
+		return nil
+	}
+
+	if !decimalPattern.MatchString(value) {
+		return fmt.Errorf("decimal number is expected")
+	}
+
+	switch normalizedType {
+	case "real":
+		_, err := strconv.ParseFloat(value, 32)
+		if err != nil {
+			return fmt.Errorf("out of range")
+		}
+	case "double precision":
+		_, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("out of range")
+		}
+	case "numeric":
+		return checkNumericDigits(columnType, value)
+	}
+
+	return nil
+}
+
+func checkNumericDigits(columnType string, value string) error {
+
+	mantissa := strings.TrimLeft(value, "+-")
+	exponent := 0
+
+	if exponentIndex := strings.IndexAny(mantissa, "eE"); exponentIndex >= 0 {
+		parsedExponent, err := strconv.Atoi(mantissa[exponentIndex+1:])
+		if err != nil {
+			return fmt.Errorf("out of range")
+		}
+
+		exponent = parsedExponent
+		mantissa = mantissa[:exponentIndex]
+	}
+
+	integerPart := mantissa
+	fractionPart := ""
+	if pointIndex := strings.Index(mantissa, "."); pointIndex >= 0 {
+		integerPart = mantissa[:pointIndex]
+		fractionPart = mantissa[pointIndex+1:]
+	}
+
+	integerPart = strings.TrimLeft(integerPart, "0")
+	fractionPart = strings.TrimRight(fractionPart, "0")
+
+	// The exponent moves the decimal point, zero values don't have integer digits
+	integerDigits := 0
+	if integerPart != "" || fractionPart != "" {
+		integerDigits = len(integerPart) + exponent
+		if integerPart == "" {
+			integerDigits = exponent - (len(fractionPart) - len(strings.TrimLeft(fractionPart, "0")))
+		}
+	}
+
+	fractionDigits := len(fractionPart) - exponent
+	if fractionDigits < 0 {
+		fractionDigits = 0
+	}
+
+	if integerDigits > maxNumericIntegerDigits || fractionDigits > maxNumericFractionDigits {
+		return fmt.Errorf("out of range")
+	}
+
+	modifiers := typeModifiersPattern.FindStringSubmatch(columnType)
+	if modifiers == nil {
+		return nil
+	}
+
+	precision, _ := strconv.Atoi(modifiers[1])
+	scale := 0
+	if modifiers[2] != "" {
+		scale, _ = strconv.Atoi(modifiers[2])
+	}
+
+	// Fraction digits are rounded to the scale, integer digits should fit the rest of the precision
+	if integerDigits > precision-scale {
+		return fmt.Errorf("more than %v digits before the decimal point", precision-scale)
+	}
+
+	return nil
+}
+
+// formatDefault returns the default as SQL, literals are escaped for the column type
+func formatDefault(columnType string, defaultValue *Default) (string, error) {
+
+	err := checkDefault(columnType, defaultValue)
+	if err != nil {
+		return "", err
+	}
+
+	if defaultValue.Kind == DefaultExpression {
+		return defaultValue.Value, nil
+	}
+
+	normalizedType := NormalizeColumnType(columnType)
+	value := strings.TrimSpace(defaultValue.Value)
+
+	if floatTypes[normalizedType] {
+		if specialValue, ok := specialFloatLiterals[strings.ToLower(value)]; ok {
+			return quoteLiteral(specialValue) + "::" + normalizedType, nil
+		}
+
+		return value, nil
+	}
+
+	if integerTypes[normalizedType] {
+		return value, nil
+	}
+
+	if normalizedType == "boolean" {
+		if trueLiterals[strings.ToLower(value)] {
+			return "TRUE", nil
+		}
+
+		return "FALSE", nil
+	}
+
+	return quoteLiteral(defaultValue.Value), nil
+}
+
+func quoteLiteral(value string) string {
+	return "'" + strings.Replace(value, "'", "''", -1) + "'"
+}
+
+func quoteIdentifier(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
@@ -0,0 +1,85 @@
+package db
+
+import (
+	"testing"
+)
+
+func TestCheckDefault(t *testing.T) {
+
+	tests := []struct {
+		columnType string
+		kind       DefaultKind
+		value      string
+		isValid    bool
+	}{
+		{"smallint", DefaultLiteral, "32767", true},
+		{"smallint", DefaultLiteral, "32768", false},
+		{"int4", DefaultLiteral, "-2147483648", true},
+		{"integer", DefaultLiteral, "2147483648", false},
+		{"bigint", DefaultLiteral, " 42 ", true},
+		{"bigint", DefaultLiteral, "0x10", false},
+		{"integer", DefaultLiteral, "1.5", false},
+		{"real", DefaultLiteral, "1e39", false},
+		{"double precision", DefaultLiteral, "-Infinity", true},
+		{"float8", DefaultLiteral, "nan", true},
+		{"double precision", DefaultLiteral, "0x1p-2", false},
+		{"numeric", DefaultLiteral, "Infinity", true},
+		{"numeric(10,2)", DefaultLiteral, "Infinity", false},
+		{"numeric(10,2)", DefaultLiteral, "NaN", true},
+		{"numeric(5,2)", DefaultLiteral, "999.999", true},
+		{"numeric(5,2)", DefaultLiteral, "1000", false},
+		{"numeric(5,2)", DefaultLiteral, "1.5e2", true},
+		{"numeric(5,2)", DefaultLiteral, "1.5e3", false},
+		{"decimal(3)", DefaultLiteral, "0.0001", true},
+		{"boolean", DefaultLiteral, "Yes", true},
+		{"bool", DefaultLiteral, "maybe", false},
+		{"uuid", DefaultLiteral, "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11", true},
+		{"uuid", DefaultLiteral, "a0eebc99", false},
+		{"jsonb", DefaultLiteral, `{"key": [1, 2]}`, true},
+		{"json", DefaultLiteral, `{key: 1}`, false},
+		{"integer[]", DefaultLiteral, "{1,2}", true},
+		{"text", DefaultLiteral, "it's", true},
+		{"integer", DefaultExpression, "nextval('seq')", true},
+		{"timestamptz", DefaultExpression, " ", false},
+		{"text", DefaultKind("value"), "text", false},
+	}
+
+	for _, test := range tests {
+		err := checkDefault(test.columnType, &Default{Kind: test.kind, Value: test.value})
+		if (err == nil) != test.isValid {
+			t.Errorf("checkDefault(%q, %v %q) returned %v, expected valid: %v", test.columnType, test.kind, test.value, err, test.isValid)
+		}
+	}
+}
+
+func TestFormatDefault(t *testing.T) {
+
+	tests := []struct {
+		columnType string
+		kind       DefaultKind
+		value      string
+		expected   string
+	}{
+		{"integer", DefaultLiteral, " 42 ", "42"},
+		{"numeric(10,2)", DefaultLiteral, "1.50", "1.50"},
+		{"float8", DefaultLiteral, "-inf", "'-Infinity'::double precision"},
+		{"numeric", DefaultLiteral, "NaN", "'NaN'::numeric"},
+		{"boolean", DefaultLiteral, "on", "TRUE"},
+		{"boolean", DefaultLiteral, "0", "FALSE"},
+		{"text", DefaultLiteral, "it's", "'it''s'"},
+		{"jsonb", DefaultLiteral, `{"key": 1}`, `'{"key": 1}'`},
+		{"timestamptz", DefaultExpression, "now()", "now()"},
+	}
+
+	for _, test := range tests {
+		actual, err := formatDefault(test.columnType, &Default{Kind: test.kind, Value: test.value})
+		if err != nil {
+			t.Errorf("formatDefault(%q, %v %q) returned error: %v", test.columnType, test.kind, test.value, err)
+			continue
+		}
+
+		if actual != test.expected {
+			t.Errorf("formatDefault(%q, %v %q) = %q, expected %q", test.columnType, test.kind, test.value, actual, test.expected)
+		}
+	}
+}
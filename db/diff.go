@@ -0,0 +1,282 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+)
+
+type SchemaChangeType string
+
+const (
+	SchemaAdded   = SchemaChangeType("added")
+	SchemaRemoved = SchemaChangeType("removed")
+	SchemaChanged = SchemaChangeType("changed")
+)
+
+// SchemaChange is one element of the structural diff of two snapshots,
+// Before and After are human-readable definitions of the element
+type SchemaChange struct {
+	Kind   string           `json:"kind"`
+	Change SchemaChangeType `json:"change"`
+	Table  string           `json:"table,omitempty"`
+	Name   string           `json:"name"`
+	Before string           `json:"before,omitempty"`
+	After  string           `json:"after,omitempty"`
+}
+
+func (c SchemaChange) String() string {
+	name := c.Name
+	if c.Table != "" && c.Kind != "table" {
+		name = c.Table + "." + c.Name
+	}
+
+	switch c.Change {
+	case SchemaAdded:
+		return strings.TrimSuffix(fmt.Sprintf("+ %v %v: %v", c.Kind, name, c.After), ": ")
+	case SchemaRemoved:
+		return strings.TrimSuffix(fmt.Sprintf("- %v %v: %v", c.Kind, name, c.Before), ": ")
+	}
+
+	return fmt.Sprintf("~ %v %v: '%v' -> '%v'", c.Kind, name, c.Before, c.After)
+}
+
+func runGit(args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+
+	command := exec.Command("git", args...)
+	command.Stderr = &stderr
+
+	output, err := command.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %v: %v %v", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+
+	return output, nil
+}
+
+// GetListAtRevision reads migrations of the project from git without checking the revision out
+func GetListAtRevision(revision string) (*[]Migration, error) {
+
+	output, err := runGit("ls-tree", "--name-only", revision, "--", getMigrationsDirectoryName()+"/")
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+	for _, file := range strings.Split(string(output), "\n") {
+		if isMigrationFile(file) {
+			files = append(files, file)
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return path.Base(files[i]) < path.Base(files[j])
+	})
+
+	result := []Migration{}
+
+	for _, file := range files {
+		rawMigration, err := runGit("show", revision+":./"+file)
+		if err != nil {
+			return nil, err
+		}
+
+		migration, err := parseMigration(rawMigration)
+		if err != nil {
+			return nil, fmt.Errorf("%v at %v: %v", file, revision, err)
+		}
+
+		result = append(result, *migration)
+	}
+
+	return &result, nil
+}
+
+// GetSnapshotAtRevision builds the snapshot from migrations at the git revision,
+// empty revision means the working directory
+func GetSnapshotAtRevision(revision string) (*Snapshot, error) {
+
+	var migrations *[]Migration
+	var err error
+
+	if revision == "" {
+		migrations, err = GetList()
+	} else {
+		migrations, err = GetListAtRevision(revision)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	actions := []Action{}
+	for _, migration := range *migrations {
+		actions = append(actions, migration.Actions...)
+	}
+
+	return GetSnapshot(actions)
+}
+
+func formatColumnDefinition(column Column) string {
+	definition := column.Type
+
+	if !column.IsNullable {
+		definition += " NOT NULL"
+	}
+
+	columnDefault := formatColumnDefault(column)
+	if columnDefault != "" {
+		definition += " " + columnDefault
+	}
+
+	if column.Comment != "" {
+		definition += fmt.Sprintf(" -- %v", column.Comment)
+	}
+
+	return definition
+}
+
+// diffNamedItems compares definitions of items with the same name, result is sorted by name
+func diffNamedItems(kind string, tableName string, before map[string]string, after map[string]string) []SchemaChange {
+
+	names := []string{}
+	for name := range before {
+		names = append(names, name)
+	}
+
+	for name := range after {
+		if _, ok := before[name]; !ok {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	changes := []SchemaChange{}
+	for _, name := range names {
+		beforeDefinition, isBefore := before[name]
+		afterDefinition, isAfter := after[name]
+
+		change := SchemaChange{Kind: kind, Table: tableName, Name: name, Before: beforeDefinition, After: afterDefinition}
+
+		if !isBefore {
+			change.Change = SchemaAdded
+		} else if !isAfter {
+			change.Change = SchemaRemoved
+		} else if beforeDefinition != afterDefinition {
+			change.Change = SchemaChanged
+		} else {
+			continue
+		}
+
+		changes = append(changes, change)
+	}
+
+	return changes
+}
+
+func getTableDefinitions(table *Table) map[string]map[string]string {
+
+	definitions := map[string]map[string]string{
+		"column":     {},
+		"primaryKey": {},
+		"unique":     {},
+		"index":      {},
+		"relation":   {},
+		"trigger":    {},
+	}
+
+	if table == nil {
+		return definitions
+	}
+
+	for _, column := range table.Columns {
+		definitions["column"][column.Name] = formatColumnDefinition(column)
+	}
+
+	if len(table.PrimaryKeys) > 0 {
+		definitions["primaryKey"][table.PrimaryKeyName] = "(" + joinColumnNames(table.PrimaryKeys) + ")"
+	}
+
+	for _, constraint := range table.UniqueConstraints {
+		definitions["unique"][constraint.Name] = "(" + strings.Join(constraint.Columns, ", ") + ")"
+	}
+
+	for _, index := range table.Indexes {
+		definitions["index"][index.Name] = formatIndex(index)
+	}
+
+	for _, relation := range table.Relations {
+		definitions["relation"][relation.Name] = string(relation.Type) + " " + formatRelation(relation)
+	}
+
+	if table.UpdatedAtColumn != "" {
+		definitions["trigger"][updatedAtTriggerName] = "updated at (" + table.UpdatedAtColumn + ")"
+	}
+
+	if table.NotifyChannel != "" {
+		definitions["trigger"][notifyTriggerName] = "notify (" + table.NotifyChannel + ")"
+	}
+
+	if table.AuditTable != "" {
+		definitions["trigger"][auditTriggerName] = "audit (" + table.AuditTable + ")"
+	}
+
+	return definitions
+}
+
+// DiffSchemas returns the structural diff of tables, columns, keys,
+// constraints, indexes, relations, triggers and sequences
+func DiffSchemas(before *Snapshot, after *Snapshot) []SchemaChange {
+
+	tableDefinitions := func(snapshot *Snapshot) map[string]string {
+		definitions := map[string]string{}
+		for _, table := range snapshot.Tables {
+			definitions[table.Name] = table.Comment
+		}
+		return definitions
+	}
+
+	changes := diffNamedItems("table", "", tableDefinitions(before), tableDefinitions(after))
+	for index := range changes {
+		changes[index].Table = changes[index].Name
+	}
+
+	tableNames := map[string]bool{}
+	for _, table := range before.Tables {
+		tableNames[table.Name] = true
+	}
+	for _, table := range after.Tables {
+		tableNames[table.Name] = true
+	}
+
+	sortedTableNames := []string{}
+	for name := range tableNames {
+		sortedTableNames = append(sortedTableNames, name)
+	}
+	sort.Strings(sortedTableNames)
+
+	for _, tableName := range sortedTableNames {
+		beforeDefinitions := getTableDefinitions(getTableFromSnapshot(before, tableName))
+		afterDefinitions := getTableDefinitions(getTableFromSnapshot(after, tableName))
+
+		for _, kind := range []string{"column", "primaryKey", "unique", "index", "relation", "trigger"} {
+			changes = append(changes, diffNamedItems(kind, tableName, beforeDefinitions[kind], afterDefinitions[kind])...)
+		}
+	}
+
+	sequenceDefinitions := func(snapshot *Snapshot) map[string]string {
+		definitions := map[string]string{}
+		for _, sequence := range snapshot.Sequences {
+			definitions[sequence.Name] = strings.TrimSpace(sequence.Type + " " + formatSequenceOptions(sequence.SequenceOptions))
+		}
+		return definitions
+	}
+
+	changes = append(changes, diffNamedItems("sequence", "", sequenceDefinitions(before), sequenceDefinitions(after))...)
+	return changes
+}
@@ -0,0 +1,547 @@
+package db
+
+import (
+	"fmt"
+	"html"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type DocsFormat string
+
+const (
+	DocsMarkdown = DocsFormat("markdown")
+	DocsHtml     = DocsFormat("html")
+)
+
+type docsCell struct {
+	Text string
+	Link string
+}
+
+type docsSection struct {
+	Title   string
+	Headers []string
+	Rows    [][]docsCell
+}
+
+// docsPage is rendered to markdown or html, so both formats have the same content
+type docsPage struct {
+	FileName    string
+	Title       string
+	Description string
+	Sections    []docsSection
+}
+
+// schemaHistory keeps the id of the migration which last changed every element of the schema
+type schemaHistory map[string]string
+
+func getTableHistoryKey(table string) string {
+	return "table:" + table
+}
+
+func getTableElementHistoryKey(kind string, table string, name string) string {
+	return kind + ":" + table + "." + name
+}
+
+func getSequenceHistoryKey(sequence string) string {
+	return "sequence:" + sequence
+}
+
+// renameTable moves history of elements of the table to the new table name
+func (h schemaHistory) renameTable(name string, newName string) {
+	renamed := schemaHistory{}
+	for key, migrationId := range h {
+		separatorIndex := strings.Index(key, ":")
+		if separatorIndex < 0 || !strings.HasPrefix(key[separatorIndex+1:], name+".") {
+			continue
+		}
+
+		kind := key[:separatorIndex]
+		elementName := key[separatorIndex+1+len(name)+1:]
+		renamed[getTableElementHistoryKey(kind, newName, elementName)] = migrationId
+		delete(h, key)
+	}
+
+	for key, migrationId := range renamed {
+		h[key] = migrationId
+	}
+}
+
+// renameColumn moves history of the column to the new column name
+func (h schemaHistory) renameColumn(table string, column string, newName string) {
+	key := getTableElementHistoryKey("column", table, column)
+	migrationId, ok := h[key]
+	if !ok {
+		return
+	}
+
+	delete(h, key)
+	h[getTableElementHistoryKey("column", table, newName)] = migrationId
+}
+
+// getActionHistoryKeys returns elements changed by the action, every change of a table element changes the table too
+func getActionHistoryKeys(method string, params interface{}) []string {
+
+	switch method {
+	case "addTable":
+		return []string{getTableHistoryKey(params.(AddTableParams).Name)}
+	case "deleteTable":
+		return []string{getTableHistoryKey(params.(DeleteTableParams).Name)}
+	case "setTableComment":
+		return []string{getTableHistoryKey(params.(SetTableCommentParams).Table)}
+	case "setColumnComment":
+		p := params.(SetColumnCommentParams)
+		return []string{getTableHistoryKey(p.Table), getTableElementHistoryKey("column", p.Table, p.Column)}
+	case "addColumn":
+		p := params.(AddColumnParams)
+		return []string{getTableHistoryKey(p.Table), getTableElementHistoryKey("column", p.Table, p.Column)}
+	case "deleteColumn":
+		p := params.(DeleteColumnParams)
+		return []string{getTableHistoryKey(p.Table), getTableElementHistoryKey("column", p.Table, p.Column)}
+	case "renameTable":
+		return []string{getTableHistoryKey(params.(RenameTableParams).NewName)}
+	case "renameColumn":
+		p := params.(RenameColumnParams)
+		return []string{getTableHistoryKey(p.Table), getTableElementHistoryKey("column", p.Table, p.NewName)}
+	case "addSequence":
+		return []string{getSequenceHistoryKey(params.(AddSequenceParams).Name)}
+	case "deleteSequence":
+		return []string{getSequenceHistoryKey(params.(DeleteSequenceParams).Name)}
+	case "addPrimaryKey":
+		p := params.(AddPrimaryKeyParams)
+		return []string{getTableHistoryKey(p.Table), getTableElementHistoryKey("primaryKey", p.Table, "")}
+	case "deletePrimaryKey":
+		p := params.(DeletePrimaryKeyParams)
+		return []string{getTableHistoryKey(p.Table), getTableElementHistoryKey("primaryKey", p.Table, "")}
+	case "setPrimaryKey":
+		p := params.(SetPrimaryKeyParams)
+		return []string{getTableHistoryKey(p.Table), getTableElementHistoryKey("primaryKey", p.Table, "")}
+	case "dropPrimaryKey":
+		p := params.(DropPrimaryKeyParams)
+		return []string{getTableHistoryKey(p.Table), getTableElementHistoryKey("primaryKey", p.Table, "")}
+	case "addRelation":
+		p := params.(AddRelationParams)
+		return []string{getTableHistoryKey(p.Table), getTableElementHistoryKey("relation", p.Table, p.Name)}
+	case "deleteRelation":
+		p := params.(DeleteRelationParams)
+		return []string{getTableHistoryKey(p.Table), getTableElementHistoryKey("relation", p.Table, p.Name)}
+	case "addUniqueConstraint":
+		p := params.(AddUniqueConstraintParams)
+		return []string{getTableHistoryKey(p.Table), getTableElementHistoryKey("unique", p.Table, p.Name)}
+	case "deleteUniqueConstraint":
+		p := params.(DeleteUniqueConstraintParams)
+		return []string{getTableHistoryKey(p.Table), getTableElementHistoryKey("unique", p.Table, p.Name)}
+	case "addIndex":
+		p := params.(AddIndexParams)
+		return []string{getTableHistoryKey(p.Table), getTableElementHistoryKey("index", p.Table, p.Name)}
+	case "deleteIndex":
+		p := params.(DeleteIndexParams)
+		return []string{getTableHistoryKey(p.Table), getTableElementHistoryKey("index", p.Table, p.Name)}
+	case "setUpdatedAtTrigger":
+		return []string{getTableHistoryKey(params.(SetUpdatedAtTriggerParams).Table)}
+	case "dropUpdatedAtTrigger":
+		return []string{getTableHistoryKey(params.(DropUpdatedAtTriggerParams).Table)}
+	case "setChangeNotify":
+		return []string{getTableHistoryKey(params.(SetChangeNotifyParams).Table)}
+	case "dropChangeNotify":
+		return []string{getTableHistoryKey(params.(DropChangeNotifyParams).Table)}
+	case "enableAudit":
+		enableAuditParams := params.(EnableAuditParams)
+		return []string{getTableHistoryKey(enableAuditParams.Table), getTableHistoryKey(enableAuditParams.HistoryTable)}
+	case "disableAudit":
+		return []string{getTableHistoryKey(params.(DisableAuditParams).Table)}
+	}
+
+	return []string{}
+}
+
+// getSchemaHistory replays migrations and returns the resulting snapshot with the history of its elements
+func getSchemaHistory(migrations []Migration) (*Snapshot, schemaHistory, error) {
+
+	snapshot := newSnapshot()
+	history := schemaHistory{}
+
+	for _, migration := range migrations {
+		for _, action := range migration.Actions {
+			method, params, err := decodeAction(action.Method, action.Params)
+			if err != nil {
+				return nil, nil, fmt.Errorf("can't decode action %v\n", err)
+			}
+
+			err = applyActionsToSnapshot(snapshot, []Action{action})
+			if err != nil {
+				return nil, nil, fmt.Errorf("can't apply migration %v: %v", migration.Id, err)
+			}
+
+			if method == "renameTable" {
+				renameTableParams := params.(RenameTableParams)
+				history.renameTable(renameTableParams.Name, renameTableParams.NewName)
+			}
+
+			if method == "renameColumn" {
+				renameColumnParams := params.(RenameColumnParams)
+				history.renameColumn(renameColumnParams.Table, renameColumnParams.Column, renameColumnParams.NewName)
+			}
+
+			for _, key := range getActionHistoryKeys(method, params) {
+				history[key] = migration.Id
+			}
+		}
+	}
+
+	return snapshot, history, nil
+}
+
+// GenerateDocs writes one page per table of the current schema and an index page into outDirectory
+func GenerateDocs(outDirectory string, format DocsFormat) ([]string, error) {
+
+	if format == "" {
+		format = DocsMarkdown
+	}
+
+	if format != DocsMarkdown && format != DocsHtml {
+		return nil, fmt.Errorf("wrong docs format '%v', expected '%v' or '%v'", format, DocsMarkdown, DocsHtml)
+	}
+
+	migrations, err := GetList()
+	if err != nil {
+		return nil, fmt.Errorf("can't read migrations: %v", err)
+	}
+
+	snapshot, history, err := getSchemaHistory(*migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(outDirectory, 0777)
+	if err != nil {
+		return nil, err
+	}
+
+	pages := []docsPage{getIndexDocsPage(snapshot, history, format)}
+	for _, table := range snapshot.Tables {
+		pages = append(pages, getTableDocsPage(snapshot, &table, history, format))
+	}
+
+	files := []string{}
+	for _, page := range pages {
+		var content string
+		if format == DocsHtml {
+			content = renderDocsPageToHtml(page)
+		} else {
+			content = renderDocsPageToMarkdown(page)
+		}
+
+		pagePath := filepath.Join(outDirectory, page.FileName)
+		err = ioutil.WriteFile(pagePath, []byte(content), 0666)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, pagePath)
+	}
+
+	return files, nil
+}
+
+func getDocsFileName(name string, format DocsFormat) string {
+	if format == DocsHtml {
+		return name + ".html"
+	}
+
+	return name + ".md"
+}
+
+// getTableDocsFileName prefixes pages of tables, so a table named index doesn't replace the index page
+func getTableDocsFileName(table string, format DocsFormat) string {
+	return getDocsFileName("table_"+table, format)
+}
+
+func getTableDocsLink(table string, format DocsFormat) docsCell {
+	return docsCell{Text: table, Link: getTableDocsFileName(table, format)}
+}
+
+func getIndexDocsPage(snapshot *Snapshot, history schemaHistory, format DocsFormat) docsPage {
+
+	tables := docsSection{
+		Title:   "Tables",
+		Headers: []string{"Table", "Description", "Last changed"},
+	}
+
+	for _, table := range snapshot.Tables {
+		tables.Rows = append(tables.Rows, []docsCell{
+			getTableDocsLink(table.Name, format),
+			{Text: table.Comment},
+			{Text: history[getTableHistoryKey(table.Name)]},
+		})
+	}
+
+	page := docsPage{
+		FileName: getDocsFileName("index", format),
+		Title:    "Schema",
+		Sections: []docsSection{tables},
+	}
+
+	if len(snapshot.Sequences) > 0 {
+		sequences := docsSection{
+			Title:   "Sequences",
+			Headers: []string{"Sequence", "Type", "Options", "Last changed"},
+		}
+
+		for _, sequence := range snapshot.Sequences {
+			sequences.Rows = append(sequences.Rows, []docsCell{
+				{Text: sequence.Name},
+				{Text: sequence.Type},
+				{Text: strings.TrimSpace(formatSequenceOptions(sequence.SequenceOptions))},
+				{Text: history[getSequenceHistoryKey(sequence.Name)]},
+			})
+		}
+
+		page.Sections = append(page.Sections, sequences)
+	}
+
+	return page
+}
+
+func formatColumnDefault(column Column) string {
+
+	if column.Identity != nil {
+		return "identity " + formatIdentity(column.Identity)
+	}
+
+	if column.Generated != "" {
+		return "generated as " + column.Generated
+	}
+
+	if column.Default == nil {
+		return ""
+	}
+
+	formattedDefault, err := formatDefault(column.Type, column.Default)
+	if err != nil {
+		return column.Default.Value
+	}
+
+	return formattedDefault
+}
+
+func getTableDocsPage(snapshot *Snapshot, table *Table, history schemaHistory, format DocsFormat) docsPage {
+
+	page := docsPage{
+		FileName:    getTableDocsFileName(table.Name, format),
+		Title:       table.Name,
+		Description: table.Comment,
+	}
+
+	columns := docsSection{
+		Title:   "Columns",
+		Headers: []string{"Column", "Type", "Nullable", "Default", "Description", "Last changed"},
+	}
+
+	for _, column := range table.Columns {
+		nullable := "no"
+		if column.IsNullable {
+			nullable = "yes"
+		}
+
+		columns.Rows = append(columns.Rows, []docsCell{
+			{Text: column.Name},
+			{Text: column.Type},
+			{Text: nullable},
+			{Text: formatColumnDefault(column)},
+			{Text: column.Comment},
+			{Text: history[getTableElementHistoryKey("column", table.Name, column.Name)]},
+		})
+	}
+
+	page.Sections = append(page.Sections, columns)
+
+	keys := docsSection{
+		Title:   "Keys and constraints",
+		Headers: []string{"Name", "Kind", "Columns", "Last changed"},
+	}
+
+	if len(table.PrimaryKeys) > 0 {
+		keys.Rows = append(keys.Rows, []docsCell{
+			{Text: table.PrimaryKeyName},
+			{Text: "primary key"},
+			{Text: joinColumnNames(table.PrimaryKeys)},
+			{Text: history[getTableElementHistoryKey("primaryKey", table.Name, "")]},
+		})
+	}
+
+	for _, constraint := range table.UniqueConstraints {
+		keys.Rows = append(keys.Rows, []docsCell{
+			{Text: constraint.Name},
+			{Text: "unique"},
+			{Text: strings.Join(constraint.Columns, ", ")},
+			{Text: history[getTableElementHistoryKey("unique", table.Name, constraint.Name)]},
+		})
+	}
+
+	for _, index := range table.Indexes {
+		kind := "index"
+		if index.IsUnique {
+			kind = "unique index"
+		}
+
+		keys.Rows = append(keys.Rows, []docsCell{
+			{Text: index.Name},
+			{Text: kind},
+			{Text: strings.Join(index.Columns, ", ")},
+			{Text: history[getTableElementHistoryKey("index", table.Name, index.Name)]},
+		})
+	}
+
+	if len(keys.Rows) > 0 {
+		page.Sections = append(page.Sections, keys)
+	}
+
+	outbound := docsSection{
+		Title:   "Relations",
+		Headers: []string{"Name", "Type", "Columns", "Table", "Remote columns", "Last changed"},
+	}
+
+	for _, relation := range table.Relations {
+		columns, remoteColumns := getRelationColumns(relation)
+
+		outbound.Rows = append(outbound.Rows, []docsCell{
+			{Text: relation.Name},
+			{Text: string(relation.Type)},
+			{Text: columns},
+			getTableDocsLink(relation.RemoteTable, format),
+			{Text: remoteColumns},
+			{Text: history[getTableElementHistoryKey("relation", table.Name, relation.Name)]},
+		})
+	}
+
+	if len(outbound.Rows) > 0 {
+		page.Sections = append(page.Sections, outbound)
+	}
+
+	inbound := docsSection{
+		Title:   "Referenced by",
+		Headers: []string{"Table", "Name", "Type", "Columns", "Remote columns", "Last changed"},
+	}
+
+	for _, remoteTable := range snapshot.Tables {
+		for _, relation := range remoteTable.Relations {
+			if relation.RemoteTable != table.Name {
+				continue
+			}
+
+			columns, remoteColumns := getRelationColumns(relation)
+
+			inbound.Rows = append(inbound.Rows, []docsCell{
+				getTableDocsLink(remoteTable.Name, format),
+				{Text: relation.Name},
+				{Text: string(relation.Type)},
+				{Text: remoteColumns},
+				{Text: columns},
+				{Text: history[getTableElementHistoryKey("relation", remoteTable.Name, relation.Name)]},
+			})
+		}
+	}
+
+	if len(inbound.Rows) > 0 {
+		page.Sections = append(page.Sections, inbound)
+	}
+
+	return page
+}
+
+func getRelationColumns(relation Relation) (string, string) {
+	columns := []string{}
+	remoteColumns := []string{}
+
+	for _, mapping := range relation.ColumnsMapping {
+		columns = append(columns, mapping.Column)
+		remoteColumns = append(remoteColumns, mapping.RemoteColumn)
+	}
+
+	return strings.Join(columns, ", "), strings.Join(remoteColumns, ", ")
+}
+
+func escapeMarkdownCell(text string) string {
+	text = strings.Replace(text, "|", "\\|", -1)
+	return strings.Replace(text, "\n", " ", -1)
+}
+
+func renderDocsPageToMarkdown(page docsPage) string {
+	var builder strings.Builder
+
+	builder.WriteString("# " + page.Title + "\n\n")
+
+	if page.Description != "" {
+		builder.WriteString(page.Description + "\n\n")
+	}
+
+	for _, section := range page.Sections {
+		builder.WriteString("## " + section.Title + "\n\n")
+		builder.WriteString("| " + strings.Join(section.Headers, " | ") + " |\n")
+		builder.WriteString(strings.Repeat("| --- ", len(section.Headers)) + "|\n")
+
+		for _, row := range section.Rows {
+			cells := []string{}
+			for _, cell := range row {
+				text := escapeMarkdownCell(cell.Text)
+				if cell.Link != "" {
+					text = fmt.Sprintf("[%v](%v)", text, cell.Link)
+				}
+
+				cells = append(cells, text)
+			}
+
+			builder.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+		}
+
+		builder.WriteString("\n")
+	}
+
+	return builder.String()
+}
+
+func renderDocsPageToHtml(page docsPage) string {
+	var builder strings.Builder
+
+	builder.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	builder.WriteString("<title>" + html.EscapeString(page.Title) + "</title>\n</head>\n<body>\n")
+	builder.WriteString("<h1>" + html.EscapeString(page.Title) + "</h1>\n")
+
+	if page.Description != "" {
+		builder.WriteString("<p>" + html.EscapeString(page.Description) + "</p>\n")
+	}
+
+	for _, section := range page.Sections {
+		builder.WriteString("<h2>" + html.EscapeString(section.Title) + "</h2>\n<table>\n<tr>")
+
+		for _, header := range section.Headers {
+			builder.WriteString("<th>" + html.EscapeString(header) + "</th>")
+		}
+
+		builder.WriteString("</tr>\n")
+
+		for _, row := range section.Rows {
+			builder.WriteString("<tr>")
+
+			for _, cell := range row {
+				text := html.EscapeString(cell.Text)
+				if cell.Link != "" {
+					text = fmt.Sprintf("<a href=\"%v\">%v</a>", html.EscapeString(cell.Link), text)
+				}
+
+				builder.WriteString("<td>" + text + "</td>")
+			}
+
+			builder.WriteString("</tr>\n")
+		}
+
+		builder.WriteString("</table>\n")
+	}
+
+	builder.WriteString("</body>\n</html>\n")
+	return builder.String()
+}
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"testing"
+)
+
+func TestGetSchemaHistoryRenames(t *testing.T) {
+
+	migrations := []Migration{
+		{Id: "0001", Actions: []Action{
+			newAction("addTable", AddTableParams{Name: "users"}),
+			newAction("addColumn", AddColumnParams{Table: "users", Column: "name", Type: "text"}),
+			newAction("addColumn", AddColumnParams{Table: "users", Column: "email", Type: "text"}),
+		}},
+		{Id: "0002", Actions: []Action{
+			newAction("renameColumn", RenameColumnParams{Table: "users", Column: "email", NewName: "mail"}),
+		}},
+		{Id: "0003", Actions: []Action{
+			newAction("renameTable", RenameTableParams{Name: "users", NewName: "accounts"}),
+		}},
+	}
+
+	_, history, err := getSchemaHistory(migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"table:accounts":        "0003",
+		"column:accounts.name":  "0001",
+		"column:accounts.mail":  "0002",
+		"column:users.name":     "",
+		"column:users.email":    "",
+		"column:accounts.email": "",
+	}
+
+	for key, migrationId := range expected {
+		if history[key] != migrationId {
+			t.Errorf("history of %q is %q, expected %q", key, history[key], migrationId)
+		}
+	}
+}
+
+func TestGetTableDocsFileName(t *testing.T) {
+
+	if fileName := getTableDocsFileName("index", DocsMarkdown); fileName != "table_index.md" {
+		t.Errorf("expected 'table_index.md', got %q", fileName)
+	}
+
+	if fileName := getTableDocsFileName("index", DocsHtml); fileName == getDocsFileName("index", DocsHtml) {
+		t.Errorf("page of table 'index' replaces the index page %q", fileName)
+	}
+}
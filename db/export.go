@@ -0,0 +1,163 @@
+package db
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const fullDdlFileName = "schema.sql"
+
+// sqlRecorder collects statements of sync appliers instead of executing them,
+// appliers don't read from the database, so QueryRow isn't supported
+type sqlRecorder struct {
+	statements []string
+}
+
+func (r *sqlRecorder) Exec(query string, args ...interface{}) (sql.Result, error) {
+	if len(args) > 0 {
+		return nil, fmt.Errorf("statement with arguments can't be exported: %v", query)
+	}
+
+	r.statements = append(r.statements, formatStatement(query))
+	return driver.RowsAffected(0), nil
+}
+
+func (r *sqlRecorder) QueryRow(query string, args ...interface{}) *sql.Row {
+	panic("sqlRecorder doesn't support queries")
+}
+
+func (r *sqlRecorder) getScript(header string) string {
+	var script strings.Builder
+
+	script.WriteString(header)
+	script.WriteString("\n")
+
+	for _, statement := range r.statements {
+		script.WriteString("\n")
+		script.WriteString(statement)
+		script.WriteString(";\n")
+	}
+
+	return script.String()
+}
+
+// formatStatement replaces the indentation of go sources in multiline statements,
+// lines are kept as is if they don't have a common indentation, for example in multiline literals
+func formatStatement(query string) string {
+	lines := strings.Split(strings.TrimSpace(query), "\n")
+
+	indentation := ""
+	for index, line := range lines[1:] {
+		lineIndentation := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if index == 0 || strings.HasPrefix(indentation, lineIndentation) {
+			indentation = lineIndentation
+		} else if !strings.HasPrefix(lineIndentation, indentation) {
+			indentation = ""
+		}
+	}
+
+	if indentation != "" {
+		for index := range lines[1:] {
+			lines[index+1] = "    " + strings.TrimPrefix(lines[index+1], indentation)
+		}
+	}
+
+	return strings.TrimSuffix(strings.Join(lines, "\n"), ";")
+}
+
+var notFileNameCharacters = regexp.MustCompile("[^a-zA-Z0-9]+")
+
+// getSqlMigrationFileName follows the versioned migration naming of Flyway
+func getSqlMigrationFileName(migration Migration) string {
+	description := strings.Trim(notFileNameCharacters.ReplaceAllString(migration.Description, "_"), "_")
+	if description == "" {
+		description = "migration"
+	}
+
+	return fmt.Sprintf("V%v__%v.sql", migration.Id, description)
+}
+
+// ExportSql writes a sql file for every migration with statements Sync runs for it
+func ExportSql(outDirectory string) ([]string, error) {
+
+	migrations, err := GetList()
+	if err != nil {
+		return nil, fmt.Errorf("can't read migrations: %v", err)
+	}
+
+	err = os.MkdirAll(outDirectory, 0777)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := newSnapshot()
+	files := []string{}
+	ignoreProgress := func(event ProgressEvent) {}
+
+	for _, migration := range *migrations {
+		recorder := &sqlRecorder{}
+
+		err = applyMigrationActions(recorder, snapshot, migration, 0, len(migration.Actions), ignoreProgress)
+		if err != nil {
+			return files, fmt.Errorf("can't export migration %v: %v", migration.Id, err)
+		}
+
+		header := fmt.Sprintf("-- Migration %v", migration.Id)
+		if migration.Description != "" {
+			header += ": " + strings.Replace(migration.Description, "\n", " ", -1)
+		}
+
+		filePath := filepath.Join(outDirectory, getSqlMigrationFileName(migration))
+		err = ioutil.WriteFile(filePath, []byte(recorder.getScript(header)), 0666)
+		if err != nil {
+			return files, err
+		}
+
+		files = append(files, filePath)
+	}
+
+	return files, nil
+}
+
+// ExportFullDdl writes one script creating the current schema, statements are
+// ordered as DiffSnapshots adds elements: sequences, tables, columns, keys,
+// constraints, indexes, triggers and relations when all remote tables exist
+func ExportFullDdl(outDirectory string) (string, error) {
+
+	snapshot, err := GetCurrentSnapshot()
+	if err != nil {
+		return "", err
+	}
+
+	actions, err := DiffSnapshots(newSnapshot(), snapshot, nil)
+	if err != nil {
+		return "", err
+	}
+
+	recorder := &sqlRecorder{}
+	migration := Migration{Id: "ddl", Actions: actions}
+
+	err = applyMigrationActions(recorder, newSnapshot(), migration, 0, len(actions), func(event ProgressEvent) {})
+	if err != nil {
+		return "", fmt.Errorf("can't export schema: %v", err)
+	}
+
+	err = os.MkdirAll(outDirectory, 0777)
+	if err != nil {
+		return "", err
+	}
+
+	filePath := filepath.Join(outDirectory, fullDdlFileName)
+	err = ioutil.WriteFile(filePath, []byte(recorder.getScript("-- Schema created by all migrations")), 0666)
+	if err != nil {
+		return "", err
+	}
+
+	return filePath, nil
+}
@@ -0,0 +1,632 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const desiredSchemaFileName = "schema.json"
+
+// RenameConfirmation is asked whether an element missing in the desired schema
+// is renamed to a new element, otherwise the element is dropped and added.
+// Table is empty for table renames.
+type RenameConfirmation func(kind string, table string, name string, newName string) bool
+
+func GetDesiredSchemaPath() (string, error) {
+	pwd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+
+	// Named databases have schema.<name>.json
+	if selectedDatabase != "" {
+		return filepath.Join(pwd, fmt.Sprintf("schema.%v.json", selectedDatabase)), nil
+	}
+
+	return filepath.Join(pwd, desiredSchemaFileName), nil
+}
+
+func ReadDesiredSnapshot(schemaPath string) (*Snapshot, error) {
+
+	rawSchema, err := ioutil.ReadFile(schemaPath)
+	if err != nil {
+		return nil, fmt.Errorf("can't read desired schema: %v", err)
+	}
+
+	snapshot := newSnapshot()
+	err = json.Unmarshal(rawSchema, snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse desired schema: %v", err)
+	}
+
+	return snapshot, nil
+}
+
+// GenerateMigration writes a new migration which changes the current schema
+// to the desired one. Empty file name is returned when there is nothing to change.
+func GenerateMigration(description string, schemaPath string, format MigrationFormat, confirmRename RenameConfirmation) (string, error) {
+
+	desired, err := ReadDesiredSnapshot(schemaPath)
+	if err != nil {
+		return "", err
+	}
+
+	current, err := GetCurrentSnapshot()
+	if err != nil {
+		return "", err
+	}
+
+	actions, err := DiffSnapshots(current, desired, confirmRename)
+	if err != nil {
+		return "", err
+	}
+
+	if len(actions) == 0 {
+		return "", nil
+	}
+
+	return addMigrationWithActions(description, actions, format)
+}
+
+// snapshotDiff collects actions and keeps the snapshot they produce, so every action is checked as it is added
+type snapshotDiff struct {
+	snapshot *Snapshot
+	actions  []Action
+}
+
+func (d *snapshotDiff) add(method string, params interface{}) error {
+	action := newAction(method, params)
+
+	err := applyActionsToSnapshot(d.snapshot, []Action{action})
+	if err != nil {
+		return err
+	}
+
+	d.actions = append(d.actions, action)
+	return nil
+}
+
+func copySnapshot(snapshot *Snapshot) (*Snapshot, error) {
+	packedSnapshot, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	copied := newSnapshot()
+	err = json.Unmarshal(packedSnapshot, copied)
+	return copied, err
+}
+
+// DiffSnapshots returns actions changing current to desired. Renames go
+// first, then drops of relations, indexes, constraints, keys, columns, tables
+// and sequences, then adds in the reverse order.
+func DiffSnapshots(current *Snapshot, desired *Snapshot, confirmRename RenameConfirmation) ([]Action, error) {
+
+	working, err := copySnapshot(current)
+	if err != nil {
+		return nil, err
+	}
+
+	desired, err = copySnapshot(desired)
+	if err != nil {
+		return nil, err
+	}
+
+	for index := range desired.Tables {
+		table := &desired.Tables[index]
+		if len(table.PrimaryKeys) > 0 && table.PrimaryKeyName == "" {
+			table.PrimaryKeyName = getDefaultPrimaryKeyName(table.Name)
+		}
+	}
+
+	diff := &snapshotDiff{snapshot: working, actions: []Action{}}
+
+	steps := []func(*snapshotDiff, *Snapshot, RenameConfirmation) error{
+		diffTableRenames,
+		diffColumnRenames,
+		diffDrops,
+		diffAdds,
+	}
+
+	for _, step := range steps {
+		err = step(diff, desired, confirmRename)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	differences := CompareSnapshots(desired, diff.snapshot)
+	if len(differences) > 0 {
+		return nil, fmt.Errorf("can't generate migration, these changes aren't supported:\n%v", strings.Join(differences, "\n"))
+	}
+
+	return diff.actions, nil
+}
+
+func getMatchingColumnsScore(table *Table, desiredTable *Table) float64 {
+
+	size := len(table.Columns)
+	if len(desiredTable.Columns) > size {
+		size = len(desiredTable.Columns)
+	}
+
+	if size == 0 {
+		return 1
+	}
+
+	matched := 0
+	for _, column := range table.Columns {
+		desiredColumn := getColumnFromTable(desiredTable, column.Name)
+		if desiredColumn != nil && isSameColumnType(column.Type, desiredColumn.Type) {
+			matched++
+		}
+	}
+
+	return float64(matched) / float64(size)
+}
+
+// diffTableRenames asks about tables missing in the desired schema which have at least half of columns of a new table
+func diffTableRenames(diff *snapshotDiff, desired *Snapshot, confirmRename RenameConfirmation) error {
+
+	if confirmRename == nil {
+		return nil
+	}
+
+	missingTables := []Table{}
+	for _, table := range diff.snapshot.Tables {
+		if getTableFromSnapshot(desired, table.Name) == nil {
+			missingTables = append(missingTables, table)
+		}
+	}
+
+	renamed := map[string]bool{}
+
+	for _, table := range missingTables {
+		type candidate struct {
+			name  string
+			score float64
+		}
+
+		candidates := []candidate{}
+		for _, desiredTable := range desired.Tables {
+			if renamed[desiredTable.Name] || getTableFromSnapshot(diff.snapshot, desiredTable.Name) != nil {
+				continue
+			}
+
+			score := getMatchingColumnsScore(&table, &desiredTable)
+			if score >= 0.5 {
+				candidates = append(candidates, candidate{name: desiredTable.Name, score: score})
+			}
+		}
+
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].score > candidates[j].score
+		})
+
+		for _, item := range candidates {
+			if !confirmRename("table", "", table.Name, item.name) {
+				continue
+			}
+
+			err := diff.add("renameTable", RenameTableParams{Name: table.Name, NewName: item.name})
+			if err != nil {
+				return err
+			}
+
+			renamed[item.name] = true
+			break
+		}
+	}
+
+	return nil
+}
+
+// diffColumnRenames asks about columns missing in the desired table which have the type of a new column
+func diffColumnRenames(diff *snapshotDiff, desired *Snapshot, confirmRename RenameConfirmation) error {
+
+	if confirmRename == nil {
+		return nil
+	}
+
+	for _, desiredTable := range desired.Tables {
+		table := getTableFromSnapshot(diff.snapshot, desiredTable.Name)
+		if table == nil {
+			continue
+		}
+
+		missingColumns := []Column{}
+		for _, column := range table.Columns {
+			if getColumnFromTable(&desiredTable, column.Name) == nil {
+				missingColumns = append(missingColumns, column)
+			}
+		}
+
+		renamed := map[string]bool{}
+
+		for _, column := range missingColumns {
+			for _, desiredColumn := range desiredTable.Columns {
+				if renamed[desiredColumn.Name] || getColumnFromTable(table, desiredColumn.Name) != nil {
+					continue
+				}
+
+				if !isSameColumnType(column.Type, desiredColumn.Type) {
+					continue
+				}
+
+				if !confirmRename("column", table.Name, column.Name, desiredColumn.Name) {
+					continue
+				}
+
+				err := diff.add("renameColumn", RenameColumnParams{Table: table.Name, Column: column.Name, NewName: desiredColumn.Name})
+				if err != nil {
+					return err
+				}
+
+				renamed[desiredColumn.Name] = true
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+func isSameRelation(relation Relation, desiredRelation *Relation) bool {
+	return desiredRelation != nil &&
+		relation.Type == desiredRelation.Type &&
+		formatRelation(relation) == formatRelation(*desiredRelation)
+}
+
+func getIndexFromTable(table *Table, indexName string) *Index {
+	for index := range table.Indexes {
+		if table.Indexes[index].Name == indexName {
+			return &table.Indexes[index]
+		}
+	}
+
+	return nil
+}
+
+func getDesiredPrimaryKeyName(table *Table) string {
+	if table.PrimaryKeyName != "" {
+		return table.PrimaryKeyName
+	}
+
+	return getDefaultPrimaryKeyName(table.Name)
+}
+
+func isSamePrimaryKey(table *Table, desiredTable *Table) bool {
+	if len(table.PrimaryKeys) == 0 || len(desiredTable.PrimaryKeys) == 0 {
+		return len(table.PrimaryKeys) == len(desiredTable.PrimaryKeys)
+	}
+
+	return joinColumnNames(table.PrimaryKeys) == joinColumnNames(desiredTable.PrimaryKeys) &&
+		getDesiredPrimaryKeyName(table) == getDesiredPrimaryKeyName(desiredTable)
+}
+
+// checkColumnChange rejects column changes that have no action, dropping the column would lose its data
+func checkColumnChange(table *Table, column *Column, desiredColumn *Column) error {
+
+	isChanged := !isSameColumnType(column.Type, desiredColumn.Type) ||
+		column.IsNullable != desiredColumn.IsNullable ||
+		formatIdentity(column.Identity) != formatIdentity(desiredColumn.Identity) ||
+		column.Generated != desiredColumn.Generated ||
+		formatColumnDefault(*column) != formatColumnDefault(*desiredColumn)
+
+	if isChanged {
+		return fmt.Errorf("column '%v.%v' is changed, only comment of existing column can be changed, delete and add the column explicitly", table.Name, column.Name)
+	}
+
+	return nil
+}
+
+func diffDrops(diff *snapshotDiff, desired *Snapshot, confirmRename RenameConfirmation) error {
+
+	// Actions change the working snapshot, so the loops go over a copy of it
+	snapshot, err := copySnapshot(diff.snapshot)
+	if err != nil {
+		return err
+	}
+
+	tables := snapshot.Tables
+
+	// Array relations go first, they can be linked to object relations
+	for _, isArray := range []bool{true, false} {
+		for _, table := range tables {
+			desiredTable := getTableFromSnapshot(desired, table.Name)
+
+			for _, relation := range table.Relations {
+				if (relation.Type == Array) != isArray {
+					continue
+				}
+
+				var desiredRelation *Relation
+				if desiredTable != nil {
+					desiredRelation = getRelationFromTable(desiredTable, relation.Name)
+				}
+
+				if isSameRelation(relation, desiredRelation) {
+					continue
+				}
+
+				err := diff.add("deleteRelation", DeleteRelationParams{Table: table.Name, Name: relation.Name})
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	// Audit is disabled before history tables and their columns are dropped
+	for _, table := range tables {
+		desiredTable := getTableFromSnapshot(desired, table.Name)
+		if table.AuditTable == "" || (desiredTable != nil && desiredTable.AuditTable == table.AuditTable) {
+			continue
+		}
+
+		err := diff.add("disableAudit", DisableAuditParams{Table: table.Name})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, table := range tables {
+		desiredTable := getTableFromSnapshot(desired, table.Name)
+		if desiredTable == nil {
+			continue
+		}
+
+		if table.UpdatedAtColumn != "" && table.UpdatedAtColumn != desiredTable.UpdatedAtColumn {
+			err := diff.add("dropUpdatedAtTrigger", DropUpdatedAtTriggerParams{Table: table.Name})
+			if err != nil {
+				return err
+			}
+		}
+
+		if table.NotifyChannel != "" && table.NotifyChannel != desiredTable.NotifyChannel {
+			err := diff.add("dropChangeNotify", DropChangeNotifyParams{Table: table.Name})
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, index := range table.Indexes {
+			desiredIndex := getIndexFromTable(desiredTable, index.Name)
+			if desiredIndex != nil && formatIndex(index) == formatIndex(*desiredIndex) {
+				continue
+			}
+
+			err := diff.add("deleteIndex", DeleteIndexParams{Table: table.Name, Name: index.Name})
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, constraint := range table.UniqueConstraints {
+			desiredConstraint := getUniqueConstraintFromTable(desiredTable, constraint.Name)
+			if desiredConstraint != nil && strings.Join(constraint.Columns, ", ") == strings.Join(desiredConstraint.Columns, ", ") {
+				continue
+			}
+
+			err := diff.add("deleteUniqueConstraint", DeleteUniqueConstraintParams{Table: table.Name, Name: constraint.Name})
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(table.PrimaryKeys) > 0 && !isSamePrimaryKey(&table, desiredTable) {
+			err := diff.add("dropPrimaryKey", DropPrimaryKeyParams{Table: table.Name})
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, column := range table.Columns {
+			desiredColumn := getColumnFromTable(desiredTable, column.Name)
+			if desiredColumn != nil {
+				err := checkColumnChange(&table, &column, desiredColumn)
+				if err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			err := diff.add("deleteColumn", DeleteColumnParams{Table: table.Name, Column: column.Name})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, table := range tables {
+		if getTableFromSnapshot(desired, table.Name) != nil {
+			continue
+		}
+
+		err := diff.add("deleteTable", DeleteTableParams{Name: table.Name})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, sequence := range snapshot.Sequences {
+		desiredSequence := getSequenceFromSnapshot(desired, sequence.Name)
+		if desiredSequence != nil {
+			if sequence.Type != desiredSequence.Type ||
+				formatSequenceOptions(sequence.SequenceOptions) != formatSequenceOptions(desiredSequence.SequenceOptions) {
+				return fmt.Errorf("sequence '%v' is changed, delete and add the sequence explicitly", sequence.Name)
+			}
+
+			continue
+		}
+
+		err := diff.add("deleteSequence", DeleteSequenceParams{Name: sequence.Name})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func diffAdds(diff *snapshotDiff, desired *Snapshot, confirmRename RenameConfirmation) error {
+
+	for _, sequence := range desired.Sequences {
+		if getSequenceFromSnapshot(diff.snapshot, sequence.Name) != nil {
+			continue
+		}
+
+		err := diff.add("addSequence", AddSequenceParams{Name: sequence.Name, Type: sequence.Type, SequenceOptions: sequence.SequenceOptions})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, desiredTable := range desired.Tables {
+		if getTableFromSnapshot(diff.snapshot, desiredTable.Name) != nil {
+			continue
+		}
+
+		err := diff.add("addTable", AddTableParams{Name: desiredTable.Name})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, desiredTable := range desired.Tables {
+		table := getTableFromSnapshot(diff.snapshot, desiredTable.Name)
+
+		if table.Comment != desiredTable.Comment {
+			err := diff.add("setTableComment", SetTableCommentParams{Table: desiredTable.Name, Comment: desiredTable.Comment})
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, desiredColumn := range desiredTable.Columns {
+			column := getColumnFromTable(getTableFromSnapshot(diff.snapshot, desiredTable.Name), desiredColumn.Name)
+			if column == nil {
+				err := diff.add("addColumn", AddColumnParams{
+					Table:      desiredTable.Name,
+					Column:     desiredColumn.Name,
+					Type:       desiredColumn.Type,
+					IsNullable: desiredColumn.IsNullable,
+					Default:    desiredColumn.Default,
+					Identity:   desiredColumn.Identity,
+					Generated:  desiredColumn.Generated,
+				})
+				if err != nil {
+					return err
+				}
+
+				if desiredColumn.Comment == "" {
+					continue
+				}
+			} else if column.Comment == desiredColumn.Comment {
+				continue
+			}
+
+			err := diff.add("setColumnComment", SetColumnCommentParams{Table: desiredTable.Name, Column: desiredColumn.Name, Comment: desiredColumn.Comment})
+			if err != nil {
+				return err
+			}
+		}
+
+		table = getTableFromSnapshot(diff.snapshot, desiredTable.Name)
+
+		if len(desiredTable.PrimaryKeys) > 0 && !isSamePrimaryKey(table, &desiredTable) {
+			columns := []string{}
+			for _, key := range desiredTable.PrimaryKeys {
+				columns = append(columns, string(key))
+			}
+
+			err := diff.add("setPrimaryKey", SetPrimaryKeyParams{Table: desiredTable.Name, Columns: columns, Name: desiredTable.PrimaryKeyName})
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, constraint := range desiredTable.UniqueConstraints {
+			if getUniqueConstraintFromTable(getTableFromSnapshot(diff.snapshot, desiredTable.Name), constraint.Name) != nil {
+				continue
+			}
+
+			err := diff.add("addUniqueConstraint", AddUniqueConstraintParams{Table: desiredTable.Name, Name: constraint.Name, Columns: constraint.Columns})
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, index := range desiredTable.Indexes {
+			if getIndexFromTable(getTableFromSnapshot(diff.snapshot, desiredTable.Name), index.Name) != nil {
+				continue
+			}
+
+			err := diff.add("addIndex", AddIndexParams{Table: desiredTable.Name, Name: index.Name, Columns: index.Columns, IsUnique: index.IsUnique})
+			if err != nil {
+				return err
+			}
+		}
+
+		if desiredTable.UpdatedAtColumn != "" && getTableFromSnapshot(diff.snapshot, desiredTable.Name).UpdatedAtColumn == "" {
+			err := diff.add("setUpdatedAtTrigger", SetUpdatedAtTriggerParams{Table: desiredTable.Name, Column: desiredTable.UpdatedAtColumn})
+			if err != nil {
+				return err
+			}
+		}
+
+		if desiredTable.NotifyChannel != "" && getTableFromSnapshot(diff.snapshot, desiredTable.Name).NotifyChannel == "" {
+			err := diff.add("setChangeNotify", SetChangeNotifyParams{Table: desiredTable.Name, Channel: desiredTable.NotifyChannel})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Audit is enabled when all history tables and their columns exist
+	for _, desiredTable := range desired.Tables {
+		if desiredTable.AuditTable == "" || getTableFromSnapshot(diff.snapshot, desiredTable.Name).AuditTable != "" {
+			continue
+		}
+
+		err := diff.add("enableAudit", EnableAuditParams{Table: desiredTable.Name, HistoryTable: desiredTable.AuditTable})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Relations are added last, when all remote tables and columns exist,
+	// object relations go first, so array relations can be linked to them
+	for _, isArray := range []bool{false, true} {
+		for _, desiredTable := range desired.Tables {
+			for _, relation := range desiredTable.Relations {
+				if (relation.Type == Array) != isArray {
+					continue
+				}
+
+				if getRelationFromTable(getTableFromSnapshot(diff.snapshot, desiredTable.Name), relation.Name) != nil {
+					continue
+				}
+
+				err := diff.add("addRelation", AddRelationParams{
+					Type:           relation.Type,
+					Name:           relation.Name,
+					Table:          desiredTable.Name,
+					RemoteTable:    relation.RemoteTable,
+					ColumnsMapping: relation.ColumnsMapping,
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
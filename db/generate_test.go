@@ -0,0 +1,108 @@
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+func getItemsSnapshot(t *testing.T, statusType string) *Snapshot {
+	t.Helper()
+
+	snapshot, err := GetSnapshot([]Action{
+		newAction("addTable", AddTableParams{Name: "items"}),
+		newAction("addColumn", AddColumnParams{Table: "items", Column: "id", Type: "int4"}),
+		newAction("addColumn", AddColumnParams{Table: "items", Column: "status", Type: statusType, IsNullable: true}),
+		newAction("setPrimaryKey", SetPrimaryKeyParams{Table: "items", Columns: []string{"id"}}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return snapshot
+}
+
+func TestDiffSnapshotsSameSchema(t *testing.T) {
+
+	current := getItemsSnapshot(t, "varchar(20)")
+
+	desired := getItemsSnapshot(t, "character varying(20)")
+	desired.GetTable("items").Columns[0].Type = "integer"
+
+	actions, err := DiffSnapshots(current, desired, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(actions) != 0 {
+		t.Fatalf("expected no actions for aliased types, got %v", actions)
+	}
+}
+
+func TestDiffSnapshotsChangedColumnType(t *testing.T) {
+
+	current := getItemsSnapshot(t, "varchar(20)")
+	desired := getItemsSnapshot(t, "varchar(255)")
+
+	_, err := DiffSnapshots(current, desired, nil)
+
+	expected := "column 'items.status' is changed"
+	if err == nil || !strings.Contains(err.Error(), expected) {
+		t.Fatalf("expected error %q, got %v", expected, err)
+	}
+}
+
+func TestDiffSnapshotsAddsAndDrops(t *testing.T) {
+
+	current := getItemsSnapshot(t, "text")
+
+	desired := getItemsSnapshot(t, "text")
+	table := desired.GetTable("items")
+	table.Columns = table.Columns[:1]
+	table.Columns = append(table.Columns, Column{Name: "title", Type: "text", IsNullable: true, Comment: "title of the item"})
+
+	actions, err := DiffSnapshots(current, desired, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	methods := []string{}
+	for _, action := range actions {
+		methods = append(methods, action.Method)
+	}
+
+	expected := "deleteColumn, addColumn, setColumnComment"
+	if strings.Join(methods, ", ") != expected {
+		t.Fatalf("expected actions %v, got %v", expected, methods)
+	}
+
+	err = applyActionsToSnapshot(current, actions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	differences := CompareSnapshots(desired, current)
+	if len(differences) != 0 {
+		t.Fatalf("generated actions don't produce the desired schema: %v", differences)
+	}
+}
+
+func TestDiffSnapshotsRenameColumn(t *testing.T) {
+
+	current := getItemsSnapshot(t, "text")
+
+	desired := getItemsSnapshot(t, "text")
+	desired.GetTable("items").Columns[1].Name = "state"
+
+	confirmRename := func(kind string, table string, name string, newName string) bool {
+		return kind == "column" && table == "items" && name == "status" && newName == "state"
+	}
+
+	actions, err := DiffSnapshots(current, desired, confirmRename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(actions) != 1 || actions[0].Method != "renameColumn" {
+		t.Fatalf("expected one renameColumn action, got %v", actions)
+	}
+}
@@ -0,0 +1,697 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// InspectSnapshot reads tables, columns, keys, unique constraints, foreign keys,
+// indexes and updated at triggers of the current schema of the database. Relation
+// types can't be restored from the database, so relations of the result have empty types.
+func InspectSnapshot(db *sql.DB) (*Snapshot, error) {
+
+	snapshot := newSnapshot()
+
+	rows, err := db.Query(`
+		SELECT c.relname, a.attname, format_type(a.atttypid, a.atttypmod), NOT a.attnotnull,
+			a.attidentity::text, a.attgenerated::text, COALESCE(pg_get_expr(d.adbin, d.adrelid), ''),
+			COALESCE(col_description(c.oid, a.attnum), '')
+		FROM pg_class c
+			JOIN pg_namespace n ON n.oid = c.relnamespace
+			JOIN pg_attribute a ON a.attrelid = c.oid
+			LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+		WHERE n.nspname = current_schema()
+			AND c.relkind = 'r'
+			AND c.relname <> '_migrations'
+			AND a.attnum > 0
+			AND NOT a.attisdropped
+		ORDER BY c.relname, a.attnum
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("can't read columns: %v", err)
+	}
+
+	for rows.Next() {
+		var tableName, identity, generated, expression string
+		var column Column
+
+		err = rows.Scan(&tableName, &column.Name, &column.Type, &column.IsNullable, &identity, &generated, &expression, &column.Comment)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("can't read columns: %v", err)
+		}
+
+		switch identity {
+		case "a":
+			column.Identity = &Identity{Generation: IdentityAlways}
+			column.IsReadOnly = true
+			break
+		case "d":
+			column.Identity = &Identity{Generation: IdentityByDefault}
+			break
+		}
+
+		if generated == "s" {
+			column.Generated = expression
+			column.IsReadOnly = true
+		} else if expression != "" {
+			column.Default = &Default{
+				Kind:  DefaultExpression,
+				Value: expression,
+			}
+		}
+
+		table := getTableFromSnapshot(snapshot, tableName)
+		if table == nil {
+			snapshot.Tables = append(snapshot.Tables, Table{
+				Name:        tableName,
+				Columns:     []Column{},
+				PrimaryKeys: []ColumnName{},
+				Relations:   []Relation{},
+			})
+			table = &snapshot.Tables[len(snapshot.Tables)-1]
+		}
+
+		table.Columns = append(table.Columns, column)
+	}
+	rows.Close()
+
+	// Tables without columns are not returned by the query above, comments of tables are read here
+	tableRows, err := db.Query(`
+		SELECT c.relname, COALESCE(obj_description(c.oid, 'pg_class'), '')
+		FROM pg_class c
+			JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = current_schema()
+			AND c.relkind = 'r'
+			AND c.relname <> '_migrations'
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("can't read tables: %v", err)
+	}
+
+	for tableRows.Next() {
+		var tableName, comment string
+		err = tableRows.Scan(&tableName, &comment)
+		if err != nil {
+			tableRows.Close()
+			return nil, fmt.Errorf("can't read tables: %v", err)
+		}
+
+		table := getTableFromSnapshot(snapshot, tableName)
+		if table == nil {
+			snapshot.Tables = append(snapshot.Tables, Table{
+				Name:        tableName,
+				Columns:     []Column{},
+				PrimaryKeys: []ColumnName{},
+				Relations:   []Relation{},
+			})
+			table = &snapshot.Tables[len(snapshot.Tables)-1]
+		}
+
+		table.Comment = comment
+	}
+	tableRows.Close()
+
+	// Sequences created for serial and identity columns belong to columns
+	sequenceRows, err := db.Query(`
+		SELECT c.relname
+		FROM pg_class c
+			JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = current_schema()
+			AND c.relkind = 'S'
+			AND NOT EXISTS (
+				SELECT 1 FROM pg_depend d
+				WHERE d.classid = 'pg_class'::regclass
+					AND d.objid = c.oid
+					AND d.refobjsubid > 0
+					AND d.deptype IN ('a', 'i')
+			)
+		ORDER BY c.relname
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("can't read sequences: %v", err)
+	}
+
+	for sequenceRows.Next() {
+		var sequence Sequence
+		err = sequenceRows.Scan(&sequence.Name)
+		if err != nil {
+			sequenceRows.Close()
+			return nil, fmt.Errorf("can't read sequences: %v", err)
+		}
+
+		snapshot.Sequences = append(snapshot.Sequences, sequence)
+	}
+	sequenceRows.Close()
+
+	constraintRows, err := db.Query(`
+		SELECT c.relname, con.conname, con.contype, a.attname, COALESCE(rc.relname, ''), COALESCE(ra.attname, '')
+		FROM pg_constraint con
+			JOIN pg_class c ON c.oid = con.conrelid
+			JOIN pg_namespace n ON n.oid = c.relnamespace
+			CROSS JOIN LATERAL unnest(con.conkey) WITH ORDINALITY AS k(attnum, position)
+			JOIN pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = k.attnum
+			LEFT JOIN pg_class rc ON rc.oid = con.confrelid
+			LEFT JOIN pg_attribute ra ON ra.attrelid = con.confrelid AND ra.attnum = con.confkey[k.position::int]
+		WHERE n.nspname = current_schema()
+			AND c.relname <> '_migrations'
+			AND con.contype IN ('p', 'u', 'f')
+		ORDER BY c.relname, con.conname, k.position
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("can't read constraints: %v", err)
+	}
+	defer constraintRows.Close()
+
+	for constraintRows.Next() {
+		var tableName, constraintName, constraintType, columnName, remoteTable, remoteColumn string
+
+		err = constraintRows.Scan(&tableName, &constraintName, &constraintType, &columnName, &remoteTable, &remoteColumn)
+		if err != nil {
+			return nil, fmt.Errorf("can't read constraints: %v", err)
+		}
+
+		table := getTableFromSnapshot(snapshot, tableName)
+		if table == nil {
+			continue
+		}
+
+		switch constraintType {
+		case "p":
+			table.PrimaryKeyName = constraintName
+			table.PrimaryKeys = append(table.PrimaryKeys, ColumnName(columnName))
+			break
+		case "u":
+			constraint := getUniqueConstraintFromTable(table, constraintName)
+			if constraint == nil {
+				table.UniqueConstraints = append(table.UniqueConstraints, UniqueConstraint{
+					Name:    constraintName,
+					Columns: []string{},
+				})
+				constraint = &table.UniqueConstraints[len(table.UniqueConstraints)-1]
+			}
+
+			constraint.Columns = append(constraint.Columns, columnName)
+			break
+		case "f":
+			relation := getRelationFromTable(table, constraintName)
+			if relation == nil {
+				table.Relations = append(table.Relations, Relation{
+					Name:           constraintName,
+					RemoteTable:    remoteTable,
+					ColumnsMapping: []ColumnsMap{},
+				})
+				relation = &table.Relations[len(table.Relations)-1]
+			}
+
+			relation.ColumnsMapping = append(relation.ColumnsMapping, ColumnsMap{
+				Column:       columnName,
+				RemoteColumn: remoteColumn,
+			})
+			break
+		}
+	}
+
+	err = constraintRows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("can't read constraints: %v", err)
+	}
+
+	// Indexes backing constraints are read as constraints above
+	indexRows, err := db.Query(`
+		SELECT c.relname, ic.relname, i.indisunique, a.attname
+		FROM pg_index i
+			JOIN pg_class c ON c.oid = i.indrelid
+			JOIN pg_class ic ON ic.oid = i.indexrelid
+			JOIN pg_namespace n ON n.oid = c.relnamespace
+			CROSS JOIN LATERAL unnest(i.indkey) WITH ORDINALITY AS k(attnum, position)
+			JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = k.attnum
+		WHERE n.nspname = current_schema()
+			AND c.relname <> '_migrations'
+			AND NOT EXISTS (SELECT 1 FROM pg_constraint con WHERE con.conindid = i.indexrelid)
+		ORDER BY c.relname, ic.relname, k.position
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("can't read indexes: %v", err)
+	}
+	defer indexRows.Close()
+
+	for indexRows.Next() {
+		var tableName, indexName, columnName string
+		var isUnique bool
+
+		err = indexRows.Scan(&tableName, &indexName, &isUnique, &columnName)
+		if err != nil {
+			return nil, fmt.Errorf("can't read indexes: %v", err)
+		}
+
+		table := getTableFromSnapshot(snapshot, tableName)
+		if table == nil {
+			continue
+		}
+
+		if len(table.Indexes) == 0 || table.Indexes[len(table.Indexes)-1].Name != indexName {
+			table.Indexes = append(table.Indexes, Index{
+				Name:     indexName,
+				Columns:  []string{},
+				IsUnique: isUnique,
+			})
+		}
+
+		index := &table.Indexes[len(table.Indexes)-1]
+		index.Columns = append(index.Columns, columnName)
+	}
+
+	err = indexRows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("can't read indexes: %v", err)
+	}
+
+	// The column, the channel or the history table is the first argument of the trigger, arguments are separated by zero bytes
+	triggerRows, err := db.Query(`
+		SELECT c.relname, t.tgname, split_part(encode(t.tgargs, 'escape'), '\000', 1)
+		FROM pg_trigger t
+			JOIN pg_class c ON c.oid = t.tgrelid
+			JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = current_schema()
+			AND t.tgname IN ($1, $2, $3)
+	`, updatedAtTriggerName, notifyTriggerName, auditTriggerName)
+	if err != nil {
+		return nil, fmt.Errorf("can't read triggers: %v", err)
+	}
+	defer triggerRows.Close()
+
+	for triggerRows.Next() {
+		var tableName, triggerName, argument string
+
+		err = triggerRows.Scan(&tableName, &triggerName, &argument)
+		if err != nil {
+			return nil, fmt.Errorf("can't read triggers: %v", err)
+		}
+
+		table := getTableFromSnapshot(snapshot, tableName)
+		if table == nil {
+			continue
+		}
+
+		switch triggerName {
+		case notifyTriggerName:
+			table.NotifyChannel = argument
+		case auditTriggerName:
+			table.AuditTable = argument
+		default:
+			table.UpdatedAtColumn = argument
+		}
+	}
+
+	return snapshot, triggerRows.Err()
+}
+
+func getUniqueConstraintFromTable(table *Table, constraintName string) *UniqueConstraint {
+
+	for index := 0; index < len(table.UniqueConstraints); index++ {
+		if table.UniqueConstraints[index].Name == constraintName {
+			return &table.UniqueConstraints[index]
+		}
+	}
+
+	return nil
+}
+
+func getRelationFromTable(table *Table, relationName string) *Relation {
+
+	for index := 0; index < len(table.Relations); index++ {
+		if table.Relations[index].Name == relationName {
+			return &table.Relations[index]
+		}
+	}
+
+	return nil
+}
+
+// CompareSnapshots returns differences between the expected snapshot built from
+// migrations and the actual snapshot read from a database. Relation types and
+// sequence options are not compared. Defaults and generated expressions are compared
+// without casts, parentheses, spaces and case, the database adds them when it keeps expressions.
+func CompareSnapshots(expected *Snapshot, actual *Snapshot) []string {
+
+	differences := []string{}
+
+	expected = getForeignKeysSnapshot(expected)
+	actual = getForeignKeysSnapshot(actual)
+
+	for _, expectedTable := range expected.Tables {
+		actualTable := getTableFromSnapshot(actual, expectedTable.Name)
+		if actualTable == nil {
+			differences = append(differences, fmt.Sprintf("table '%v' doesn't exist", expectedTable.Name))
+			continue
+		}
+
+		differences = append(differences, compareTables(&expectedTable, actualTable)...)
+	}
+
+	for _, actualTable := range actual.Tables {
+		if getTableFromSnapshot(expected, actualTable.Name) == nil {
+			differences = append(differences, fmt.Sprintf("table '%v' is not defined by migrations", actualTable.Name))
+		}
+	}
+
+	for _, expectedSequence := range expected.Sequences {
+		if getSequenceFromSnapshot(actual, expectedSequence.Name) == nil {
+			differences = append(differences, fmt.Sprintf("sequence '%v' doesn't exist", expectedSequence.Name))
+		}
+	}
+
+	for _, actualSequence := range actual.Sequences {
+		if getSequenceFromSnapshot(expected, actualSequence.Name) == nil {
+			differences = append(differences, fmt.Sprintf("sequence '%v' is not defined by migrations", actualSequence.Name))
+		}
+	}
+
+	return differences
+}
+
+// getForeignKeysSnapshot returns a copy of the snapshot where relations are
+// placed as foreign keys are in the database, array relations are moved to
+// remote tables or removed when they are linked to object relations
+func getForeignKeysSnapshot(snapshot *Snapshot) *Snapshot {
+
+	result := *snapshot
+	result.Tables = make([]Table, len(snapshot.Tables))
+
+	for index, table := range snapshot.Tables {
+		table.Relations = []Relation{}
+		for _, relation := range snapshot.Tables[index].Relations {
+			if relation.Type != Array {
+				table.Relations = append(table.Relations, relation)
+			}
+		}
+
+		result.Tables[index] = table
+	}
+
+	for _, table := range snapshot.Tables {
+		for _, relation := range table.Relations {
+			if relation.Type != Array || relation.LinkedRelation != "" {
+				continue
+			}
+
+			remoteTable := getTableFromSnapshot(&result, relation.RemoteTable)
+			if remoteTable == nil {
+				continue
+			}
+
+			foreignKey := Relation{
+				Type:           Object,
+				Name:           relation.Name,
+				RemoteTable:    table.Name,
+				ColumnsMapping: []ColumnsMap{},
+			}
+
+			for _, mapping := range relation.ColumnsMapping {
+				foreignKey.ColumnsMapping = append(foreignKey.ColumnsMapping, ColumnsMap{
+					Column:       mapping.RemoteColumn,
+					RemoteColumn: mapping.Column,
+				})
+			}
+
+			remoteTable.Relations = append(remoteTable.Relations, foreignKey)
+		}
+	}
+
+	return &result
+}
+
+func compareTables(expected *Table, actual *Table) []string {
+
+	differences := []string{}
+
+	if expected.Comment != actual.Comment {
+		differences = append(differences, fmt.Sprintf("table '%v' has comment '%v', expected '%v'", expected.Name, actual.Comment, expected.Comment))
+	}
+
+	for _, expectedColumn := range expected.Columns {
+		actualColumn := getColumnFromTable(actual, expectedColumn.Name)
+		if actualColumn == nil {
+			differences = append(differences, fmt.Sprintf("column '%v.%v' doesn't exist", expected.Name, expectedColumn.Name))
+			continue
+		}
+
+		if !isSameColumnType(expectedColumn.Type, actualColumn.Type) {
+			differences = append(differences, fmt.Sprintf("column '%v.%v' has type '%v', expected '%v'",
+				expected.Name, expectedColumn.Name, actualColumn.Type, expectedColumn.Type))
+		}
+
+		if expectedColumn.IsNullable != actualColumn.IsNullable {
+			differences = append(differences, fmt.Sprintf("column '%v.%v' has nullable %v, expected %v",
+				expected.Name, expectedColumn.Name, actualColumn.IsNullable, expectedColumn.IsNullable))
+		}
+
+		expectedIdentity := formatIdentity(expectedColumn.Identity)
+		actualIdentity := formatIdentity(actualColumn.Identity)
+		if expectedIdentity != actualIdentity {
+			differences = append(differences, fmt.Sprintf("column '%v.%v' has identity '%v', expected '%v'",
+				expected.Name, expectedColumn.Name, actualIdentity, expectedIdentity))
+		}
+
+		if expectedColumn.Comment != actualColumn.Comment {
+			differences = append(differences, fmt.Sprintf("column '%v.%v' has comment '%v', expected '%v'",
+				expected.Name, expectedColumn.Name, actualColumn.Comment, expectedColumn.Comment))
+		}
+
+		if normalizeExpression(expectedColumn.Generated) != normalizeExpression(actualColumn.Generated) {
+			differences = append(differences, fmt.Sprintf("column '%v.%v' has generated expression '%v', expected '%v'",
+				expected.Name, expectedColumn.Name, actualColumn.Generated, expectedColumn.Generated))
+		}
+
+		expectedDefault := getColumnDefaultExpression(expectedColumn)
+		actualDefault := getColumnDefaultExpression(*actualColumn)
+
+		// Serial columns get the default from their sequence
+		isSerial := serialTypes[strings.ToLower(strings.TrimSpace(expectedColumn.Type))]
+		if isSerial && expectedDefault == "" && strings.HasPrefix(actualDefault, "nextval(") {
+			actualDefault = ""
+		}
+
+		if normalizeExpression(expectedDefault) != normalizeExpression(actualDefault) {
+			differences = append(differences, fmt.Sprintf("column '%v.%v' has default '%v', expected '%v'",
+				expected.Name, expectedColumn.Name, actualDefault, expectedDefault))
+		}
+	}
+
+	for _, actualColumn := range actual.Columns {
+		if getColumnFromTable(expected, actualColumn.Name) == nil {
+			differences = append(differences, fmt.Sprintf("column '%v.%v' is not defined by migrations", expected.Name, actualColumn.Name))
+		}
+	}
+
+	expectedKeys := joinColumnNames(expected.PrimaryKeys)
+	actualKeys := joinColumnNames(actual.PrimaryKeys)
+	if expectedKeys != actualKeys {
+		differences = append(differences, fmt.Sprintf("table '%v' has primary key (%v), expected (%v)", expected.Name, actualKeys, expectedKeys))
+	}
+
+	if expectedKeys != "" && expected.PrimaryKeyName != actual.PrimaryKeyName {
+		differences = append(differences, fmt.Sprintf("table '%v' has primary key name '%v', expected '%v'", expected.Name, actual.PrimaryKeyName, expected.PrimaryKeyName))
+	}
+
+	expectedConstraints := map[string]string{}
+	for _, constraint := range expected.UniqueConstraints {
+		expectedConstraints[constraint.Name] = strings.Join(constraint.Columns, ", ")
+	}
+
+	actualConstraints := map[string]string{}
+	for _, constraint := range actual.UniqueConstraints {
+		actualConstraints[constraint.Name] = strings.Join(constraint.Columns, ", ")
+	}
+
+	differences = append(differences, compareNamedItems(expected.Name, "unique constraint", expectedConstraints, actualConstraints)...)
+
+	expectedRelations := map[string]string{}
+	for _, relation := range expected.Relations {
+		expectedRelations[relation.Name] = formatRelation(relation)
+	}
+
+	actualRelations := map[string]string{}
+	for _, relation := range actual.Relations {
+		actualRelations[relation.Name] = formatRelation(relation)
+	}
+
+	differences = append(differences, compareNamedItems(expected.Name, "relation", expectedRelations, actualRelations)...)
+
+	expectedIndexes := map[string]string{}
+	for _, index := range expected.Indexes {
+		expectedIndexes[index.Name] = formatIndex(index)
+	}
+
+	actualIndexes := map[string]string{}
+	for _, index := range actual.Indexes {
+		actualIndexes[index.Name] = formatIndex(index)
+	}
+
+	differences = append(differences, compareNamedItems(expected.Name, "index", expectedIndexes, actualIndexes)...)
+
+	if expected.UpdatedAtColumn != actual.UpdatedAtColumn {
+		differences = append(differences, fmt.Sprintf("table '%v' has updated at trigger on column '%v', expected '%v'",
+			expected.Name, actual.UpdatedAtColumn, expected.UpdatedAtColumn))
+	}
+
+	if expected.NotifyChannel != actual.NotifyChannel {
+		differences = append(differences, fmt.Sprintf("table '%v' has notify trigger on channel '%v', expected '%v'",
+			expected.Name, actual.NotifyChannel, expected.NotifyChannel))
+	}
+
+	if expected.AuditTable != actual.AuditTable {
+		differences = append(differences, fmt.Sprintf("table '%v' has audit to table '%v', expected '%v'",
+			expected.Name, actual.AuditTable, expected.AuditTable))
+	}
+
+	return differences
+}
+
+func compareNamedItems(tableName string, kind string, expected map[string]string, actual map[string]string) []string {
+
+	differences := []string{}
+
+	names := []string{}
+	for name := range expected {
+		names = append(names, name)
+	}
+	for name := range actual {
+		if _, ok := expected[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		expectedDefinition, isExpected := expected[name]
+		actualDefinition, isActual := actual[name]
+
+		if !isActual {
+			differences = append(differences, fmt.Sprintf("%v '%v' of table '%v' doesn't exist", kind, name, tableName))
+		} else if !isExpected {
+			differences = append(differences, fmt.Sprintf("%v '%v' of table '%v' is not defined by migrations", kind, name, tableName))
+		} else if expectedDefinition != actualDefinition {
+			differences = append(differences, fmt.Sprintf("%v '%v' of table '%v' is %v, expected %v", kind, name, tableName, actualDefinition, expectedDefinition))
+		}
+	}
+
+	return differences
+}
+
+func joinColumnNames(columns []ColumnName) string {
+	names := []string{}
+	for _, column := range columns {
+		names = append(names, string(column))
+	}
+
+	return strings.Join(names, ", ")
+}
+
+func formatRelation(relation Relation) string {
+	columns := []string{}
+	remoteColumns := []string{}
+
+	for _, mapping := range relation.ColumnsMapping {
+		columns = append(columns, mapping.Column)
+		remoteColumns = append(remoteColumns, mapping.RemoteColumn)
+	}
+
+	return fmt.Sprintf("(%v) -> %v(%v)", strings.Join(columns, ", "), relation.RemoteTable, strings.Join(remoteColumns, ", "))
+}
+
+func formatIndex(index Index) string {
+	if index.IsUnique {
+		return "UNIQUE (" + strings.Join(index.Columns, ", ") + ")"
+	}
+
+	return "(" + strings.Join(index.Columns, ", ") + ")"
+}
+
+func formatIdentity(identity *Identity) string {
+	if identity == nil {
+		return ""
+	}
+
+	return string(identity.Generation)
+}
+
+// getColumnDefaultExpression returns the default as SQL, literal defaults are formatted as they are written to the database
+func getColumnDefaultExpression(column Column) string {
+
+	if column.Default == nil {
+		return ""
+	}
+
+	formattedDefault, err := formatDefault(column.Type, column.Default)
+	if err != nil {
+		return column.Default.Value
+	}
+
+	return formattedDefault
+}
+
+// Casts added by the database, types of more than one word are listed as the database writes them
+var expressionCastPattern = regexp.MustCompile(`::\s*(character varying|double precision|bit varying|(timestamp|time)(\s*\(\s*[0-9]+\s*\))?\s+with(out)?\s+time\s+zone|"?[a-z_][a-z0-9_]*"?)(\s*\([0-9,\s]*\))?(\s*\[\])*`)
+
+// normalizeExpression drops casts, parentheses, spaces and case out of string literals,
+// numbers in string literals are unquoted, so '-1'::integer and -1 are the same expression
+func normalizeExpression(expression string) string {
+
+	var result strings.Builder
+	rest := expression
+
+	for rest != "" {
+		quoteIndex := strings.Index(rest, "'")
+		if quoteIndex < 0 {
+			quoteIndex = len(rest)
+		}
+
+		code := expressionCastPattern.ReplaceAllString(strings.ToLower(rest[:quoteIndex]), "")
+		for _, char := range code {
+			if !unicode.IsSpace(char) && char != '(' && char != ')' {
+				result.WriteRune(char)
+			}
+		}
+
+		rest = rest[quoteIndex:]
+		if rest == "" {
+			break
+		}
+
+		// Quotes are doubled in literals, the literal ends at a single quote
+		end := 1
+		for end < len(rest) {
+			if rest[end] == '\'' {
+				if end+1 < len(rest) && rest[end+1] == '\'' {
+					end += 2
+					continue
+				}
+				break
+			}
+			end++
+		}
+
+		if end == len(rest) {
+			result.WriteString(rest)
+			break
+		}
+
+		literal := rest[:end+1]
+		rest = rest[end+1:]
+
+		value := literal[1 : len(literal)-1]
+		if decimalPattern.MatchString(value) {
+			result.WriteString(value)
+		} else {
+			result.WriteString(literal)
+		}
+	}
+
+	return result.String()
+}
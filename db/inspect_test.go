@@ -0,0 +1,105 @@
+package db
+
+import (
+	"testing"
+)
+
+func TestNormalizeExpression(t *testing.T) {
+
+	tests := []struct {
+		expression string
+		expected   string
+	}{
+		{"now()", "now"},
+		{"'-1'::integer", "-1"},
+		{"(price * (quantity)::numeric)", "price*quantity"},
+		{"'active'::character varying", "'active'"},
+		{"'2020-01-01 00:00:00'::timestamp(3) without time zone", "'2020-01-01 00:00:00'"},
+		{"'{}'::text[]", "'{}'"},
+		{"'It''s (Upper)'::text", "'It''s (Upper)'"},
+		{"upper(NAME)", "uppername"},
+		{"'unterminated", "'unterminated"},
+	}
+
+	for _, test := range tests {
+		actual := normalizeExpression(test.expression)
+		if actual != test.expected {
+			t.Errorf("normalizeExpression(%q) = %q, expected %q", test.expression, actual, test.expected)
+		}
+	}
+}
+
+func TestCompareSnapshotsColumns(t *testing.T) {
+
+	tests := []struct {
+		name           string
+		expectedColumn Column
+		actualColumn   Column
+		difference     string
+	}{
+		{
+			name:           "type alias",
+			expectedColumn: Column{Name: "value", Type: "int4[]"},
+			actualColumn:   Column{Name: "value", Type: "integer[]"},
+		},
+		{
+			name:           "type modifier",
+			expectedColumn: Column{Name: "value", Type: "varchar(255)"},
+			actualColumn:   Column{Name: "value", Type: "character varying(20)"},
+			difference:     "column 'items.value' has type 'character varying(20)', expected 'varchar(255)'",
+		},
+		{
+			name:           "literal default",
+			expectedColumn: Column{Name: "value", Type: "text", Default: &Default{Kind: DefaultLiteral, Value: "new"}},
+			actualColumn:   Column{Name: "value", Type: "text", Default: &Default{Kind: DefaultExpression, Value: "'new'::text"}},
+		},
+		{
+			name:           "changed default",
+			expectedColumn: Column{Name: "value", Type: "integer", Default: &Default{Kind: DefaultLiteral, Value: "1"}},
+			actualColumn:   Column{Name: "value", Type: "integer", Default: &Default{Kind: DefaultExpression, Value: "2"}},
+			difference:     "column 'items.value' has default '2', expected '1'",
+		},
+		{
+			name:           "missing default",
+			expectedColumn: Column{Name: "value", Type: "boolean", Default: &Default{Kind: DefaultLiteral, Value: "yes"}},
+			actualColumn:   Column{Name: "value", Type: "boolean"},
+			difference:     "column 'items.value' has default '', expected 'TRUE'",
+		},
+		{
+			name:           "serial default",
+			expectedColumn: Column{Name: "value", Type: "serial"},
+			actualColumn:   Column{Name: "value", Type: "integer", Default: &Default{Kind: DefaultExpression, Value: "nextval('items_value_seq'::regclass)"}},
+		},
+		{
+			name:           "generated expression",
+			expectedColumn: Column{Name: "value", Type: "numeric", Generated: "price * quantity"},
+			actualColumn:   Column{Name: "value", Type: "numeric", Generated: "(price * (quantity)::numeric)"},
+		},
+		{
+			name:           "changed generated expression",
+			expectedColumn: Column{Name: "value", Type: "numeric", Generated: "price * quantity"},
+			actualColumn:   Column{Name: "value", Type: "numeric", Generated: "(price + quantity)"},
+			difference:     "column 'items.value' has generated expression '(price + quantity)', expected 'price * quantity'",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expected := &Snapshot{Tables: []Table{{Name: "items", Columns: []Column{test.expectedColumn}}}}
+			actual := &Snapshot{Tables: []Table{{Name: "items", Columns: []Column{test.actualColumn}}}}
+
+			differences := CompareSnapshots(expected, actual)
+
+			if test.difference == "" {
+				if len(differences) != 0 {
+					t.Fatalf("unexpected differences: %v", differences)
+				}
+				return
+			}
+
+			if len(differences) != 1 || differences[0] != test.difference {
+				t.Fatalf("expected difference %q, got %v", test.difference, differences)
+			}
+		})
+	}
+}
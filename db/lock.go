@@ -0,0 +1,126 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strings"
+	"time"
+)
+
+const syncLockRetryInterval = 500 * time.Millisecond
+
+// getSyncLockKey returns the advisory lock key of the project, syncs of
+// different projects sharing a database don't wait for each other
+func getSyncLockKey(lockName string) int64 {
+	hash := fnv.New64a()
+	hash.Write([]byte("cubes:sync:" + lockName))
+	return int64(hash.Sum64())
+}
+
+// setApplicationName marks the connection, so a waiting sync can tell who holds the lock
+func setApplicationName(executor queryExecutor) error {
+	hostName, err := os.Hostname()
+	if err != nil {
+		hostName = "unknown"
+	}
+
+	applicationName := fmt.Sprintf("cubes sync %v pid %v", hostName, os.Getpid())
+	_, err = executor.Exec(fmt.Sprintf("SET application_name = %v", quoteLiteral(applicationName)))
+	return err
+}
+
+// acquireSyncLock takes the session advisory lock of the project. It waits
+// until the lock is free or the timeout expires, zero timeout waits forever.
+func acquireSyncLock(executor queryExecutor, lockKey int64, timeout time.Duration, progress ProgressFunc) error {
+
+	startedAt := time.Now()
+	isWaitReported := false
+
+	for {
+		var isLocked bool
+		err := executor.QueryRow("SELECT pg_try_advisory_lock($1)", lockKey).Scan(&isLocked)
+		if err != nil {
+			return err
+		}
+
+		if isLocked {
+			return nil
+		}
+
+		if timeout > 0 && time.Since(startedAt) >= timeout {
+			holder, err := getSyncLockHolder(executor, lockKey)
+			if err != nil {
+				return fmt.Errorf("sync lock is not released after %v", timeout)
+			}
+
+			return fmt.Errorf("sync lock is not released after %v, it is held by %v", timeout, holder)
+		}
+
+		if !isWaitReported {
+			holder, err := getSyncLockHolder(executor, lockKey)
+			if err == nil {
+				progress(ProgressEvent{Type: ProgressWaitingForLock, Message: holder})
+			}
+			isWaitReported = true
+		}
+
+		time.Sleep(syncLockRetryInterval)
+	}
+}
+
+func releaseSyncLock(executor queryExecutor, lockKey int64) error {
+	_, err := executor.Exec("SELECT pg_advisory_unlock($1)", lockKey)
+	return err
+}
+
+// getSyncLockHolder describes the session holding the lock. A bigint key is
+// stored in pg_locks as classid (high bits) and objid (low bits) with objsubid 1.
+func getSyncLockHolder(executor queryExecutor, lockKey int64) (string, error) {
+
+	var pid int
+	var applicationName, clientAddress, clientHostName, userName string
+	var startedAt sql.NullString
+
+	row := executor.QueryRow(`
+		SELECT a.pid, COALESCE(a.application_name, ''), COALESCE(host(a.client_addr), ''),
+			COALESCE(a.client_hostname, ''), COALESCE(a.usename::text, ''), a.xact_start::text
+		FROM pg_locks l
+			JOIN pg_stat_activity a ON a.pid = l.pid
+		WHERE l.locktype = 'advisory'
+			AND l.granted
+			AND l.database = (SELECT oid FROM pg_database WHERE datname = current_database())
+			AND l.classid::bigint = $1
+			AND l.objid::bigint = $2
+			AND l.objsubid = 1
+		LIMIT 1
+	`, int64(uint64(lockKey)>>32), int64(uint64(lockKey)&0xffffffff))
+
+	err := row.Scan(&pid, &applicationName, &clientAddress, &clientHostName, &userName, &startedAt)
+	if err != nil {
+		return "", err
+	}
+
+	details := []string{fmt.Sprintf("pid %v", pid)}
+
+	if applicationName != "" {
+		details = append(details, fmt.Sprintf("application '%v'", applicationName))
+	}
+
+	if clientHostName != "" {
+		details = append(details, fmt.Sprintf("host %v", clientHostName))
+	} else if clientAddress != "" {
+		details = append(details, fmt.Sprintf("host %v", clientAddress))
+	}
+
+	if userName != "" {
+		details = append(details, fmt.Sprintf("user %v", userName))
+	}
+
+	if startedAt.Valid {
+		details = append(details, fmt.Sprintf("transaction started at %v", startedAt.String))
+	}
+
+	return strings.Join(details, ", "), nil
+}
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -25,12 +26,92 @@ type DeleteTableParams struct {
 	Name string `json:"name"`
 }
 
+type RenameTableParams struct {
+	Name    string `json:"name"`
+	NewName string `json:"newName"`
+}
+
+type SequenceOptions struct {
+	Start     *int64 `json:"start,omitempty"`
+	Increment *int64 `json:"increment,omitempty"`
+	MinValue  *int64 `json:"minValue,omitempty"`
+	MaxValue  *int64 `json:"maxValue,omitempty"`
+	Cache     *int64 `json:"cache,omitempty"`
+	Cycle     bool   `json:"cycle,omitempty"`
+}
+
+type IdentityGeneration string
+
+const (
+	IdentityAlways    = IdentityGeneration("always")
+	IdentityByDefault = IdentityGeneration("byDefault")
+)
+
+type Identity struct {
+	Generation IdentityGeneration `json:"generation"`
+	SequenceOptions
+}
+
+type DefaultKind string
+
+const (
+	DefaultLiteral    = DefaultKind("literal")
+	DefaultExpression = DefaultKind("expression")
+)
+
+type Default struct {
+	Kind  DefaultKind `json:"kind"`
+	Value string      `json:"value"`
+}
+
+type SetTableCommentParams struct {
+	Table   string `json:"table"`
+	Comment string `json:"comment"`
+}
+
+type SetColumnCommentParams struct {
+	Table   string `json:"table"`
+	Column  string `json:"column"`
+	Comment string `json:"comment"`
+}
+
 type AddColumnParams struct {
-	Table        string `json:"table"`
-	Column       string `json:"column"`
-	Type         string `json:"type"`
-	IsNullable   bool   `json:"isNullable"`
-	DefaultValue string `json:"defaultValue"`
+	Table      string    `json:"table"`
+	Column     string    `json:"column"`
+	Type       string    `json:"type"`
+	IsNullable bool      `json:"isNullable"`
+	Default    *Default  `json:"default,omitempty"`
+	Identity   *Identity `json:"identity,omitempty"`
+	Generated  string    `json:"generated,omitempty"`
+
+	// DefaultValue is kept to replay old migrations, it's a literal default
+	DefaultValue string `json:"defaultValue,omitempty"`
+}
+
+// GetDefault returns the default of the column, old migrations keep literal defaults in DefaultValue
+func (p AddColumnParams) GetDefault() *Default {
+	if p.Default != nil {
+		return p.Default
+	}
+
+	if p.DefaultValue != "" {
+		return &Default{
+			Kind:  DefaultLiteral,
+			Value: p.DefaultValue,
+		}
+	}
+
+	return nil
+}
+
+type AddSequenceParams struct {
+	Name string `json:"name"`
+	Type string `json:"type,omitempty"`
+	SequenceOptions
+}
+
+type DeleteSequenceParams struct {
+	Name string `json:"name"`
 }
 
 type DeleteColumnParams struct {
@@ -38,16 +119,65 @@ type DeleteColumnParams struct {
 	Column string `json:"column"`
 }
 
+type RenameColumnParams struct {
+	Table   string `json:"table"`
+	Column  string `json:"column"`
+	NewName string `json:"newName"`
+}
+
+// AddPrimaryKeyParams is kept to replay old migrations, new migrations use SetPrimaryKeyParams
 type AddPrimaryKeyParams struct {
 	Table  string `json:"table"`
 	Column string `json:"column"`
 }
 
+// DeletePrimaryKeyParams is kept to replay old migrations, new migrations use DropPrimaryKeyParams
 type DeletePrimaryKeyParams struct {
 	Table  string `json:"table"`
 	Column string `json:"column"`
 }
 
+type SetPrimaryKeyParams struct {
+	Table   string   `json:"table"`
+	Columns []string `json:"columns"`
+	Name    string   `json:"name,omitempty"`
+}
+
+type DropPrimaryKeyParams struct {
+	Table string `json:"table"`
+}
+
+// SetUpdatedAtTriggerParams sets the column to the current time on every update of a row
+type SetUpdatedAtTriggerParams struct {
+	Table  string `json:"table"`
+	Column string `json:"column"`
+}
+
+type DropUpdatedAtTriggerParams struct {
+	Table string `json:"table"`
+}
+
+// SetChangeNotifyParams sends a notification to the channel after every insert, update and delete of a row
+type SetChangeNotifyParams struct {
+	Table   string `json:"table"`
+	Channel string `json:"channel"`
+}
+
+type DropChangeNotifyParams struct {
+	Table string `json:"table"`
+}
+
+// EnableAuditParams records every change of a row of the table to the history table
+type EnableAuditParams struct {
+	Table        string `json:"table"`
+	HistoryTable string `json:"historyTable"`
+}
+
+// DisableAuditParams drops audit triggers, the history table is kept
+type DisableAuditParams struct {
+	Table string `json:"table"`
+}
+
 type AddUniqueConstraintParams struct {
 	Name    string   `json:"name"`
 	Table   string   `json:"table"`
@@ -59,6 +189,21 @@ type DeleteUniqueConstraintParams struct {
 	Name  string `json:"name"`
 }
 
+// AddIndexParams with Concurrently set can't run in a transaction
+type AddIndexParams struct {
+	Name         string   `json:"name"`
+	Table        string   `json:"table"`
+	Columns      []string `json:"columns"`
+	IsUnique     bool     `json:"isUnique,omitempty"`
+	Concurrently bool     `json:"concurrently,omitempty"`
+}
+
+type DeleteIndexParams struct {
+	Table        string `json:"table"`
+	Name         string `json:"name"`
+	Concurrently bool   `json:"concurrently,omitempty"`
+}
+
 type RelationType string
 
 const (
@@ -102,11 +247,15 @@ func GetMigrationsDirectoryPath() (string, error) {
 		return "", err
 	}
 
-	directory := filepath.Join(pwd, migrationsDirectoryName)
+	directory := filepath.Join(pwd, filepath.FromSlash(getMigrationsDirectoryName()))
 	return directory, nil
 }
 
-func AddMigration(description string) (string, error) {
+func AddMigration(description string, format MigrationFormat) (string, error) {
+	return addMigrationWithActions(description, []Action{}, format)
+}
+
+func addMigrationWithActions(description string, actions []Action, format MigrationFormat) (string, error) {
 
 	dateId := time.Now().UTC().Format("20060102150405")
 
@@ -121,16 +270,16 @@ func AddMigration(description string) (string, error) {
 
 	var fileName string
 	if descriptionId != "" {
-		fileName = fmt.Sprintf("%v_%v.json", dateId, descriptionId)
+		fileName = fmt.Sprintf("%v_%v%v", dateId, descriptionId, format.getExtension())
 	} else {
-		fileName = fmt.Sprintf("%v.json", dateId)
+		fileName = fmt.Sprintf("%v%v", dateId, format.getExtension())
 	}
 
 	migration := Migration{
 		SchemaVersion: "1",
 		Id:            dateId,
 		Description:   description,
-		Actions:       []Action{},
+		Actions:       actions,
 	}
 
 	migrationsDir, err := GetMigrationsDirectoryPath()
@@ -144,13 +293,13 @@ func AddMigration(description string) (string, error) {
 			return "", err
 		}
 
-		err = os.Mkdir(migrationsDir, 0777)
+		err = os.MkdirAll(migrationsDir, 0777)
 		if err != nil {
 			return "", err
 		}
 	}
 
-	packedMigration, err := json.MarshalIndent(migration, "", "  ")
+	packedMigration, err := marshalMigration(migration, format)
 	if err != nil {
 		return "", err
 	}
@@ -158,6 +307,17 @@ func AddMigration(description string) (string, error) {
 	return fileName, ioutil.WriteFile(filepath.Join(migrationsDir, fileName), packedMigration, 0777)
 }
 
+// writeMigrationFile keeps the format of the file given by its extension
+func writeMigrationFile(migrationPath string, migration Migration) error {
+
+	packedMigration, err := marshalMigration(migration, getMigrationFileFormat(migrationPath))
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomically(migrationPath, packedMigration)
+}
+
 func getMigrationPath(id string) (string, error) {
 
 	migrationsDirectoryPath, err := GetMigrationsDirectoryPath()
@@ -165,12 +325,14 @@ func getMigrationPath(id string) (string, error) {
 		return "", err
 	}
 
-	configsPathPattern := filepath.Join(migrationsDirectoryPath, id+"*.json")
+	configsPathPattern := filepath.Join(migrationsDirectoryPath, id+"*")
 	files, err := filepath.Glob(configsPathPattern)
 	if err != nil {
 		return "", err
 	}
 
+	files = filterMigrationFiles(files)
+
 	if len(files) == 0 {
 		return "", fmt.Errorf("no such migration")
 	}
@@ -197,8 +359,18 @@ func Get(id string) (*Migration, error) {
 		return nil, err
 	}
 
+	return parseMigration(([]byte)(rawMigration))
+}
+
+// parseMigration reads json and yaml migrations, json always starts with an object
+func parseMigration(rawMigration []byte) (*Migration, error) {
+	trimmedMigration := bytes.TrimSpace(rawMigration)
+	if len(trimmedMigration) > 0 && trimmedMigration[0] != '{' {
+		return parseYamlMigration(rawMigration)
+	}
+
 	var migration Migration
-	err = json.Unmarshal(([]byte)(rawMigration), &migration)
+	err := json.Unmarshal(rawMigration, &migration)
 
 	if err != nil {
 		return nil, fmt.Errorf("can't parse migration: %v/n", err)
@@ -207,29 +379,67 @@ func Get(id string) (*Migration, error) {
 	return &migration, nil
 }
 
-func GetList() (*[]Migration, error) {
+func getMigrationFiles() ([]string, error) {
 
 	migrationsDirectoryPath, err := GetMigrationsDirectoryPath()
 	if err != nil {
 		return nil, err
 	}
 
-	configsPathPattern := filepath.Join(migrationsDirectoryPath, "*.json")
+	return getMigrationFilesFromDirectory(migrationsDirectoryPath)
+}
+
+func getMigrationFilesFromDirectory(migrationsDirectoryPath string) ([]string, error) {
+
+	configsPathPattern := filepath.Join(migrationsDirectoryPath, "*")
 	files, err := filepath.Glob(configsPathPattern)
 
 	if err != nil {
 		return nil, err
 	}
 
+	files = filterMigrationFiles(files)
 	sort.Strings(files)
+	return files, nil
+}
+
+func filterMigrationFiles(files []string) []string {
+	result := []string{}
+	for _, file := range files {
+		if isMigrationFile(file) {
+			result = append(result, file)
+		}
+	}
+
+	return result
+}
+
+func GetList() (*[]Migration, error) {
+
+	migrationsDirectoryPath, err := GetMigrationsDirectoryPath()
+	if err != nil {
+		return nil, err
+	}
+
+	return GetListFromDirectory(migrationsDirectoryPath)
+}
+
+func GetListFromDirectory(migrationsDirectoryPath string) (*[]Migration, error) {
+
+	files, err := getMigrationFilesFromDirectory(migrationsDirectoryPath)
+	if err != nil {
+		return nil, err
+	}
 
 	result := []Migration{}
 
 	for _, migrationPath := range files {
-		_, fileName := filepath.Split(migrationPath)
-		migrationId := strings.TrimSuffix(fileName, ".json")
+		rawMigration, err := ioutil.ReadFile(migrationPath)
+		if err != nil {
+			return nil, fmt.Errorf("can't read migration %v/n", err)
+		}
 
-		migration, err := Get(migrationId)
+		migration, err := parseMigration(rawMigration)
 		if err != nil {
 			return nil, fmt.Errorf("can't read migration %v/n", err)
 		}
@@ -240,7 +450,18 @@ func GetList() (*[]Migration, error) {
 	return &result, err
 }
 
+// newAction packs params of the action the way they are written to migration files
+func newAction(method string, params interface{}) Action {
+	packedParams, _ := json.MarshalIndent(params, "", "  ")
+	return Action{Method: method, Params: (json.RawMessage)(packedParams)}
+}
+
 func addActionToMigrationFile(method string, params interface{}) (string, error) {
+	return addActionsToMigrationFile([]Action{newAction(method, params)})
+}
+
+// addActionsToMigrationFile appends actions to the last migration, nothing is written if any of them is invalid
+func addActionsToMigrationFile(actions []Action) (string, error) {
 
 	migrations, err := GetList()
 	if err != nil {
@@ -252,24 +473,21 @@ func addActionToMigrationFile(method string, params interface{}) (string, error)
 		return "", fmt.Errorf("migration doesn't exist, please add migration/n")
 	}
 
-	_, err = GetSnapshotWithAction(method, params)
+	snapshot, err := GetCurrentSnapshot()
 	if err != nil {
 		return "", err
 	}
 
-	packedParams, _ := json.MarshalIndent(params, "", "  ")
-
-	lastMigration := (*migrations)[migrationsSize-1]
-	action := Action{
-		Method: method,
-		Params: (json.RawMessage)(packedParams),
+	err = applyActionsToSnapshot(snapshot, actions)
+	if err != nil {
+		return "", err
 	}
 
-	lastMigration.Actions = append(lastMigration.Actions, action)
+	lastMigration := (*migrations)[migrationsSize-1]
+	lastMigration.Actions = append(lastMigration.Actions, actions...)
 
-	packedMigration, _ := json.MarshalIndent(lastMigration, "", "  ")
 	migrationPath, _ := getMigrationPath(lastMigration.Id)
-	err = ioutil.WriteFile(migrationPath, packedMigration, 0777)
+	err = writeMigrationFile(migrationPath, lastMigration)
 	if err != nil {
 		return "", fmt.Errorf("can't write migration/n")
 	}
@@ -277,6 +495,25 @@ func addActionToMigrationFile(method string, params interface{}) (string, error)
 	return lastMigration.Id, nil
 }
 
+// writeFileAtomically writes a temporary file and renames it, so the file is never left half-written
+func writeFileAtomically(filePath string, data []byte) error {
+
+	temporaryPath := filePath + ".tmp"
+
+	err := ioutil.WriteFile(temporaryPath, data, 0777)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(temporaryPath, filePath)
+	if err != nil {
+		os.Remove(temporaryPath)
+		return err
+	}
+
+	return nil
+}
+
 func AddTable(tableName string) (string, error) {
 
 	if strings.TrimSpace(tableName) == "" {
@@ -303,7 +540,39 @@ func DeleteTable(tableName string) (string, error) {
 	return addActionToMigrationFile("deleteTable", params)
 }
 
-func AddColumn(tableName string, columnName string, columnType string, isNullable bool, defaultValue string) (string, error) {
+func RenameTable(tableName string, newName string) (string, error) {
+
+	if strings.TrimSpace(tableName) == "" {
+		return "", fmt.Errorf("table name is required /n")
+	}
+
+	if strings.TrimSpace(newName) == "" {
+		return "", fmt.Errorf("new table name is required /n")
+	}
+
+	params := RenameTableParams{
+		Name:    tableName,
+		NewName: newName,
+	}
+
+	return addActionToMigrationFile("renameTable", params)
+}
+
+func SetTableComment(tableName string, comment string) (string, error) {
+
+	if strings.TrimSpace(tableName) == "" {
+		return "", fmt.Errorf("table name is required /n")
+	}
+
+	params := SetTableCommentParams{
+		Table:   tableName,
+		Comment: comment,
+	}
+
+	return addActionToMigrationFile("setTableComment", params)
+}
+
+func SetColumnComment(tableName string, columnName string, comment string) (string, error) {
 
 	if strings.TrimSpace(tableName) == "" {
 		return "", fmt.Errorf("table name is required /n")
@@ -313,16 +582,27 @@ func AddColumn(tableName string, columnName string, columnType string, isNullabl
 		return "", fmt.Errorf("column name is required /n")
 	}
 
-	if strings.TrimSpace(columnType) == "" {
-		return "", fmt.Errorf("column type is required /n")
+	params := SetColumnCommentParams{
+		Table:   tableName,
+		Column:  columnName,
+		Comment: comment,
+	}
+
+	return addActionToMigrationFile("setColumnComment", params)
+}
+
+func AddColumn(params AddColumnParams) (string, error) {
+
+	if strings.TrimSpace(params.Table) == "" {
+		return "", fmt.Errorf("table name is required /n")
 	}
 
-	params := AddColumnParams{
-		Table:        tableName,
-		Column:       columnName,
-		IsNullable:   isNullable,
-		Type:         columnType,
-		DefaultValue: defaultValue,
+	if strings.TrimSpace(params.Column) == "" {
+		return "", fmt.Errorf("column name is required /n")
+	}
+
+	if strings.TrimSpace(params.Type) == "" {
+		return "", fmt.Errorf("column type is required /n")
 	}
 
 	return addActionToMigrationFile("addColumn", params)
@@ -346,7 +626,7 @@ func DeleteColumn(tableName string, columnName string) (string, error) {
 	return addActionToMigrationFile("deleteColumn", params)
 }
 
-func AddPrimaryKey(tableName string, columnName string) (string, error) {
+func RenameColumn(tableName string, columnName string, newName string) (string, error) {
 
 	if strings.TrimSpace(tableName) == "" {
 		return "", fmt.Errorf("table name is required /n")
@@ -356,15 +636,52 @@ func AddPrimaryKey(tableName string, columnName string) (string, error) {
 		return "", fmt.Errorf("column name is required /n")
 	}
 
-	params := AddPrimaryKeyParams{
-		Table:  tableName,
-		Column: columnName,
+	if strings.TrimSpace(newName) == "" {
+		return "", fmt.Errorf("new column name is required /n")
 	}
 
-	return addActionToMigrationFile("addPrimaryKey", params)
+	params := RenameColumnParams{
+		Table:   tableName,
+		Column:  columnName,
+		NewName: newName,
+	}
+
+	return addActionToMigrationFile("renameColumn", params)
 }
 
-func DeletePrimaryKey(tableName string, columnName string) (string, error) {
+func SetPrimaryKey(tableName string, columns []string, constraintName string) (string, error) {
+
+	if strings.TrimSpace(tableName) == "" {
+		return "", fmt.Errorf("table name is required /n")
+	}
+
+	if len(columns) == 0 {
+		return "", fmt.Errorf("columns are required /n")
+	}
+
+	params := SetPrimaryKeyParams{
+		Table:   tableName,
+		Columns: columns,
+		Name:    constraintName,
+	}
+
+	return addActionToMigrationFile("setPrimaryKey", params)
+}
+
+func DropPrimaryKey(tableName string) (string, error) {
+
+	if strings.TrimSpace(tableName) == "" {
+		return "", fmt.Errorf("table name is required /n")
+	}
+
+	params := DropPrimaryKeyParams{
+		Table: tableName,
+	}
+
+	return addActionToMigrationFile("dropPrimaryKey", params)
+}
+
+func SetUpdatedAtTrigger(tableName string, columnName string) (string, error) {
 
 	if strings.TrimSpace(tableName) == "" {
 		return "", fmt.Errorf("table name is required /n")
@@ -374,12 +691,64 @@ func DeletePrimaryKey(tableName string, columnName string) (string, error) {
 		return "", fmt.Errorf("column name is required /n")
 	}
 
-	params := DeletePrimaryKeyParams{
+	params := SetUpdatedAtTriggerParams{
 		Table:  tableName,
 		Column: columnName,
 	}
 
-	return addActionToMigrationFile("deletePrimaryKey", params)
+	return addActionToMigrationFile("setUpdatedAtTrigger", params)
+}
+
+func DropUpdatedAtTrigger(tableName string) (string, error) {
+
+	if strings.TrimSpace(tableName) == "" {
+		return "", fmt.Errorf("table name is required /n")
+	}
+
+	params := DropUpdatedAtTriggerParams{
+		Table: tableName,
+	}
+
+	return addActionToMigrationFile("dropUpdatedAtTrigger", params)
+}
+
+// SetChangeNotify installs notify triggers on tables, the default channel is used if the channel is empty
+func SetChangeNotify(tableNames []string, channel string) (string, error) {
+
+	if len(tableNames) == 0 {
+		return "", fmt.Errorf("table name is required /n")
+	}
+
+	if strings.TrimSpace(channel) == "" {
+		channel = DefaultNotifyChannel
+	}
+
+	actions := []Action{}
+	for _, tableName := range tableNames {
+		if strings.TrimSpace(tableName) == "" {
+			return "", fmt.Errorf("table name is required /n")
+		}
+
+		actions = append(actions, newAction("setChangeNotify", SetChangeNotifyParams{
+			Table:   tableName,
+			Channel: channel,
+		}))
+	}
+
+	return addActionsToMigrationFile(actions)
+}
+
+func DropChangeNotify(tableName string) (string, error) {
+
+	if strings.TrimSpace(tableName) == "" {
+		return "", fmt.Errorf("table name is required /n")
+	}
+
+	params := DropChangeNotifyParams{
+		Table: tableName,
+	}
+
+	return addActionToMigrationFile("dropChangeNotify", params)
 }
 
 func AddRelation(relationName string, relationType RelationType, table string, remoteTable string, columnsMapping []ColumnsMap) (string, error) {
@@ -403,6 +772,91 @@ func AddRelation(relationName string, relationType RelationType, table string, r
 	return addActionToMigrationFile("addRelation", params)
 }
 
+// AddManyToManyRelation adds the junction table with columns referencing
+// primary keys of both tables, its composite primary key and both relations
+func AddManyToManyRelation(table string, remoteTable string, junctionTable string) (string, error) {
+
+	if strings.TrimSpace(table) == "" || strings.TrimSpace(remoteTable) == "" {
+		return "", fmt.Errorf("table names are required /n")
+	}
+
+	if strings.TrimSpace(junctionTable) == "" {
+		junctionTable = table + "_" + remoteTable
+	}
+
+	snapshot, err := GetCurrentSnapshot()
+	if err != nil {
+		return "", err
+	}
+
+	actions, err := getManyToManyActions(snapshot, table, remoteTable, junctionTable)
+	if err != nil {
+		return "", err
+	}
+
+	return addActionsToMigrationFile(actions)
+}
+
+func getManyToManyActions(snapshot *Snapshot, table string, remoteTable string, junctionTable string) ([]Action, error) {
+
+	actions := []Action{}
+
+	actions = append(actions, newAction("addTable", AddTableParams{Name: junctionTable}))
+
+	keyColumns := []string{}
+
+	for index, tableName := range []string{table, remoteTable} {
+		tableSnapshot := getTableFromSnapshot(snapshot, tableName)
+		if tableSnapshot == nil {
+			return nil, fmt.Errorf("table '%v' doesn't exist", tableName)
+		}
+
+		if len(tableSnapshot.PrimaryKeys) == 0 {
+			return nil, fmt.Errorf("table '%v' doesn't have primary key", tableName)
+		}
+
+		prefix := tableName + "_"
+		if index == 1 && table == remoteTable {
+			prefix = "related_" + prefix
+		}
+
+		columnsMapping := []ColumnsMap{}
+
+		for _, key := range tableSnapshot.PrimaryKeys {
+			keyColumn := getColumnFromTable(tableSnapshot, string(key))
+			columnName := prefix + keyColumn.Name
+
+			// Modifiers are kept, so the foreign key has the length and precision of the key,
+			// serial keys are referenced by columns of their integer type without a sequence
+			columnType := keyColumn.Type
+			if serialTypes[strings.ToLower(strings.TrimSpace(columnType))] {
+				columnType = NormalizeColumnType(columnType)
+			}
+
+			actions = append(actions, newAction("addColumn", AddColumnParams{
+				Table:      junctionTable,
+				Column:     columnName,
+				Type:       columnType,
+				IsNullable: false,
+			}))
+
+			keyColumns = append(keyColumns, columnName)
+			columnsMapping = append(columnsMapping, ColumnsMap{Column: columnName, RemoteColumn: keyColumn.Name})
+		}
+
+		actions = append(actions, newAction("addRelation", AddRelationParams{
+			Type:           Object,
+			Name:           fmt.Sprintf("%v_%vfkey", junctionTable, prefix),
+			Table:          junctionTable,
+			RemoteTable:    tableName,
+			ColumnsMapping: columnsMapping,
+		}))
+	}
+
+	actions = append(actions, newAction("setPrimaryKey", SetPrimaryKeyParams{Table: junctionTable, Columns: keyColumns}))
+	return actions, nil
+}
+
 func DeleteRelation(table string, relationName string) (string, error) {
 
 	if strings.TrimSpace(table) == "" {
@@ -461,3 +915,75 @@ func DeleteUniqueConstraint(table string, constrtaintName string) (string, error
 
 	return addActionToMigrationFile("deleteUniqueConstraint", params)
 }
+
+func AddIndex(indexName string, table string, columns []string, isUnique bool, concurrently bool) (string, error) {
+
+	if strings.TrimSpace(table) == "" {
+		return "", fmt.Errorf("table name is required /n")
+	}
+
+	if strings.TrimSpace(indexName) == "" {
+		return "", fmt.Errorf("index name is required /n")
+	}
+
+	if len(columns) == 0 {
+		return "", fmt.Errorf("columns are required /n")
+	}
+
+	params := AddIndexParams{
+		Name:         indexName,
+		Table:        table,
+		Columns:      columns,
+		IsUnique:     isUnique,
+		Concurrently: concurrently,
+	}
+
+	return addActionToMigrationFile("addIndex", params)
+}
+
+func DeleteIndex(table string, indexName string, concurrently bool) (string, error) {
+
+	if strings.TrimSpace(table) == "" {
+		return "", fmt.Errorf("table name is required /n")
+	}
+
+	if strings.TrimSpace(indexName) == "" {
+		return "", fmt.Errorf("index name is required /n")
+	}
+
+	params := DeleteIndexParams{
+		Name:         indexName,
+		Table:        table,
+		Concurrently: concurrently,
+	}
+
+	return addActionToMigrationFile("deleteIndex", params)
+}
+
+func AddSequence(name string, sequenceType string, options SequenceOptions) (string, error) {
+
+	if strings.TrimSpace(name) == "" {
+		return "", fmt.Errorf("sequence name is required /n")
+	}
+
+	params := AddSequenceParams{
+		Name:            name,
+		Type:            sequenceType,
+		SequenceOptions: options,
+	}
+
+	return addActionToMigrationFile("addSequence", params)
+}
+
+func DeleteSequence(name string) (string, error) {
+
+	if strings.TrimSpace(name) == "" {
+		return "", fmt.Errorf("sequence name is required /n")
+	}
+
+	params := DeleteSequenceParams{
+		Name: name,
+	}
+
+	return addActionToMigrationFile("deleteSequence", params)
+}
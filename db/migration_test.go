@@ -0,0 +1,54 @@
+package db
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestGetManyToManyActionsKeyTypes(t *testing.T) {
+
+	snapshot, err := GetSnapshot([]Action{
+		newAction("addTable", AddTableParams{Name: "users"}),
+		newAction("addColumn", AddColumnParams{Table: "users", Column: "id", Type: "char(36)"}),
+		newAction("setPrimaryKey", SetPrimaryKeyParams{Table: "users", Columns: []string{"id"}}),
+		newAction("addTable", AddTableParams{Name: "groups"}),
+		newAction("addColumn", AddColumnParams{Table: "groups", Column: "id", Type: "bigserial"}),
+		newAction("setPrimaryKey", SetPrimaryKeyParams{Table: "groups", Columns: []string{"id"}}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actions, err := getManyToManyActions(snapshot, "users", "groups", "users_groups")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	columnTypes := map[string]string{}
+	for _, action := range actions {
+		if action.Method != "addColumn" {
+			continue
+		}
+
+		params := AddColumnParams{}
+		err = json.Unmarshal(action.Params, &params)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		columnTypes[params.Column] = params.Type
+	}
+
+	if columnTypes["users_id"] != "char(36)" {
+		t.Errorf("expected 'users_id' of type 'char(36)', got %q", columnTypes["users_id"])
+	}
+
+	if columnTypes["groups_id"] != "bigint" {
+		t.Errorf("expected 'groups_id' of type 'bigint', got %q", columnTypes["groups_id"])
+	}
+
+	err = applyActionsToSnapshot(snapshot, actions)
+	if err != nil {
+		t.Fatalf("junction table actions are invalid: %v", err)
+	}
+}
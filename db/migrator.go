@@ -0,0 +1,546 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strconv"
+)
+
+type ProgressEventType string
+
+const (
+	ProgressWaitingForLock     = ProgressEventType("waitingForLock")
+	ProgressMigrationStarted   = ProgressEventType("migrationStarted")
+	ProgressActionApplied      = ProgressEventType("actionApplied")
+	ProgressActionFailed       = ProgressEventType("actionFailed")
+	ProgressMigrationCompleted = ProgressEventType("migrationCompleted")
+	ProgressRollbackStarted    = ProgressEventType("rollbackStarted")
+)
+
+// ProgressEvent describes a step of sync or rollback. ActionIndex of a started
+// migration is the first action to apply, it isn't zero when a sync continues.
+// Schema is set by tenant syncs only.
+type ProgressEvent struct {
+	Type        ProgressEventType
+	Schema      string
+	MigrationId string
+	ActionIndex int
+	Method      string
+	Message     string
+	Err         error
+}
+
+type ProgressFunc func(event ProgressEvent)
+
+func (o SyncOptions) getProgress() ProgressFunc {
+	if o.Progress == nil {
+		return printProgress
+	}
+
+	return o.Progress
+}
+
+func printProgress(event ProgressEvent) {
+	switch event.Type {
+	case ProgressWaitingForLock:
+		fmt.Printf("Waiting for sync lock held by %v\n", event.Message)
+	case ProgressMigrationStarted:
+		if event.ActionIndex > 0 {
+			fmt.Printf("%v continue from action #%v\n", event.MigrationId, event.ActionIndex)
+		} else {
+			fmt.Println(event.MigrationId)
+		}
+	case ProgressRollbackStarted:
+		fmt.Println("rollback", event.MigrationId)
+	case ProgressActionApplied:
+		fmt.Println("#"+strconv.Itoa(event.ActionIndex), event.Method, "success", "")
+	case ProgressActionFailed:
+		fmt.Println("#"+strconv.Itoa(event.ActionIndex), event.Method, "error")
+	case ProgressMigrationCompleted:
+		fmt.Println()
+	}
+}
+
+type MigrationState string
+
+const (
+	MigrationPending = MigrationState("pending")
+	MigrationPartial = MigrationState("partial")
+	MigrationApplied = MigrationState("applied")
+	// MigrationMissing is applied to the database, but doesn't exist in the source
+	MigrationMissing = MigrationState("missing")
+)
+
+type MigrationStatus struct {
+	Id             string
+	Description    string
+	State          MigrationState
+	ActionsCount   int
+	AppliedActions int
+}
+
+// Migrator applies migrations from any file system, for example migrations
+// embedded into a service binary, without the project directory and the CLI
+type Migrator struct {
+	source  fs.FS
+	db      *sql.DB
+	options SyncOptions
+}
+
+// NewMigrator reads migration files from the root of source, use fs.Sub for a subdirectory
+func NewMigrator(source fs.FS, db *sql.DB, options SyncOptions) *Migrator {
+	return &Migrator{
+		source:  source,
+		db:      db,
+		options: options,
+	}
+}
+
+// OpenProjectMigrator connects to the database of the profile and reads migrations
+// from the project directory, empty timeouts of options are taken from the profile.
+// The returned database should be closed by the caller.
+func OpenProjectMigrator(profile Profile, options SyncOptions) (*Migrator, *sql.DB, error) {
+
+	migrationsDirectory, err := GetMigrationsDirectoryPath()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if options.LockTimeout == "" {
+		options.LockTimeout = profile.LockTimeout
+	}
+
+	if options.StatementTimeout == "" {
+		options.StatementTimeout = profile.StatementTimeout
+	}
+
+	db, err := Connect(profile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return NewMigrator(os.DirFS(migrationsDirectory), db, options), db, nil
+}
+
+func GetListFromFS(source fs.FS) (*[]Migration, error) {
+
+	files, err := fs.Glob(source, "*")
+	if err != nil {
+		return nil, err
+	}
+
+	files = filterMigrationFiles(files)
+
+	sort.Strings(files)
+
+	result := []Migration{}
+
+	for _, migrationPath := range files {
+		rawMigration, err := fs.ReadFile(source, migrationPath)
+		if err != nil {
+			return nil, fmt.Errorf("can't read migration %v/n", err)
+		}
+
+		migration, err := parseMigration(rawMigration)
+		if err != nil {
+			return nil, fmt.Errorf("can't read migration %v/n", err)
+		}
+
+		result = append(result, *migration)
+	}
+
+	return &result, nil
+}
+
+func (m *Migrator) Migrations() ([]Migration, error) {
+	migrations, err := GetListFromFS(m.source)
+	if err != nil {
+		return nil, err
+	}
+
+	return *migrations, nil
+}
+
+// Snapshot returns the schema described by all migrations of the source
+func (m *Migrator) Snapshot() (*Snapshot, error) {
+	migrations, err := m.Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	actions := []Action{}
+	for _, migration := range migrations {
+		actions = append(actions, migration.Actions...)
+	}
+
+	return GetSnapshot(actions)
+}
+
+func (m *Migrator) Sync() error {
+	migrations, err := m.Migrations()
+	if err != nil {
+		return err
+	}
+
+	return SyncMigrations(m.db, migrations, m.options)
+}
+
+// SyncTenants applies migrations to every tenant schema, see SyncTenants function
+func (m *Migrator) SyncTenants(tenantOptions TenantOptions) ([]TenantResult, error) {
+	migrations, err := m.Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	return SyncTenants(m.db, migrations, tenantOptions, m.options)
+}
+
+// Status returns states of source migrations followed by applied migrations missing in the source
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+
+	migrations, err := m.Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := getAppliedMigrations(m.db, m.options.Schema)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []MigrationStatus{}
+
+	for _, migration := range migrations {
+		status := MigrationStatus{
+			Id:           migration.Id,
+			Description:  migration.Description,
+			State:        MigrationPending,
+			ActionsCount: len(migration.Actions),
+		}
+
+		appliedMigration, ok := applied[migration.Id]
+		if ok {
+			status.State = appliedMigration.State
+			status.AppliedActions = appliedMigration.AppliedActions
+			delete(applied, migration.Id)
+		}
+
+		result = append(result, status)
+	}
+
+	missing := []MigrationStatus{}
+	for _, appliedMigration := range applied {
+		appliedMigration.State = MigrationMissing
+		missing = append(missing, appliedMigration)
+	}
+
+	sort.Slice(missing, func(i, j int) bool {
+		return missing[i].Id < missing[j].Id
+	})
+
+	return append(result, missing...), nil
+}
+
+// getMigrationsTableName qualifies the migrations table with the schema, the search path is used if it's empty
+func getMigrationsTableName(schema string) string {
+	if schema == "" {
+		return "_migrations"
+	}
+
+	return quoteIdentifier(schema) + "._migrations"
+}
+
+func getAppliedMigrations(db *sql.DB, schema string) (map[string]MigrationStatus, error) {
+
+	result := map[string]MigrationStatus{}
+	tableName := getMigrationsTableName(schema)
+
+	var isTableExist bool
+	err := db.QueryRow("SELECT to_regclass($1) IS NOT NULL", tableName).Scan(&isTableExist)
+	if err != nil {
+		return nil, fmt.Errorf("can't read migrations table: %v", err)
+	}
+
+	if !isTableExist {
+		return result, nil
+	}
+
+	rows, err := db.Query(fmt.Sprintf(`
+		SELECT id, data, COALESCE(applied_actions, 0), is_complete
+		FROM %v
+	`, tableName))
+	if err != nil {
+		return nil, fmt.Errorf("can't read migrations table: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, data string
+		var appliedActions int
+		var isComplete bool
+
+		err = rows.Scan(&id, &data, &appliedActions, &isComplete)
+		if err != nil {
+			return nil, fmt.Errorf("can't read migrations table: %v", err)
+		}
+
+		status := MigrationStatus{Id: id, State: MigrationPartial, AppliedActions: appliedActions}
+
+		migration, err := parseMigration([]byte(data))
+		if err == nil {
+			status.Description = migration.Description
+			status.ActionsCount = len(migration.Actions)
+		}
+
+		if isComplete {
+			status.State = MigrationApplied
+			status.AppliedActions = status.ActionsCount
+		}
+
+		result[id] = status
+	}
+
+	return result, rows.Err()
+}
+
+// GetSyncedSnapshot returns the schema of migrations applied to the database, it's
+// read from the migrations table, so cubes get the snapshot without migration files
+func GetSyncedSnapshot(db *sql.DB) (*Snapshot, error) {
+
+	snapshot := newSnapshot()
+
+	var isTableExist bool
+	err := db.QueryRow("SELECT to_regclass('_migrations') IS NOT NULL").Scan(&isTableExist)
+	if err != nil {
+		return nil, fmt.Errorf("can't read migrations table: %v", err)
+	}
+
+	if !isTableExist {
+		return snapshot, nil
+	}
+
+	rows, err := db.Query(`
+		SELECT data, COALESCE(applied_actions, 0), is_complete
+		FROM _migrations
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("can't read migrations table: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data string
+		var appliedActions int
+		var isComplete bool
+
+		err = rows.Scan(&data, &appliedActions, &isComplete)
+		if err != nil {
+			return nil, fmt.Errorf("can't read migrations table: %v", err)
+		}
+
+		migration, err := parseMigration([]byte(data))
+		if err != nil {
+			return nil, err
+		}
+
+		actions := migration.Actions
+		if !isComplete && appliedActions < len(actions) {
+			actions = actions[:appliedActions]
+		}
+
+		err = applyActionsToSnapshot(snapshot, actions)
+		if err != nil {
+			return nil, fmt.Errorf("can't apply synced migration %v: %v", migration.Id, err)
+		}
+	}
+
+	return snapshot, rows.Err()
+}
+
+// IsMigrationApplied checks migrations tables of all schemas of the profile database,
+// so migrations synced to tenant schemas are found too. Partially applied migrations are applied too
+func IsMigrationApplied(profile Profile, migrationId string) (bool, error) {
+
+	db, err := Connect(profile)
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+
+	schemas, err := getMigrationsTableSchemas(db)
+	if err != nil {
+		return false, err
+	}
+
+	for _, schema := range schemas {
+		applied, err := getAppliedMigrations(db, schema)
+		if err != nil {
+			return false, err
+		}
+
+		if _, ok := applied[migrationId]; ok {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// getMigrationsTableSchemas returns schemas which have the migrations table
+func getMigrationsTableSchemas(db *sql.DB) ([]string, error) {
+
+	rows, err := db.Query(`
+		SELECT n.nspname
+		FROM pg_class c
+			JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relname = '_migrations'
+			AND c.relkind = 'r'
+		ORDER BY n.nspname
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("can't read migrations tables: %v", err)
+	}
+	defer rows.Close()
+
+	schemas := []string{}
+	for rows.Next() {
+		var schema string
+
+		err = rows.Scan(&schema)
+		if err != nil {
+			return nil, fmt.Errorf("can't read migrations tables: %v", err)
+		}
+
+		schemas = append(schemas, schema)
+	}
+
+	return schemas, rows.Err()
+}
+
+// Rollback reverts the last applied migration. Reverting actions are found
+// by the diff of snapshots before and after the migration, so dropped
+// tables and columns are created again, but their data isn't restored.
+func (m *Migrator) Rollback() error {
+
+	migrations, err := m.Migrations()
+	if err != nil {
+		return err
+	}
+
+	connection, release, err := openSyncSession(m.db, m.options)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	executor := connectionExecutor{connection: connection}
+	progress := m.options.getProgress()
+
+	state, err := getSyncState(executor)
+	if err != nil {
+		return fmt.Errorf("can't read current migration state: %v", err)
+	}
+
+	if state.partialMigrationId != "" {
+		return fmt.Errorf("migration %v is partially applied, sync it before rollback", state.partialMigrationId)
+	}
+
+	if state.lastMigrationId == "" {
+		return fmt.Errorf("there are no applied migrations")
+	}
+
+	migrationIndex := -1
+	for index, migration := range migrations {
+		if migration.Id == state.lastMigrationId {
+			migrationIndex = index
+			break
+		}
+	}
+
+	if migrationIndex == -1 {
+		return fmt.Errorf("synced migration %v doesn't exist in migrations", state.lastMigrationId)
+	}
+
+	before := newSnapshot()
+	for _, migration := range migrations[:migrationIndex] {
+		err = applyActionsToSnapshot(before, migration.Actions)
+		if err != nil {
+			return err
+		}
+	}
+
+	after, err := copySnapshot(before)
+	if err != nil {
+		return err
+	}
+
+	migration := migrations[migrationIndex]
+	err = applyActionsToSnapshot(after, migration.Actions)
+	if err != nil {
+		return err
+	}
+
+	actions, err := DiffSnapshots(after, before, getRevertedRenames(migration))
+	if err != nil {
+		return fmt.Errorf("can't rollback migration %v: %v", migration.Id, err)
+	}
+
+	progress(ProgressEvent{Type: ProgressRollbackStarted, MigrationId: migration.Id})
+
+	transaction, err := connection.BeginTx(context.Background(), nil)
+	if err != nil {
+		return fmt.Errorf("can't start transaction: %v", err)
+	}
+
+	revertMigration := Migration{Id: migration.Id, Actions: actions}
+	err = applyMigrationActions(transaction, after, revertMigration, 0, len(actions), progress)
+	if err != nil {
+		transaction.Rollback()
+		return fmt.Errorf("can't rollback migration %v: %v\n", migration.Id, err)
+	}
+
+	_, err = transaction.Exec("DELETE FROM _migrations WHERE id = $1", migration.Id)
+	if err != nil {
+		transaction.Rollback()
+		return fmt.Errorf("can't remove migration %v from migrations table: %v\n", migration.Id, err)
+	}
+
+	err = transaction.Commit()
+	if err != nil {
+		return err
+	}
+
+	progress(ProgressEvent{Type: ProgressMigrationCompleted, MigrationId: migration.Id})
+	return nil
+}
+
+// getRevertedRenames confirms renames back to names used before the migration
+func getRevertedRenames(migration Migration) RenameConfirmation {
+
+	renames := map[string]bool{}
+
+	for _, action := range migration.Actions {
+		method, params, err := decodeAction(action.Method, action.Params)
+		if err != nil {
+			continue
+		}
+
+		switch method {
+		case "renameTable":
+			p := params.(RenameTableParams)
+			renames["table:"+p.NewName+":"+p.Name] = true
+		case "renameColumn":
+			p := params.(RenameColumnParams)
+			renames["column:"+p.NewName+":"+p.Column] = true
+		}
+	}
+
+	return func(kind string, table string, name string, newName string) bool {
+		return renames[kind+":"+name+":"+newName]
+	}
+}
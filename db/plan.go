@@ -0,0 +1,88 @@
+package db
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Plan is an ordered list of actions added to the last migration at once, for example
+//
+//	actions:
+//	  - method: addTable
+//	    params:
+//	      name: orders
+//	  - method: addColumn
+//	    params:
+//	      table: orders
+//	      column: total
+//	      type: numeric
+type Plan struct {
+	Actions []YamlAction `yaml:"actions"`
+}
+
+func ReadPlan(planPath string) (*Plan, error) {
+
+	rawPlan, err := ioutil.ReadFile(planPath)
+	if err != nil {
+		return nil, fmt.Errorf("can't read plan: %v", err)
+	}
+
+	var plan Plan
+	err = yaml.UnmarshalStrict(rawPlan, &plan)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse plan: %v", err)
+	}
+
+	return &plan, nil
+}
+
+// ApplyPlan checks all actions of the plan against the current snapshot and
+// appends them to the last migration, nothing is written if any of them is invalid
+func ApplyPlan(planPath string) (string, error) {
+
+	plan, err := ReadPlan(planPath)
+	if err != nil {
+		return "", err
+	}
+
+	if len(plan.Actions) == 0 {
+		return "", fmt.Errorf("plan doesn't have actions")
+	}
+
+	actions, err := plan.getActions()
+	if err != nil {
+		return "", err
+	}
+
+	snapshot, err := GetCurrentSnapshot()
+	if err != nil {
+		return "", err
+	}
+
+	for index, action := range actions {
+		err = applyActionsToSnapshot(snapshot, []Action{action})
+		if err != nil {
+			return "", fmt.Errorf("plan action #%v: %v", index, err)
+		}
+	}
+
+	return addActionsToMigrationFile(actions)
+}
+
+func (p *Plan) getActions() ([]Action, error) {
+
+	actions := []Action{}
+
+	for index, yamlAction := range p.Actions {
+		action, err := yamlAction.getAction()
+		if err != nil {
+			return nil, fmt.Errorf("plan action #%v: %v", index, err)
+		}
+
+		actions = append(actions, *action)
+	}
+
+	return actions, nil
+}
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TablePreset describes columns, the primary key and the updated at trigger
+// added together with a table. Presets are defined in project.json or built in.
+type TablePreset struct {
+	Columns         []Column `json:"columns"`
+	PrimaryKey      []string `json:"primaryKey,omitempty"`
+	UpdatedAtColumn string   `json:"updatedAtColumn,omitempty"`
+}
+
+var standardPresetColumns = []Column{
+	{Name: "id", Type: "uuid", Default: &Default{Kind: DefaultExpression, Value: "gen_random_uuid()"}},
+	{Name: "created_at", Type: "timestamp with time zone", Default: &Default{Kind: DefaultExpression, Value: "now()"}},
+	{Name: "updated_at", Type: "timestamp with time zone", Default: &Default{Kind: DefaultExpression, Value: "now()"}},
+}
+
+var BuiltinTablePresets = map[string]TablePreset{
+	"standard": {
+		Columns:         standardPresetColumns,
+		PrimaryKey:      []string{"id"},
+		UpdatedAtColumn: "updated_at",
+	},
+	"softDelete": {
+		Columns:         append(append([]Column{}, standardPresetColumns...), Column{Name: "deleted_at", Type: "timestamp with time zone", IsNullable: true}),
+		PrimaryKey:      []string{"id"},
+		UpdatedAtColumn: "updated_at",
+	},
+}
+
+func AddTableWithPreset(tableName string, preset TablePreset) (string, error) {
+
+	if strings.TrimSpace(tableName) == "" {
+		return "", fmt.Errorf("table name is required /n")
+	}
+
+	return addActionsToMigrationFile(getTablePresetActions(tableName, preset))
+}
+
+// getTablePresetActions expands the preset into actions, they are validated when added to the migration
+func getTablePresetActions(tableName string, preset TablePreset) []Action {
+
+	actions := []Action{}
+
+	actions = append(actions, newAction("addTable", AddTableParams{Name: tableName}))
+
+	for _, column := range preset.Columns {
+		actions = append(actions, newAction("addColumn", AddColumnParams{
+			Table:      tableName,
+			Column:     column.Name,
+			Type:       column.Type,
+			IsNullable: column.IsNullable,
+			Default:    column.Default,
+			Identity:   column.Identity,
+			Generated:  column.Generated,
+		}))
+
+		if column.Comment != "" {
+			actions = append(actions, newAction("setColumnComment", SetColumnCommentParams{Table: tableName, Column: column.Name, Comment: column.Comment}))
+		}
+	}
+
+	if len(preset.PrimaryKey) > 0 {
+		actions = append(actions, newAction("setPrimaryKey", SetPrimaryKeyParams{Table: tableName, Columns: preset.PrimaryKey}))
+	}
+
+	if preset.UpdatedAtColumn != "" {
+		actions = append(actions, newAction("setUpdatedAtTrigger", SetUpdatedAtTriggerParams{Table: tableName, Column: preset.UpdatedAtColumn}))
+	}
+
+	return actions
+}
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type Profile struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	User     string `json:"user"`
+	Password string `json:"password"`
+	Database string `json:"database"`
+	SslMode  string `json:"sslMode"`
+
+	LockTimeout      string `json:"lockTimeout,omitempty"`
+	StatementTimeout string `json:"statementTimeout,omitempty"`
+}
+
+func (p Profile) ConnectionString() string {
+	sslMode := p.SslMode
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+
+	port := p.Port
+	if port == 0 {
+		port = 5432
+	}
+
+	return fmt.Sprintf("user='%v' password='%v' dbname='%v' host='%v' port=%v sslmode=%v",
+		escapeConnectionValue(p.User),
+		escapeConnectionValue(p.Password),
+		escapeConnectionValue(p.Database),
+		escapeConnectionValue(p.Host),
+		port,
+		sslMode)
+}
+
+func escapeConnectionValue(value string) string {
+	escaped := ""
+
+	for _, char := range value {
+		if char == '\'' || char == '\\' {
+			escaped += "\\"
+		}
+
+		escaped += string(char)
+	}
+
+	return escaped
+}
+
+func Connect(profile Profile) (*sql.DB, error) {
+	db, err := sql.Open("postgres", profile.ConnectionString())
+	if err != nil {
+		return nil, fmt.Errorf("can't connect to db: %v", err)
+	}
+
+	err = db.Ping()
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("can't connect to db: %v", err)
+	}
+
+	return db, nil
+}
+
+func WaitForConnection(profile Profile, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		db, err := Connect(profile)
+		if err == nil {
+			db.Close()
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return err
+		}
+
+		time.Sleep(500 * time.Millisecond)
+	}
+}
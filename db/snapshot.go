@@ -1,25 +1,33 @@
 package db
 
 import (
-	"encoding/json"
 	"fmt"
+	"regexp"
 	"strings"
 )
 
 type Column struct {
-	Name         string `json:"name"`
-	Type         string `json:"type"`
-	IsNullable   bool   `json:"isNullable"`
-	DefaultValue string `json:"defaultValue"`
+	Name       string    `json:"name"`
+	Type       string    `json:"type"`
+	IsNullable bool      `json:"isNullable"`
+	Default    *Default  `json:"default,omitempty"`
+	Identity   *Identity `json:"identity,omitempty"`
+	Generated  string    `json:"generated,omitempty"`
+	IsReadOnly bool      `json:"isReadOnly"`
+	Comment    string    `json:"comment,omitempty"`
 }
 
 type RemoteColumnName string
 
+// Relation of the object type is a foreign key of the table. The foreign key
+// of an array relation is in the remote table, it is named after the relation
+// unless the array relation is linked to an object relation of the remote table.
 type Relation struct {
 	Type           RelationType `json:"type"`
 	Name           string       `json:"name"`
 	RemoteTable    string       `json:"remoteTable"`
 	ColumnsMapping []ColumnsMap `json:"columnsMap"`
+	LinkedRelation string       `json:"linkedRelation,omitempty"`
 }
 
 type UniqueConstraint struct {
@@ -27,16 +35,35 @@ type UniqueConstraint struct {
 	Columns []string `json:"columns"`
 }
 
+type Index struct {
+	Name     string   `json:"name"`
+	Columns  []string `json:"columns"`
+	IsUnique bool     `json:"isUnique,omitempty"`
+}
+
 type Table struct {
 	Name              string             `json:"name"`
+	Comment           string             `json:"comment,omitempty"`
 	Columns           []Column           `json:"columns"`
+	PrimaryKeyName    string             `json:"primaryKeyName"`
 	PrimaryKeys       []ColumnName       `json:"primaryKeys"`
 	Relations         []Relation         `json:"relations"`
 	UniqueConstraints []UniqueConstraint `json:"uniqueConstraints"`
+	Indexes           []Index            `json:"indexes,omitempty"`
+	UpdatedAtColumn   string             `json:"updatedAtColumn,omitempty"`
+	NotifyChannel     string             `json:"notifyChannel,omitempty"`
+	AuditTable        string             `json:"auditTable,omitempty"`
+}
+
+type Sequence struct {
+	Name string `json:"name"`
+	Type string `json:"type,omitempty"`
+	SequenceOptions
 }
 
 type Snapshot struct {
-	Tables []Table `json:"tables"`
+	Tables    []Table    `json:"tables"`
+	Sequences []Sequence `json:"sequences"`
 }
 
 func getActions(migrationVersion string, actionIndex int) (*[]Action, error) {
@@ -68,39 +95,41 @@ func getActions(migrationVersion string, actionIndex int) (*[]Action, error) {
 	return &actions, nil
 }
 
+func newSnapshot() *Snapshot {
+	return &Snapshot{
+		Tables:    []Table{},
+		Sequences: []Sequence{},
+	}
+}
+
 func GetSnapshot(actions []Action) (*Snapshot, error) {
 
-	snapshot := Snapshot{
-		Tables: []Table{},
-	}
+	snapshot := newSnapshot()
 
-	err := applyActionsToSnapshot(&snapshot, actions)
+	err := applyActionsToSnapshot(snapshot, actions)
 	if err != nil {
 		return nil, err
 	}
 
-	return &snapshot, nil
+	return snapshot, nil
 }
 
 func GetSnapshotWithAction(method string, params interface{}) (*Snapshot, error) {
-	pActions, err := getActions("", -1)
+	snapshot, err := GetCurrentSnapshot()
 	if err != nil {
 		return nil, err
 	}
 
-	actions := *pActions
-	packedParams, _ := json.MarshalIndent(params, "", "  ")
-
-	actions = append(actions, Action{
-		Method: method,
-		Params: packedParams,
-	})
+	err = applyActionsToSnapshot(snapshot, []Action{newAction(method, params)})
+	if err != nil {
+		return nil, err
+	}
 
-	return GetSnapshot(actions)
+	return snapshot, nil
 }
 
 func GetCurrentSnapshot() (*Snapshot, error) {
-	return GetSnapshotForVersion("", -1)
+	return getCachedSnapshot()
 }
 
 func GetSnapshotForVersion(migrationId string, actionIndex int) (*Snapshot, error) {
@@ -145,18 +174,36 @@ func applyActionsToSnapshot(snapshot *Snapshot, actions []Action) error {
 		case "deleteTable":
 			err = applyDeleteTableFromSnapshot(snapshot, params.(DeleteTableParams))
 			break
+		case "setTableComment":
+			err = applySetTableCommentToSnapshot(snapshot, params.(SetTableCommentParams))
+			break
+		case "setColumnComment":
+			err = applySetColumnCommentToSnapshot(snapshot, params.(SetColumnCommentParams))
+			break
 		case "addColumn":
 			err = applyAddColumnToSnapshot(snapshot, params.(AddColumnParams))
 			break
 		case "deleteColumn":
 			err = applyDeleteColumnFromSnapshot(snapshot, params.(DeleteColumnParams))
 			break
+		case "addSequence":
+			err = applyAddSequenceToSnapshot(snapshot, params.(AddSequenceParams))
+			break
+		case "deleteSequence":
+			err = applyDeleteSequenceFromSnapshot(snapshot, params.(DeleteSequenceParams))
+			break
 		case "addPrimaryKey":
 			err = applyAddPrimaryKeyToSnapshot(snapshot, params.(AddPrimaryKeyParams))
 			break
 		case "deletePrimaryKey":
 			err = applyDeletePrimaryKeyFromSnapshot(snapshot, params.(DeletePrimaryKeyParams))
 			break
+		case "setPrimaryKey":
+			err = applySetPrimaryKeyToSnapshot(snapshot, params.(SetPrimaryKeyParams))
+			break
+		case "dropPrimaryKey":
+			err = applyDropPrimaryKeyFromSnapshot(snapshot, params.(DropPrimaryKeyParams))
+			break
 		case "addRelation":
 			err = applyAddRelationToSnapshot(snapshot, params.(AddRelationParams))
 			break
@@ -169,6 +216,36 @@ func applyActionsToSnapshot(snapshot *Snapshot, actions []Action) error {
 		case "deleteUniqueConstraint":
 			err = applyDeleteUniqueConstraintFromSnapshot(snapshot, params.(DeleteUniqueConstraintParams))
 			break
+		case "addIndex":
+			err = applyAddIndexToSnapshot(snapshot, params.(AddIndexParams))
+			break
+		case "deleteIndex":
+			err = applyDeleteIndexFromSnapshot(snapshot, params.(DeleteIndexParams))
+			break
+		case "renameTable":
+			err = applyRenameTableToSnapshot(snapshot, params.(RenameTableParams))
+			break
+		case "setUpdatedAtTrigger":
+			err = applySetUpdatedAtTriggerToSnapshot(snapshot, params.(SetUpdatedAtTriggerParams))
+			break
+		case "dropUpdatedAtTrigger":
+			err = applyDropUpdatedAtTriggerFromSnapshot(snapshot, params.(DropUpdatedAtTriggerParams))
+			break
+		case "setChangeNotify":
+			err = applySetChangeNotifyToSnapshot(snapshot, params.(SetChangeNotifyParams))
+			break
+		case "dropChangeNotify":
+			err = applyDropChangeNotifyFromSnapshot(snapshot, params.(DropChangeNotifyParams))
+			break
+		case "enableAudit":
+			err = applyEnableAuditToSnapshot(snapshot, params.(EnableAuditParams))
+			break
+		case "disableAudit":
+			err = applyDisableAuditFromSnapshot(snapshot, params.(DisableAuditParams))
+			break
+		case "renameColumn":
+			err = applyRenameColumnToSnapshot(snapshot, params.(RenameColumnParams))
+			break
 		}
 
 		if err != nil {
@@ -179,6 +256,16 @@ func applyActionsToSnapshot(snapshot *Snapshot, actions []Action) error {
 	return nil
 }
 
+// GetTable returns the table or nil if the snapshot doesn't have it
+func (s *Snapshot) GetTable(tableName string) *Table {
+	return getTableFromSnapshot(s, tableName)
+}
+
+// GetAuditedTable returns the table recording its changes to the history table or nil
+func (s *Snapshot) GetAuditedTable(historyTableName string) *Table {
+	return getAuditedTable(s, historyTableName)
+}
+
 func getTableFromSnapshot(snapshot *Snapshot, tableName string) *Table {
 
 	tables := snapshot.Tables
@@ -219,12 +306,70 @@ func applyDeleteTableFromSnapshot(snapshot *Snapshot, params DeleteTableParams)
 		return fmt.Errorf("table '%v' doesn't exist", params.Name)
 	}
 
+	for _, table := range snapshot.Tables {
+		if table.Name == tableName {
+			continue
+		}
+
+		for _, relation := range table.Relations {
+			if relation.RemoteTable == tableName {
+				return fmt.Errorf("table '%v' is referenced by relation '%v' of table '%v'", tableName, relation.Name, table.Name)
+			}
+		}
+	}
+
+	auditedTable := getAuditedTable(snapshot, tableName)
+	if auditedTable != nil {
+		return fmt.Errorf("table '%v' is history of audited table '%v', disable audit first", tableName, auditedTable.Name)
+	}
+
+	for _, relation := range existingTable.Relations {
+		if relation.Type == Array {
+			return fmt.Errorf("table '%v' has array relation '%v' to table '%v', delete it first", tableName, relation.Name, relation.RemoteTable)
+		}
+	}
+
 	for index, table := range snapshot.Tables {
 		if table.Name != tableName {
 			continue
 		}
 
 		snapshot.Tables = append(snapshot.Tables[:index], snapshot.Tables[index+1:]...)
+		break
+	}
+
+	return nil
+}
+
+// applyRenameTableToSnapshot renames the table and relations pointing to it, constraint names are kept as the database does
+func applyRenameTableToSnapshot(snapshot *Snapshot, params RenameTableParams) error {
+
+	table := getTableFromSnapshot(snapshot, params.Name)
+	if table == nil {
+		return fmt.Errorf("table '%v' doesn't exist", params.Name)
+	}
+
+	if strings.TrimSpace(params.NewName) == "" {
+		return fmt.Errorf("new table name is required")
+	}
+
+	if getTableFromSnapshot(snapshot, params.NewName) != nil {
+		return fmt.Errorf("table '%v' already exist", params.NewName)
+	}
+
+	table.Name = params.NewName
+
+	for tableIndex := range snapshot.Tables {
+		if snapshot.Tables[tableIndex].AuditTable == params.Name {
+			snapshot.Tables[tableIndex].AuditTable = params.NewName
+		}
+
+		relations := snapshot.Tables[tableIndex].Relations
+		for relationIndex := range relations {
+			if relations[relationIndex].RemoteTable == params.Name {
+				relations[relationIndex].RemoteTable = params.NewName
+			}
+		}
 	}
 
 	return nil
@@ -235,16 +380,44 @@ func getColumnFromTable(table *Table, columnName string) *Column {
 	columns := table.Columns
 
 	for index := 0; index < len(columns); index++ {
-		column := columns[index]
+		column := &columns[index]
 
 		if column.Name == columnName {
-			return &column
+			return column
 		}
 	}
 
 	return nil
 }
 
+func applySetTableCommentToSnapshot(snapshot *Snapshot, params SetTableCommentParams) error {
+
+	table := getTableFromSnapshot(snapshot, params.Table)
+	if table == nil {
+		return fmt.Errorf("table '%v' doesn't exist", params.Table)
+	}
+
+	table.Comment = params.Comment
+	return nil
+}
+
+func applySetColumnCommentToSnapshot(snapshot *Snapshot, params SetColumnCommentParams) error {
+
+	table := getTableFromSnapshot(snapshot, params.Table)
+	if table == nil {
+		return fmt.Errorf("table '%v' doesn't exist", params.Table)
+	}
+
+	for index := 0; index < len(table.Columns); index++ {
+		if table.Columns[index].Name == params.Column {
+			table.Columns[index].Comment = params.Comment
+			return nil
+		}
+	}
+
+	return fmt.Errorf("column '%v' doesn't exist", params.Column)
+}
+
 func applyAddColumnToSnapshot(snapshot *Snapshot, params AddColumnParams) error {
 	table := getTableFromSnapshot(snapshot, params.Table)
 	if table == nil {
@@ -253,19 +426,160 @@ func applyAddColumnToSnapshot(snapshot *Snapshot, params AddColumnParams) error
 
 	column := getColumnFromTable(table, params.Column)
 	if column != nil {
-		return fmt.Errorf("column '%v' doesn't exist", params.Column)
+		return fmt.Errorf("column '%v' already exist", params.Column)
+	}
+
+	err := checkColumnGeneration(params)
+	if err != nil {
+		return err
+	}
+
+	err = checkDefault(params.Type, params.GetDefault())
+	if err != nil {
+		return fmt.Errorf("wrong default of column '%v': %v", params.Column, err)
+	}
+
+	isNullable := params.IsNullable
+	if params.Identity != nil {
+		isNullable = false
 	}
 
 	table.Columns = append(table.Columns, Column{
-		Name:         params.Column,
-		Type:         params.Type,
-		IsNullable:   params.IsNullable,
-		DefaultValue: params.DefaultValue,
+		Name:       params.Column,
+		Type:       params.Type,
+		IsNullable: isNullable,
+		Default:    params.GetDefault(),
+		Identity:   params.Identity,
+		Generated:  params.Generated,
+		IsReadOnly: params.Generated != "" || (params.Identity != nil && params.Identity.Generation == IdentityAlways),
+	})
+
+	return nil
+}
+
+var serialTypes = map[string]bool{
+	"serial":      true,
+	"serial2":     true,
+	"serial4":     true,
+	"serial8":     true,
+	"smallserial": true,
+	"bigserial":   true,
+}
+
+func checkColumnGeneration(params AddColumnParams) error {
+
+	if params.Identity == nil && strings.TrimSpace(params.Generated) == "" {
+		return nil
+	}
+
+	if params.Identity != nil && params.Generated != "" {
+		return fmt.Errorf("column '%v' can't be identity and generated at the same time", params.Column)
+	}
+
+	if params.GetDefault() != nil {
+		return fmt.Errorf("column '%v' can't have default value, it's generated by database", params.Column)
+	}
+
+	if params.Identity != nil {
+		if params.Identity.Generation != IdentityAlways && params.Identity.Generation != IdentityByDefault {
+			return fmt.Errorf("wrong identity generation '%v', expected '%v' or '%v'", params.Identity.Generation, IdentityAlways, IdentityByDefault)
+		}
+
+		columnType := strings.ToLower(strings.TrimSpace(params.Type))
+		if serialTypes[columnType] {
+			return fmt.Errorf("identity column '%v' can't have serial type '%v'", params.Column, params.Type)
+		}
+
+		if !integerTypes[NormalizeColumnType(params.Type)] {
+			return fmt.Errorf("identity column '%v' must have integer type, got '%v'", params.Column, params.Type)
+		}
+
+		return checkSequenceOptions(params.Identity.SequenceOptions)
+	}
+
+	if strings.TrimSpace(params.Generated) == "" {
+		return fmt.Errorf("generated expression of column '%v' is empty", params.Column)
+	}
+
+	return nil
+}
+
+func checkSequenceOptions(options SequenceOptions) error {
+
+	if options.Increment != nil && *options.Increment == 0 {
+		return fmt.Errorf("sequence increment can't be zero")
+	}
+
+	if options.MinValue != nil && options.MaxValue != nil && *options.MinValue > *options.MaxValue {
+		return fmt.Errorf("sequence min value %v is greater than max value %v", *options.MinValue, *options.MaxValue)
+	}
+
+	if options.Start != nil && options.MinValue != nil && *options.Start < *options.MinValue {
+		return fmt.Errorf("sequence start %v is less than min value %v", *options.Start, *options.MinValue)
+	}
+
+	if options.Start != nil && options.MaxValue != nil && *options.Start > *options.MaxValue {
+		return fmt.Errorf("sequence start %v is greater than max value %v", *options.Start, *options.MaxValue)
+	}
+
+	if options.Cache != nil && *options.Cache < 1 {
+		return fmt.Errorf("sequence cache must be greater than zero")
+	}
+
+	return nil
+}
+
+func getSequenceFromSnapshot(snapshot *Snapshot, sequenceName string) *Sequence {
+
+	for index := 0; index < len(snapshot.Sequences); index++ {
+		if snapshot.Sequences[index].Name == sequenceName {
+			return &snapshot.Sequences[index]
+		}
+	}
+
+	return nil
+}
+
+func applyAddSequenceToSnapshot(snapshot *Snapshot, params AddSequenceParams) error {
+
+	if strings.TrimSpace(params.Name) == "" {
+		return fmt.Errorf("sequence name is required")
+	}
+
+	if getSequenceFromSnapshot(snapshot, params.Name) != nil {
+		return fmt.Errorf("sequence '%v' already exist", params.Name)
+	}
+
+	if params.Type != "" && !integerTypes[NormalizeColumnType(params.Type)] {
+		return fmt.Errorf("sequence '%v' must have integer type, got '%v'", params.Name, params.Type)
+	}
+
+	err := checkSequenceOptions(params.SequenceOptions)
+	if err != nil {
+		return err
+	}
+
+	snapshot.Sequences = append(snapshot.Sequences, Sequence{
+		Name:            params.Name,
+		Type:            params.Type,
+		SequenceOptions: params.SequenceOptions,
 	})
 
 	return nil
 }
 
+func applyDeleteSequenceFromSnapshot(snapshot *Snapshot, params DeleteSequenceParams) error {
+
+	for index, sequence := range snapshot.Sequences {
+		if sequence.Name == params.Name {
+			snapshot.Sequences = append(snapshot.Sequences[:index], snapshot.Sequences[index+1:]...)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("sequence '%v' doesn't exist", params.Name)
+}
+
 func applyDeleteColumnFromSnapshot(snapshot *Snapshot, params DeleteColumnParams) error {
 
 	table := getTableFromSnapshot(snapshot, params.Table)
@@ -279,16 +593,159 @@ func applyDeleteColumnFromSnapshot(snapshot *Snapshot, params DeleteColumnParams
 		return fmt.Errorf("column '%v' doesn't exist", params.Column)
 	}
 
+	err := checkColumnIsNotUsed(snapshot, table, columnName)
+	if err != nil {
+		return err
+	}
+
 	for index, column := range table.Columns {
 		if column.Name != columnName {
 			continue
 		}
 
 		table.Columns = append(table.Columns[:index], table.Columns[index+1:]...)
+		break
 	}
 	return nil
 }
 
+// applyRenameColumnToSnapshot renames the column in keys, constraints, indexes and relations using it
+func applyRenameColumnToSnapshot(snapshot *Snapshot, params RenameColumnParams) error {
+
+	table := getTableFromSnapshot(snapshot, params.Table)
+	if table == nil {
+		return fmt.Errorf("table '%v' doesn't exist", params.Table)
+	}
+
+	column := getColumnFromTable(table, params.Column)
+	if column == nil {
+		return fmt.Errorf("column '%v' doesn't exist", params.Column)
+	}
+
+	if strings.TrimSpace(params.NewName) == "" {
+		return fmt.Errorf("new column name is required")
+	}
+
+	if getColumnFromTable(table, params.NewName) != nil {
+		return fmt.Errorf("column '%v' already exist in table '%v'", params.NewName, table.Name)
+	}
+
+	err := checkAuditColumnIsNotUsed(snapshot, table, params.Column)
+	if err != nil {
+		return err
+	}
+
+	column.Name = params.NewName
+
+	for index, key := range table.PrimaryKeys {
+		if key == ColumnName(params.Column) {
+			table.PrimaryKeys[index] = ColumnName(params.NewName)
+		}
+	}
+
+	for _, constraint := range table.UniqueConstraints {
+		renameInList(constraint.Columns, params.Column, params.NewName)
+	}
+
+	for _, index := range table.Indexes {
+		renameInList(index.Columns, params.Column, params.NewName)
+	}
+
+	if table.UpdatedAtColumn == params.Column {
+		table.UpdatedAtColumn = params.NewName
+	}
+
+	for _, relation := range table.Relations {
+		for index := range relation.ColumnsMapping {
+			if relation.ColumnsMapping[index].Column == params.Column {
+				relation.ColumnsMapping[index].Column = params.NewName
+			}
+		}
+	}
+
+	for _, remoteTable := range snapshot.Tables {
+		for _, relation := range remoteTable.Relations {
+			if relation.RemoteTable != table.Name {
+				continue
+			}
+
+			for index := range relation.ColumnsMapping {
+				if relation.ColumnsMapping[index].RemoteColumn == params.Column {
+					relation.ColumnsMapping[index].RemoteColumn = params.NewName
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func renameInList(items []string, name string, newName string) {
+	for index, item := range items {
+		if item == name {
+			items[index] = newName
+		}
+	}
+}
+
+func checkColumnIsNotUsed(snapshot *Snapshot, table *Table, columnName string) error {
+
+	for _, key := range table.PrimaryKeys {
+		if key == ColumnName(columnName) {
+			return fmt.Errorf("column '%v' is used by primary key of table '%v'", columnName, table.Name)
+		}
+	}
+
+	for _, constraint := range table.UniqueConstraints {
+		for _, constraintColumn := range constraint.Columns {
+			if constraintColumn == columnName {
+				return fmt.Errorf("column '%v' is used by unique constraint '%v' of table '%v'", columnName, constraint.Name, table.Name)
+			}
+		}
+	}
+
+	for _, index := range table.Indexes {
+		for _, indexColumn := range index.Columns {
+			if indexColumn == columnName {
+				return fmt.Errorf("column '%v' is used by index '%v' of table '%v'", columnName, index.Name, table.Name)
+			}
+		}
+	}
+
+	if table.UpdatedAtColumn == columnName {
+		return fmt.Errorf("column '%v' is used by updated at trigger of table '%v'", columnName, table.Name)
+	}
+
+	err := checkAuditColumnIsNotUsed(snapshot, table, columnName)
+	if err != nil {
+		return err
+	}
+
+	for _, relation := range table.Relations {
+		for _, mapping := range relation.ColumnsMapping {
+			if mapping.Column == columnName {
+				return fmt.Errorf("column '%v' is used by relation '%v' of table '%v'", columnName, relation.Name, table.Name)
+			}
+		}
+	}
+
+	for _, remoteTable := range snapshot.Tables {
+		for _, relation := range remoteTable.Relations {
+			if relation.RemoteTable != table.Name {
+				continue
+			}
+
+			for _, mapping := range relation.ColumnsMapping {
+				if mapping.RemoteColumn == columnName {
+					return fmt.Errorf("column '%v' is referenced by relation '%v' of table '%v'", columnName, relation.Name, remoteTable.Name)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
 func applyAddPrimaryKeyToSnapshot(snapshot *Snapshot, params AddPrimaryKeyParams) error {
 
 	table := getTableFromSnapshot(snapshot, params.Table)
@@ -307,7 +764,12 @@ func applyAddPrimaryKeyToSnapshot(snapshot *Snapshot, params AddPrimaryKeyParams
 		}
 	}
 
+	if table.PrimaryKeyName == "" {
+		table.PrimaryKeyName = getDefaultPrimaryKeyName(table.Name)
+	}
+
 	table.PrimaryKeys = append(table.PrimaryKeys, ColumnName(params.Column))
+	setColumnsNotNullable(table, []string{params.Column})
 	return nil
 }
 
@@ -336,6 +798,226 @@ func applyDeletePrimaryKeyFromSnapshot(snapshot *Snapshot, params DeletePrimaryK
 	}
 
 	table.PrimaryKeys = append(table.PrimaryKeys[:keyIndex], table.PrimaryKeys[keyIndex+1:]...)
+	if len(table.PrimaryKeys) == 0 {
+		table.PrimaryKeyName = ""
+	} else {
+		table.PrimaryKeyName = legacyPrimaryKeyName
+	}
+
+	return nil
+}
+
+// legacyPrimaryKeyName is the name of keys recreated by deletePrimaryKey,
+// databases synced by earlier versions have keys with this name
+const legacyPrimaryKeyName = "pkey"
+
+func getDefaultPrimaryKeyName(tableName string) string {
+	return tableName + "_pkey"
+}
+
+// setColumnsNotNullable follows postgres, columns of a primary key become not nullable
+// and stay not nullable after the key is dropped
+func setColumnsNotNullable(table *Table, columns []string) {
+
+	for index := 0; index < len(table.Columns); index++ {
+		for _, columnName := range columns {
+			if table.Columns[index].Name == columnName {
+				table.Columns[index].IsNullable = false
+			}
+		}
+	}
+}
+
+func applySetPrimaryKeyToSnapshot(snapshot *Snapshot, params SetPrimaryKeyParams) error {
+
+	table := getTableFromSnapshot(snapshot, params.Table)
+	if table == nil {
+		return fmt.Errorf("table '%v' doesn't exist", params.Table)
+	}
+
+	if len(params.Columns) == 0 {
+		return fmt.Errorf("columns are required")
+	}
+
+	keys := []ColumnName{}
+
+	for index, columnName := range params.Columns {
+		column := getColumnFromTable(table, columnName)
+		if column == nil {
+			return fmt.Errorf("column '%v' doesn't exist", columnName)
+		}
+
+		for _, previousColumnName := range params.Columns[:index] {
+			if previousColumnName == columnName {
+				return fmt.Errorf("column '%v' is used twice in primary key", columnName)
+			}
+		}
+
+		keys = append(keys, ColumnName(columnName))
+	}
+
+	name := params.Name
+	if strings.TrimSpace(name) == "" {
+		name = getDefaultPrimaryKeyName(table.Name)
+	}
+
+	table.PrimaryKeyName = name
+	table.PrimaryKeys = keys
+	setColumnsNotNullable(table, params.Columns)
+	return nil
+}
+
+func applyDropPrimaryKeyFromSnapshot(snapshot *Snapshot, params DropPrimaryKeyParams) error {
+
+	table := getTableFromSnapshot(snapshot, params.Table)
+	if table == nil {
+		return fmt.Errorf("table '%v' doesn't exist", params.Table)
+	}
+
+	if len(table.PrimaryKeys) == 0 {
+		return fmt.Errorf("primary key of table '%v' doesn't exist", params.Table)
+	}
+
+	table.PrimaryKeyName = ""
+	table.PrimaryKeys = []ColumnName{}
+	return nil
+}
+
+func applySetUpdatedAtTriggerToSnapshot(snapshot *Snapshot, params SetUpdatedAtTriggerParams) error {
+
+	table := getTableFromSnapshot(snapshot, params.Table)
+	if table == nil {
+		return fmt.Errorf("table '%v' doesn't exist", params.Table)
+	}
+
+	column := getColumnFromTable(table, params.Column)
+	if column == nil {
+		return fmt.Errorf("column '%v' doesn't exist", params.Column)
+	}
+
+	if !strings.HasPrefix(NormalizeColumnType(column.Type), "timestamp") {
+		return fmt.Errorf("column '%v' of table '%v' should be a timestamp", params.Column, params.Table)
+	}
+
+	if table.UpdatedAtColumn != "" {
+		return fmt.Errorf("table '%v' already has updated at trigger on column '%v'", params.Table, table.UpdatedAtColumn)
+	}
+
+	table.UpdatedAtColumn = params.Column
+	return nil
+}
+
+func applyDropUpdatedAtTriggerFromSnapshot(snapshot *Snapshot, params DropUpdatedAtTriggerParams) error {
+
+	table := getTableFromSnapshot(snapshot, params.Table)
+	if table == nil {
+		return fmt.Errorf("table '%v' doesn't exist", params.Table)
+	}
+
+	if table.UpdatedAtColumn == "" {
+		return fmt.Errorf("table '%v' doesn't have updated at trigger", params.Table)
+	}
+
+	table.UpdatedAtColumn = ""
+	return nil
+}
+
+func applySetChangeNotifyToSnapshot(snapshot *Snapshot, params SetChangeNotifyParams) error {
+
+	table := getTableFromSnapshot(snapshot, params.Table)
+	if table == nil {
+		return fmt.Errorf("table '%v' doesn't exist", params.Table)
+	}
+
+	if strings.TrimSpace(params.Channel) == "" {
+		return fmt.Errorf("notify channel is required")
+	}
+
+	if table.NotifyChannel != "" {
+		return fmt.Errorf("table '%v' already notifies channel '%v'", params.Table, table.NotifyChannel)
+	}
+
+	table.NotifyChannel = params.Channel
+	return nil
+}
+
+func applyDropChangeNotifyFromSnapshot(snapshot *Snapshot, params DropChangeNotifyParams) error {
+
+	table := getTableFromSnapshot(snapshot, params.Table)
+	if table == nil {
+		return fmt.Errorf("table '%v' doesn't exist", params.Table)
+	}
+
+	if table.NotifyChannel == "" {
+		return fmt.Errorf("table '%v' doesn't have notify trigger", params.Table)
+	}
+
+	table.NotifyChannel = ""
+	return nil
+}
+
+func applyEnableAuditToSnapshot(snapshot *Snapshot, params EnableAuditParams) error {
+
+	table := getTableFromSnapshot(snapshot, params.Table)
+	if table == nil {
+		return fmt.Errorf("table '%v' doesn't exist", params.Table)
+	}
+
+	if table.AuditTable != "" {
+		return fmt.Errorf("table '%v' is already audited to table '%v'", params.Table, table.AuditTable)
+	}
+
+	if params.HistoryTable == params.Table {
+		return fmt.Errorf("table '%v' can't be history of itself", params.Table)
+	}
+
+	historyTable := getTableFromSnapshot(snapshot, params.HistoryTable)
+	if historyTable == nil {
+		return fmt.Errorf("history table '%v' doesn't exist", params.HistoryTable)
+	}
+
+	if historyTable.AuditTable != "" {
+		return fmt.Errorf("history table '%v' can't be audited", params.HistoryTable)
+	}
+
+	auditedTable := getAuditedTable(snapshot, params.HistoryTable)
+	if auditedTable != nil {
+		return fmt.Errorf("table '%v' is already history of table '%v'", params.HistoryTable, auditedTable.Name)
+	}
+
+	err := checkAuditHistoryTable(historyTable)
+	if err != nil {
+		return err
+	}
+
+	table.AuditTable = params.HistoryTable
+	return nil
+}
+
+func applyDisableAuditFromSnapshot(snapshot *Snapshot, params DisableAuditParams) error {
+
+	table := getTableFromSnapshot(snapshot, params.Table)
+	if table == nil {
+		return fmt.Errorf("table '%v' doesn't exist", params.Table)
+	}
+
+	if table.AuditTable == "" {
+		return fmt.Errorf("table '%v' isn't audited", params.Table)
+	}
+
+	table.AuditTable = ""
+	return nil
+}
+
+// getAuditedTable returns the table recording changes to the history table
+func getAuditedTable(snapshot *Snapshot, historyTableName string) *Table {
+
+	for index := range snapshot.Tables {
+		if snapshot.Tables[index].AuditTable == historyTableName {
+			return &snapshot.Tables[index]
+		}
+	}
+
 	return nil
 }
 
@@ -355,15 +1037,81 @@ func applyAddRelationToSnapshot(snapshot *Snapshot, params AddRelationParams) er
 		return fmt.Errorf("remote table '%v' doesn't exist", params.RemoteTable)
 	}
 
+	if params.Type != Object && params.Type != Array {
+		return fmt.Errorf("wrong relation type '%v', expected '%v' or '%v'", params.Type, Object, Array)
+	}
+
+	for _, relation := range table.Relations {
+		if relation.Name == params.Name {
+			return fmt.Errorf("relation '%v' already exist", params.Name)
+		}
+	}
+
+	if len(params.ColumnsMapping) == 0 {
+		return fmt.Errorf("columns mapping is required")
+	}
+
+	for _, mapping := range params.ColumnsMapping {
+		column := getColumnFromTable(table, mapping.Column)
+		if column == nil {
+			return fmt.Errorf("column '%v' doesn't exist in table '%v'", mapping.Column, table.Name)
+		}
+
+		remoteColumn := getColumnFromTable(remoteTable, mapping.RemoteColumn)
+		if remoteColumn == nil {
+			return fmt.Errorf("column '%v' doesn't exist in remote table '%v'", mapping.RemoteColumn, remoteTable.Name)
+		}
+
+		if !isCompatibleColumnTypes(column.Type, remoteColumn.Type) {
+			return fmt.Errorf("type '%v' of column '%v.%v' is not compatible with type '%v' of column '%v.%v'",
+				column.Type, table.Name, column.Name, remoteColumn.Type, remoteTable.Name, remoteColumn.Name)
+		}
+	}
+
+	linkedRelation := ""
+	if params.Type == Array {
+		linkedRelation = findLinkedObjectRelation(remoteTable, params)
+
+		if linkedRelation == "" && getRelationFromTable(remoteTable, params.Name) != nil {
+			return fmt.Errorf("foreign key of array relation '%v' conflicts with relation '%v' of table '%v'", params.Name, params.Name, remoteTable.Name)
+		}
+	}
+
 	table.Relations = append(table.Relations, Relation{
 		Name:           params.Name,
 		Type:           params.Type,
 		RemoteTable:    params.RemoteTable,
 		ColumnsMapping: params.ColumnsMapping,
+		LinkedRelation: linkedRelation,
 	})
 	return nil
 }
 
+// findLinkedObjectRelation returns the object relation of the remote table which is the
+// reverse of the array relation, so the array relation doesn't need its own foreign key
+func findLinkedObjectRelation(remoteTable *Table, params AddRelationParams) string {
+
+	for _, relation := range remoteTable.Relations {
+		if relation.Type == Array || relation.RemoteTable != params.Table || len(relation.ColumnsMapping) != len(params.ColumnsMapping) {
+			continue
+		}
+
+		isReverse := true
+		for index, mapping := range relation.ColumnsMapping {
+			if mapping.Column != params.ColumnsMapping[index].RemoteColumn || mapping.RemoteColumn != params.ColumnsMapping[index].Column {
+				isReverse = false
+				break
+			}
+		}
+
+		if isReverse {
+			return relation.Name
+		}
+	}
+
+	return ""
+}
+
 func applyDeleteRelationFromSnapshot(snapshot *Snapshot, params DeleteRelationParams) error {
 
 	if strings.TrimSpace(params.Name) == "" {
@@ -375,6 +1123,14 @@ func applyDeleteRelationFromSnapshot(snapshot *Snapshot, params DeleteRelationPa
 		return fmt.Errorf("table '%v' doesn't exist", params.Table)
 	}
 
+	for _, remoteTable := range snapshot.Tables {
+		for _, relation := range remoteTable.Relations {
+			if relation.Type == Array && relation.RemoteTable == table.Name && relation.LinkedRelation == params.Name {
+				return fmt.Errorf("relation '%v' is linked to array relation '%v' of table '%v'", params.Name, relation.Name, remoteTable.Name)
+			}
+		}
+	}
+
 	for index, relation := range table.Relations {
 		if relation.Name == params.Name {
 			table.Relations = append(table.Relations[:index], table.Relations[index+1:]...)
@@ -396,10 +1152,16 @@ func applyAddUniqueConstraintToSnapshot(snapshot *Snapshot, params AddUniqueCons
 		return fmt.Errorf("table '%v' doesn't exist", params.Table)
 	}
 
-	if len(params.Name) == 0 {
+	if len(params.Columns) == 0 {
 		return fmt.Errorf("columns are required")
 	}
 
+	for _, columnName := range params.Columns {
+		if getColumnFromTable(table, columnName) == nil {
+			return fmt.Errorf("column '%v' doesn't exist in table '%v'", columnName, table.Name)
+		}
+	}
+
 	table.UniqueConstraints = append(table.UniqueConstraints, UniqueConstraint{
 		Name:    params.Name,
 		Columns: params.Columns,
@@ -427,3 +1189,180 @@ func applyDeleteUniqueConstraintFromSnapshot(snapshot *Snapshot, params DeleteUn
 
 	return fmt.Errorf("constraint \"%v\" doesn't exist", params.Name)
 }
+
+// getIndexFromSnapshot looks for the index in all tables, index names are unique in the schema
+func getIndexFromSnapshot(snapshot *Snapshot, indexName string) (*Table, int) {
+
+	for tableIndex := range snapshot.Tables {
+		table := &snapshot.Tables[tableIndex]
+
+		for index, tableIndexItem := range table.Indexes {
+			if tableIndexItem.Name == indexName {
+				return table, index
+			}
+		}
+	}
+
+	return nil, -1
+}
+
+func applyAddIndexToSnapshot(snapshot *Snapshot, params AddIndexParams) error {
+
+	if strings.TrimSpace(params.Name) == "" {
+		return fmt.Errorf("index name is required")
+	}
+
+	table := getTableFromSnapshot(snapshot, params.Table)
+	if table == nil {
+		return fmt.Errorf("table '%v' doesn't exist", params.Table)
+	}
+
+	if len(params.Columns) == 0 {
+		return fmt.Errorf("columns are required")
+	}
+
+	existingTable, _ := getIndexFromSnapshot(snapshot, params.Name)
+	if existingTable != nil {
+		return fmt.Errorf("index '%v' already exist in table '%v'", params.Name, existingTable.Name)
+	}
+
+	for _, columnName := range params.Columns {
+		if getColumnFromTable(table, columnName) == nil {
+			return fmt.Errorf("column '%v' doesn't exist in table '%v'", columnName, table.Name)
+		}
+	}
+
+	table.Indexes = append(table.Indexes, Index{
+		Name:     params.Name,
+		Columns:  params.Columns,
+		IsUnique: params.IsUnique,
+	})
+	return nil
+}
+
+func applyDeleteIndexFromSnapshot(snapshot *Snapshot, params DeleteIndexParams) error {
+
+	if strings.TrimSpace(params.Name) == "" {
+		return fmt.Errorf("index name is required")
+	}
+
+	table := getTableFromSnapshot(snapshot, params.Table)
+	if table == nil {
+		return fmt.Errorf("table '%v' doesn't exist", params.Table)
+	}
+
+	for index, tableIndex := range table.Indexes {
+		if tableIndex.Name == params.Name {
+			table.Indexes = append(table.Indexes[:index], table.Indexes[index+1:]...)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("index '%v' doesn't exist in table '%v'", params.Name, table.Name)
+}
+
+var columnTypeAliases = map[string]string{
+	"int":                         "integer",
+	"int4":                        "integer",
+	"serial":                      "integer",
+	"serial4":                     "integer",
+	"int2":                        "smallint",
+	"smallserial":                 "smallint",
+	"serial2":                     "smallint",
+	"int8":                        "bigint",
+	"bigserial":                   "bigint",
+	"serial8":                     "bigint",
+	"float4":                      "real",
+	"float8":                      "double precision",
+	"float":                       "double precision",
+	"decimal":                     "numeric",
+	"bool":                        "boolean",
+	"varchar":                     "character varying",
+	"char":                        "character",
+	"bpchar":                      "character",
+	"timestamp without time zone": "timestamp",
+	"timestamptz":                 "timestamp with time zone",
+	"time without time zone":      "time",
+	"timetz":                      "time with time zone",
+}
+
+var arrayTypeSuffixPattern = regexp.MustCompile(`(\[[0-9]*\]|\barray(\[[0-9]*\])?)$`)
+
+// splitColumnType returns the type name with aliases resolved and type modifiers
+// without spaces, "varchar(20)[]" is "character varying[]" and "(20)"
+func splitColumnType(columnType string) (string, string) {
+	normalized := strings.ToLower(strings.TrimSpace(columnType))
+	normalized = strings.Join(strings.Fields(normalized), " ")
+
+	// Sizes of array dimensions are ignored by Postgres
+	dimensions := ""
+	for arrayTypeSuffixPattern.MatchString(normalized) {
+		dimensions += "[]"
+		normalized = strings.TrimSpace(arrayTypeSuffixPattern.ReplaceAllString(normalized, ""))
+	}
+
+	modifiers := ""
+	modifierIndex := strings.Index(normalized, "(")
+	if modifierIndex >= 0 {
+		closeIndex := strings.LastIndex(normalized, ")")
+		suffix := ""
+		if closeIndex > modifierIndex {
+			modifiers = strings.Replace(normalized[modifierIndex:closeIndex+1], " ", "", -1)
+			suffix = normalized[closeIndex+1:]
+		}
+		normalized = strings.TrimSpace(strings.TrimSpace(normalized[:modifierIndex]) + suffix)
+	}
+
+	if alias, ok := columnTypeAliases[normalized]; ok {
+		normalized = alias
+	}
+
+	// Postgres reads character without the length as character(1)
+	if normalized == "character" && modifiers == "" {
+		modifiers = "(1)"
+	}
+
+	return normalized + dimensions, modifiers
+}
+
+// NormalizeColumnType returns the type name without modifiers, aliases are replaced by names used by Postgres
+func NormalizeColumnType(columnType string) string {
+	normalized, _ := splitColumnType(columnType)
+	return normalized
+}
+
+// isSameColumnType compares types with their modifiers, varchar(20) and varchar(255) are different types
+func isSameColumnType(columnType string, otherColumnType string) bool {
+	name, modifiers := splitColumnType(columnType)
+	otherName, otherModifiers := splitColumnType(otherColumnType)
+
+	return name == otherName && modifiers == otherModifiers
+}
+
+// Postgres has equality operators between types of one family, so foreign keys
+// can reference columns of another type of the family. Other types should be the same.
+var columnTypeFamilies = map[string]string{
+	"smallint":                 "integer",
+	"integer":                  "integer",
+	"bigint":                   "integer",
+	"real":                     "float",
+	"double precision":         "float",
+	"text":                     "text",
+	"character varying":        "text",
+	"date":                     "datetime",
+	"timestamp":                "datetime",
+	"timestamp with time zone": "datetime",
+}
+
+// isCompatibleColumnTypes checks that a foreign key column can reference the remote column, modifiers are ignored
+func isCompatibleColumnTypes(columnType string, remoteColumnType string) bool {
+	normalizedType := NormalizeColumnType(columnType)
+	normalizedRemoteType := NormalizeColumnType(remoteColumnType)
+
+	if normalizedType == normalizedRemoteType {
+		return true
+	}
+
+	family, ok := columnTypeFamilies[normalizedType]
+	return ok && family == columnTypeFamilies[normalizedRemoteType]
+}
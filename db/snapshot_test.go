@@ -0,0 +1,220 @@
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+// getRelatedTablesActions creates users and posts tables where posts.author_id references users.id
+func getRelatedTablesActions() []Action {
+	return []Action{
+		newAction("addTable", AddTableParams{Name: "users"}),
+		newAction("addColumn", AddColumnParams{Table: "users", Column: "id", Type: "integer"}),
+		newAction("addColumn", AddColumnParams{Table: "users", Column: "email", Type: "varchar(255)"}),
+		newAction("setPrimaryKey", SetPrimaryKeyParams{Table: "users", Columns: []string{"id"}}),
+		newAction("addUniqueConstraint", AddUniqueConstraintParams{Name: "users_email_key", Table: "users", Columns: []string{"email"}}),
+		newAction("addTable", AddTableParams{Name: "posts"}),
+		newAction("addColumn", AddColumnParams{Table: "posts", Column: "id", Type: "bigint"}),
+		newAction("addColumn", AddColumnParams{Table: "posts", Column: "author_id", Type: "bigint"}),
+		newAction("addColumn", AddColumnParams{Table: "posts", Column: "title", Type: "text"}),
+		newAction("addRelation", AddRelationParams{
+			Type:           Object,
+			Name:           "author",
+			Table:          "posts",
+			RemoteTable:    "users",
+			ColumnsMapping: []ColumnsMap{{Column: "author_id", RemoteColumn: "id"}},
+		}),
+	}
+}
+
+func TestSnapshotIntegrityRules(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		action Action
+		err    string
+	}{
+		{
+			name:   "delete referenced table",
+			action: newAction("deleteTable", DeleteTableParams{Name: "users"}),
+			err:    "table 'users' is referenced by relation 'author' of table 'posts'",
+		},
+		{
+			name:   "delete unused column",
+			action: newAction("deleteColumn", DeleteColumnParams{Table: "posts", Column: "title"}),
+		},
+		{
+			name:   "delete column used by primary key",
+			action: newAction("deleteColumn", DeleteColumnParams{Table: "users", Column: "id"}),
+			err:    "column 'id' is used by primary key of table 'users'",
+		},
+		{
+			name:   "delete column used by unique constraint",
+			action: newAction("deleteColumn", DeleteColumnParams{Table: "users", Column: "email"}),
+			err:    "column 'email' is used by unique constraint 'users_email_key' of table 'users'",
+		},
+		{
+			name:   "delete column used by relation",
+			action: newAction("deleteColumn", DeleteColumnParams{Table: "posts", Column: "author_id"}),
+			err:    "column 'author_id' is used by relation 'author' of table 'posts'",
+		},
+		{
+			name: "add relation with missing column",
+			action: newAction("addRelation", AddRelationParams{
+				Type:           Object,
+				Name:           "editor",
+				Table:          "posts",
+				RemoteTable:    "users",
+				ColumnsMapping: []ColumnsMap{{Column: "editor_id", RemoteColumn: "id"}},
+			}),
+			err: "column 'editor_id' doesn't exist in table 'posts'",
+		},
+		{
+			name: "add relation with missing remote column",
+			action: newAction("addRelation", AddRelationParams{
+				Type:           Array,
+				Name:           "posts",
+				Table:          "users",
+				RemoteTable:    "posts",
+				ColumnsMapping: []ColumnsMap{{Column: "id", RemoteColumn: "user_id"}},
+			}),
+			err: "column 'user_id' doesn't exist in remote table 'posts'",
+		},
+		{
+			name: "add relation with incompatible column",
+			action: newAction("addRelation", AddRelationParams{
+				Type:           Object,
+				Name:           "titled_user",
+				Table:          "posts",
+				RemoteTable:    "users",
+				ColumnsMapping: []ColumnsMap{{Column: "title", RemoteColumn: "id"}},
+			}),
+			err: "type 'text' of column 'posts.title' is not compatible with type 'integer' of column 'users.id'",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := GetSnapshot(append(getRelatedTablesActions(), test.action))
+
+			if test.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected error %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestDeleteReferencedColumnFromRemoteTable(t *testing.T) {
+
+	actions := append(getRelatedTablesActions(),
+		newAction("dropPrimaryKey", DropPrimaryKeyParams{Table: "users"}),
+		newAction("deleteColumn", DeleteColumnParams{Table: "users", Column: "id"}),
+	)
+
+	_, err := GetSnapshot(actions)
+
+	expected := "column 'id' is referenced by relation 'author' of table 'posts'"
+	if err == nil || !strings.Contains(err.Error(), expected) {
+		t.Fatalf("expected error %q, got %v", expected, err)
+	}
+}
+
+func TestIsCompatibleColumnTypes(t *testing.T) {
+
+	tests := []struct {
+		columnType       string
+		remoteColumnType string
+		expected         bool
+	}{
+		{"integer", "int4", true},
+		{"integer", "bigint", true},
+		{"smallint", "bigserial", true},
+		{"varchar(20)", "text", true},
+		{"timestamptz", "date", true},
+		{"real", "double precision", true},
+		{"int[]", "integer[]", true},
+		{"numeric", "integer", false},
+		{"text", "integer", false},
+		{"uuid", "text", false},
+		{"integer[]", "integer", false},
+	}
+
+	for _, test := range tests {
+		actual := isCompatibleColumnTypes(test.columnType, test.remoteColumnType)
+		if actual != test.expected {
+			t.Errorf("isCompatibleColumnTypes(%q, %q) = %v, expected %v", test.columnType, test.remoteColumnType, actual, test.expected)
+		}
+	}
+}
+
+func TestIsSameColumnType(t *testing.T) {
+
+	tests := []struct {
+		columnType      string
+		otherColumnType string
+		expected        bool
+	}{
+		{"int", "integer", true},
+		{"int[]", "integer[]", true},
+		{"INT4 ARRAY", "integer[]", true},
+		{"varchar(20)[]", "character varying(20)[]", true},
+		{"numeric(10, 2)", "decimal(10,2)", true},
+		{"timestamptz", "timestamp with time zone", true},
+		{"char", "character(1)", true},
+		{"varchar(20)", "varchar(255)", false},
+		{"varchar(20)[]", "character varying[]", false},
+		{"integer", "bigint", false},
+		{"varchar", "text", false},
+		{"char", "text", false},
+	}
+
+	for _, test := range tests {
+		actual := isSameColumnType(test.columnType, test.otherColumnType)
+		if actual != test.expected {
+			t.Errorf("isSameColumnType(%q, %q) = %v, expected %v", test.columnType, test.otherColumnType, actual, test.expected)
+		}
+	}
+}
+
+func TestDeleteLegacyPrimaryKey(t *testing.T) {
+
+	actions := []Action{
+		newAction("addTable", AddTableParams{Name: "tags"}),
+		newAction("addColumn", AddColumnParams{Table: "tags", Column: "name", Type: "text"}),
+		newAction("addColumn", AddColumnParams{Table: "tags", Column: "scope", Type: "text"}),
+		newAction("addPrimaryKey", AddPrimaryKeyParams{Table: "tags", Column: "name"}),
+		newAction("addPrimaryKey", AddPrimaryKeyParams{Table: "tags", Column: "scope"}),
+		newAction("deletePrimaryKey", DeletePrimaryKeyParams{Table: "tags", Column: "scope"}),
+	}
+
+	snapshot, err := GetSnapshot(actions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := snapshot.GetTable("tags")
+	if len(table.PrimaryKeys) != 1 || table.PrimaryKeys[0] != "name" {
+		t.Fatalf("expected primary key on 'name', got %v", table.PrimaryKeys)
+	}
+
+	if table.PrimaryKeyName != legacyPrimaryKeyName {
+		t.Fatalf("expected primary key name %q, got %q", legacyPrimaryKeyName, table.PrimaryKeyName)
+	}
+
+	snapshot, err = GetSnapshot(append(actions, newAction("deletePrimaryKey", DeletePrimaryKeyParams{Table: "tags", Column: "name"})))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table = snapshot.GetTable("tags")
+	if len(table.PrimaryKeys) != 0 || table.PrimaryKeyName != "" {
+		t.Fatalf("expected no primary key, got %q %v", table.PrimaryKeyName, table.PrimaryKeys)
+	}
+}
@@ -1,22 +1,23 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"log"
-	"strconv"
 	"strings"
+	"time"
 )
 
-func applyAddTable(transaction *sql.Tx, params AddTableParams) error {
+func applyAddTable(executor queryExecutor, params AddTableParams) error {
 
 	if strings.TrimSpace(params.Name) == "" {
 		return fmt.Errorf("table is required")
 	}
 
 	query := fmt.Sprintf("CREATE TABLE \"%v\" ();", params.Name)
-	_, err := transaction.Exec(query)
+	_, err := executor.Exec(query)
 	if err != nil {
 		return fmt.Errorf("can't create table %v: %v\n", params.Name, err)
 	}
@@ -24,14 +25,14 @@ func applyAddTable(transaction *sql.Tx, params AddTableParams) error {
 	return nil
 }
 
-func applyDeleteTable(transaction *sql.Tx, params DeleteTableParams) error {
+func applyDeleteTable(executor queryExecutor, params DeleteTableParams) error {
 
 	if strings.TrimSpace(params.Name) == "" {
 		return fmt.Errorf("table is required")
 	}
 
 	query := fmt.Sprintf("DROP TABLE \"%v\"", params.Name)
-	_, err := transaction.Exec(query)
+	_, err := executor.Exec(query)
 
 	if err != nil {
 		return fmt.Errorf("can't delete table %v: %v\n", params.Name, err)
@@ -40,7 +41,39 @@ func applyDeleteTable(transaction *sql.Tx, params DeleteTableParams) error {
 	return nil
 }
 
-func applyAddColumn(transaction *sql.Tx, params AddColumnParams) error {
+func formatComment(comment string) string {
+	if comment == "" {
+		return "NULL"
+	}
+
+	return quoteLiteral(comment)
+}
+
+func applySetTableComment(executor queryExecutor, params SetTableCommentParams) error {
+
+	query := fmt.Sprintf(`COMMENT ON TABLE "%v" IS %v`, params.Table, formatComment(params.Comment))
+
+	_, err := executor.Exec(query)
+	if err != nil {
+		return fmt.Errorf("can't set comment of table '%v': %v\n", params.Table, err)
+	}
+
+	return nil
+}
+
+func applySetColumnComment(executor queryExecutor, params SetColumnCommentParams) error {
+
+	query := fmt.Sprintf(`COMMENT ON COLUMN "%v"."%v" IS %v`, params.Table, params.Column, formatComment(params.Comment))
+
+	_, err := executor.Exec(query)
+	if err != nil {
+		return fmt.Errorf("can't set comment of column '%v' at table '%v': %v\n", params.Column, params.Table, err)
+	}
+
+	return nil
+}
+
+func applyAddColumn(executor queryExecutor, params AddColumnParams) error {
 
 	if strings.TrimSpace(params.Table) == "" {
 		return fmt.Errorf("table is required")
@@ -57,16 +90,39 @@ func applyAddColumn(transaction *sql.Tx, params AddColumnParams) error {
 	}
 
 	defaultValueParam := ""
-	if params.DefaultValue != "" {
-		defaultValueParam = fmt.Sprintf("DEFAULT '%v';", params.DefaultValue)
+	defaultValue := params.GetDefault()
+	if defaultValue != nil {
+		formattedDefault, err := formatDefault(columnType, defaultValue)
+		if err != nil {
+			return fmt.Errorf("wrong default of column '%v': %v", params.Column, err)
+		}
+
+		defaultValueParam = "DEFAULT " + formattedDefault
+	}
+
+	generationParam := ""
+	if params.Identity != nil {
+		generation := "ALWAYS"
+		if params.Identity.Generation == IdentityByDefault {
+			generation = "BY DEFAULT"
+		}
+
+		generationParam = fmt.Sprintf("GENERATED %v AS IDENTITY", generation)
+
+		sequenceOptions := formatSequenceOptions(params.Identity.SequenceOptions)
+		if sequenceOptions != "" {
+			generationParam += fmt.Sprintf(" (%v)", sequenceOptions)
+		}
+	} else if params.Generated != "" {
+		generationParam = fmt.Sprintf("GENERATED ALWAYS AS (%v) STORED", params.Generated)
 	}
 
 	query := fmt.Sprintf(`
 		ALTER TABLE "%v"
-			ADD COLUMN "%v" %v %v %v
-	`, params.Table, params.Column, columnType, notNullParam, defaultValueParam)
+			ADD COLUMN "%v" %v %v %v %v
+	`, params.Table, params.Column, columnType, generationParam, notNullParam, defaultValueParam)
 
-	_, err := transaction.Exec(query)
+	_, err := executor.Exec(query)
 	if err != nil {
 		return fmt.Errorf("can't add column '%v' to table '%v': %v\n", params.Column, params.Table, err)
 	}
@@ -74,14 +130,74 @@ func applyAddColumn(transaction *sql.Tx, params AddColumnParams) error {
 	return nil
 }
 
-func applyDeleteColumn(transaction *sql.Tx, params DeleteColumnParams) error {
+func formatSequenceOptions(options SequenceOptions) string {
+
+	parts := []string{}
+
+	if options.Increment != nil {
+		parts = append(parts, fmt.Sprintf("INCREMENT BY %v", *options.Increment))
+	}
+
+	if options.MinValue != nil {
+		parts = append(parts, fmt.Sprintf("MINVALUE %v", *options.MinValue))
+	}
+
+	if options.MaxValue != nil {
+		parts = append(parts, fmt.Sprintf("MAXVALUE %v", *options.MaxValue))
+	}
+
+	if options.Start != nil {
+		parts = append(parts, fmt.Sprintf("START WITH %v", *options.Start))
+	}
+
+	if options.Cache != nil {
+		parts = append(parts, fmt.Sprintf("CACHE %v", *options.Cache))
+	}
+
+	if options.Cycle {
+		parts = append(parts, "CYCLE")
+	}
+
+	return strings.Join(parts, " ")
+}
+
+func applyAddSequence(executor queryExecutor, params AddSequenceParams) error {
+
+	typeParam := ""
+	if params.Type != "" {
+		typeParam = "AS " + params.Type
+	}
+
+	query := fmt.Sprintf(`CREATE SEQUENCE "%v" %v %v`, params.Name, typeParam, formatSequenceOptions(params.SequenceOptions))
+
+	_, err := executor.Exec(query)
+	if err != nil {
+		return fmt.Errorf("can't add sequence '%v': %v\n", params.Name, err)
+	}
+
+	return nil
+}
+
+func applyDeleteSequence(executor queryExecutor, params DeleteSequenceParams) error {
+
+	query := fmt.Sprintf(`DROP SEQUENCE "%v"`, params.Name)
+
+	_, err := executor.Exec(query)
+	if err != nil {
+		return fmt.Errorf("can't delete sequence '%v': %v\n", params.Name, err)
+	}
+
+	return nil
+}
+
+func applyDeleteColumn(executor queryExecutor, params DeleteColumnParams) error {
 
 	query := fmt.Sprintf(`
 		ALTER TABLE "%v"
 			DROP COLUMN "%v"
 	`, params.Table, params.Column)
 
-	_, err := transaction.Exec(query)
+	_, err := executor.Exec(query)
 	if err != nil {
 		return fmt.Errorf("can't delete column '%v' at table '%v': %v\n", params.Column, params.Table, err)
 	}
@@ -89,124 +205,391 @@ func applyDeleteColumn(transaction *sql.Tx, params DeleteColumnParams) error {
 	return nil
 }
 
-func applyAddPrimaryKey(transaction *sql.Tx, migrationId string, actionIndex int, params AddPrimaryKeyParams) error {
+func applyRenameTable(executor queryExecutor, snapshot *Snapshot, params RenameTableParams) error {
 
-	snapshot, err := GetSnapshotForVersion(migrationId, actionIndex)
+	query := fmt.Sprintf(`ALTER TABLE "%v" RENAME TO "%v"`, params.Name, params.NewName)
+
+	_, err := executor.Exec(query)
 	if err != nil {
-		return err
+		return fmt.Errorf("can't rename table '%v' to '%v': %v\n", params.Name, params.NewName, err)
 	}
 
-	table := getTableFromSnapshot(snapshot, params.Table)
-	if table == nil {
-		return fmt.Errorf("table '%v' doesn't exist", params.Table)
-	}
+	// The audit trigger gets the history table name as an argument, it's created again with the new name
+	auditedTable := getAuditedTable(snapshot, params.Name)
+	if auditedTable != nil {
+		err = applyDisableAudit(executor, DisableAuditParams{Table: auditedTable.Name})
+		if err != nil {
+			return err
+		}
 
-	column := getColumnFromTable(table, params.Column)
-	if column == nil {
-		return fmt.Errorf("column '%v' doesn't exist", params.Column)
+		return applyEnableAudit(executor, EnableAuditParams{Table: auditedTable.Name, HistoryTable: params.NewName})
 	}
 
-	constraintName := params.Table + "_pkey"
+	return nil
+}
 
-	if len(table.PrimaryKeys) > 1 {
-		query := fmt.Sprintf(`
-			ALTER TABLE "%v"
-				DROP CONSTRAINT "%v"
-		`, params.Table, constraintName)
+func applyRenameColumn(executor queryExecutor, snapshot *Snapshot, params RenameColumnParams) error {
 
-		_, err := transaction.Exec(query)
+	query := fmt.Sprintf(`ALTER TABLE "%v" RENAME COLUMN "%v" TO "%v"`, params.Table, params.Column, params.NewName)
+
+	_, err := executor.Exec(query)
+	if err != nil {
+		return fmt.Errorf("can't rename column '%v' at table '%v': %v\n", params.Column, params.Table, err)
+	}
+
+	// The trigger gets the column name as an argument, it's created again with the new name
+	table := getTableFromSnapshot(snapshot, params.Table)
+	if table != nil && table.UpdatedAtColumn == params.Column {
+		err = applyDropUpdatedAtTrigger(executor, DropUpdatedAtTriggerParams{Table: params.Table})
 		if err != nil {
 			return err
 		}
+
+		return applySetUpdatedAtTrigger(executor, SetUpdatedAtTriggerParams{Table: params.Table, Column: params.NewName})
 	}
 
-	keys := ""
-	for index, key := range table.PrimaryKeys {
-		if index == 0 {
-			keys = fmt.Sprintf(`"%v"`, key)
-		} else {
-			keys += fmt.Sprintf(`, "%v"`, key)
-		}
+	return nil
+}
+
+const updatedAtTriggerName = "cubes_set_updated_at"
 
+// applySetUpdatedAtTrigger creates the shared trigger function if it doesn't exist,
+// the function sets the column passed as the trigger argument to now()
+func applySetUpdatedAtTrigger(executor queryExecutor, params SetUpdatedAtTriggerParams) error {
+
+	_, err := executor.Exec(fmt.Sprintf(`
+		CREATE OR REPLACE FUNCTION "%v"() RETURNS trigger AS $$
+		BEGIN
+			NEW := jsonb_populate_record(NEW, jsonb_build_object(TG_ARGV[0], now()));
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql
+	`, updatedAtTriggerName))
+	if err != nil {
+		return fmt.Errorf("can't create updated at trigger function: %v\n", err)
 	}
 
-	query := fmt.Sprintf(`
-		ALTER TABLE "%v"
-			ADD CONSTRAINT "%v" PRIMARY KEY (%v);
-	`, params.Table, constraintName, keys)
+	query := fmt.Sprintf(
+		`CREATE TRIGGER "%v" BEFORE UPDATE ON "%v" FOR EACH ROW EXECUTE PROCEDURE "%v"(%v)`,
+		updatedAtTriggerName, params.Table, updatedAtTriggerName, quoteLiteral(params.Column),
+	)
 
-	_, err = transaction.Exec(query)
+	_, err = executor.Exec(query)
 	if err != nil {
-		return fmt.Errorf("can't add primary key '%v' to table '%v': %v\n", params.Column, params.Table, err)
+		return fmt.Errorf("can't set updated at trigger at table '%v': %v\n", params.Table, err)
 	}
 
 	return nil
 }
 
-func applyDeletePrimaryKey(transaction *sql.Tx, migrationId string, actionIndex int, params DeletePrimaryKeyParams) error {
+func applyDropUpdatedAtTrigger(executor queryExecutor, params DropUpdatedAtTriggerParams) error {
 
-	constraintName := params.Table + "_pkey"
+	query := fmt.Sprintf(`DROP TRIGGER "%v" ON "%v"`, updatedAtTriggerName, params.Table)
 
-	snapshot, err := GetSnapshotForVersion(migrationId, actionIndex)
+	_, err := executor.Exec(query)
 	if err != nil {
-		return err
+		return fmt.Errorf("can't drop updated at trigger at table '%v': %v\n", params.Table, err)
+	}
+
+	return nil
+}
+
+const notifyTriggerName = "cubes_notify_change"
+
+// DefaultNotifyChannel is the channel of notify triggers added without a channel
+const DefaultNotifyChannel = "cubes_changes"
+
+// ChangeNotification is the payload of notify triggers. Old is empty for inserts,
+// new is empty for deletes. Notifications are limited to 8000 bytes, rows of
+// bigger payloads are truncated to their primary key columns. Truncated rows of
+// tables without a primary key, or with keys still too big, are empty, so such
+// events carry only the table and the operation.
+type ChangeNotification struct {
+	Table     string                     `json:"table"`
+	Operation string                     `json:"operation"`
+	Old       map[string]json.RawMessage `json:"old"`
+	New       map[string]json.RawMessage `json:"new"`
+	Truncated bool                       `json:"truncated,omitempty"`
+}
+
+// applySetChangeNotify creates the shared trigger function if it doesn't exist,
+// the function notifies the channel passed as the trigger argument when the transaction commits
+func applySetChangeNotify(executor queryExecutor, params SetChangeNotifyParams) error {
+
+	_, err := executor.Exec(fmt.Sprintf(`
+		CREATE OR REPLACE FUNCTION "%v"() RETURNS trigger AS $$
+		DECLARE
+			old_row jsonb;
+			new_row jsonb;
+			key_columns text[];
+			payload text;
+		BEGIN
+			IF TG_OP <> 'INSERT' THEN
+				old_row := to_jsonb(OLD);
+			END IF;
+
+			IF TG_OP <> 'DELETE' THEN
+				new_row := to_jsonb(NEW);
+			END IF;
+
+			payload := jsonb_build_object('table', TG_TABLE_NAME, 'operation', lower(TG_OP), 'old', old_row, 'new', new_row)::text;
+
+			IF octet_length(payload) >= 8000 THEN
+				SELECT array_agg(a.attname::text) INTO key_columns
+				FROM pg_index i
+					JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = ANY(i.indkey)
+				WHERE i.indrelid = TG_RELID AND i.indisprimary;
+
+				payload := jsonb_build_object(
+					'table', TG_TABLE_NAME,
+					'operation', lower(TG_OP),
+					'old', (SELECT jsonb_object_agg(key, value) FROM jsonb_each(old_row) WHERE key = ANY(key_columns)),
+					'new', (SELECT jsonb_object_agg(key, value) FROM jsonb_each(new_row) WHERE key = ANY(key_columns)),
+					'truncated', true
+				)::text;
+
+				IF octet_length(payload) >= 8000 THEN
+					payload := jsonb_build_object('table', TG_TABLE_NAME, 'operation', lower(TG_OP), 'truncated', true)::text;
+				END IF;
+			END IF;
+
+			PERFORM pg_notify(TG_ARGV[0], payload);
+			RETURN NULL;
+		END;
+		$$ LANGUAGE plpgsql
+	`, notifyTriggerName))
+	if err != nil {
+		return fmt.Errorf("can't create notify trigger function: %v\n", err)
+	}
+
+	query := fmt.Sprintf(
+		`CREATE TRIGGER "%v" AFTER INSERT OR UPDATE OR DELETE ON "%v" FOR EACH ROW EXECUTE PROCEDURE "%v"(%v)`,
+		notifyTriggerName, params.Table, notifyTriggerName, quoteLiteral(params.Channel),
+	)
+
+	_, err = executor.Exec(query)
+	if err != nil {
+		return fmt.Errorf("can't set notify trigger at table '%v': %v\n", params.Table, err)
+	}
+
+	return nil
+}
+
+func applyDropChangeNotify(executor queryExecutor, params DropChangeNotifyParams) error {
+
+	query := fmt.Sprintf(`DROP TRIGGER "%v" ON "%v"`, notifyTriggerName, params.Table)
+
+	_, err := executor.Exec(query)
+	if err != nil {
+		return fmt.Errorf("can't drop notify trigger at table '%v': %v\n", params.Table, err)
+	}
+
+	return nil
+}
+
+const auditTriggerName = "cubes_audit"
+
+// applyEnableAudit creates the shared trigger function if it doesn't exist, the
+// function inserts the change into the history table passed as the trigger
+// argument. The user is taken from the app.user setting, it's null if not set.
+func applyEnableAudit(executor queryExecutor, params EnableAuditParams) error {
+
+	_, err := executor.Exec(fmt.Sprintf(`
+		CREATE OR REPLACE FUNCTION "%v"() RETURNS trigger AS $$
+		DECLARE
+			old_row jsonb;
+			new_row jsonb;
+		BEGIN
+			IF TG_OP <> 'INSERT' THEN
+				old_row := to_jsonb(OLD);
+			END IF;
+
+			IF TG_OP <> 'DELETE' THEN
+				new_row := to_jsonb(NEW);
+			END IF;
+
+			EXECUTE format(
+				'INSERT INTO %%I.%%I (operation, changed_at, changed_by, old_row, new_row) VALUES ($1, now(), $2, $3, $4)',
+				TG_TABLE_SCHEMA, TG_ARGV[0]
+			) USING lower(TG_OP), NULLIF(current_setting('app.user', true), ''), old_row, new_row;
+
+			RETURN NULL;
+		END;
+		$$ LANGUAGE plpgsql
+	`, auditTriggerName))
+	if err != nil {
+		return fmt.Errorf("can't create audit trigger function: %v\n", err)
 	}
 
+	query := fmt.Sprintf(
+		`CREATE TRIGGER "%v" AFTER INSERT OR UPDATE OR DELETE ON "%v" FOR EACH ROW EXECUTE PROCEDURE "%v"(%v)`,
+		auditTriggerName, params.Table, auditTriggerName, quoteLiteral(params.HistoryTable),
+	)
+
+	_, err = executor.Exec(query)
+	if err != nil {
+		return fmt.Errorf("can't enable audit of table '%v': %v\n", params.Table, err)
+	}
+
+	return nil
+}
+
+func applyDisableAudit(executor queryExecutor, params DisableAuditParams) error {
+
+	query := fmt.Sprintf(`DROP TRIGGER "%v" ON "%v"`, auditTriggerName, params.Table)
+
+	_, err := executor.Exec(query)
+	if err != nil {
+		return fmt.Errorf("can't disable audit of table '%v': %v\n", params.Table, err)
+	}
+
+	return nil
+}
+
+func quoteColumns(columns []string) string {
+	quotedColumns := []string{}
+	for _, column := range columns {
+		quotedColumns = append(quotedColumns, fmt.Sprintf(`"%v"`, column))
+	}
+
+	return strings.Join(quotedColumns, ", ")
+}
+
+// alterPrimaryKey replaces the primary key of the table with one statement,
+// an empty list of columns drops the key
+func alterPrimaryKey(executor queryExecutor, table *Table, constraintName string, columns []string) error {
+
+	commands := []string{}
+
+	if len(table.PrimaryKeys) > 0 {
+		previousName := table.PrimaryKeyName
+		if previousName == "" {
+			previousName = getDefaultPrimaryKeyName(table.Name)
+		}
+
+		commands = append(commands, fmt.Sprintf(`DROP CONSTRAINT "%v"`, previousName))
+	}
+
+	if len(columns) > 0 {
+		commands = append(commands, fmt.Sprintf(`ADD CONSTRAINT "%v" PRIMARY KEY (%v)`, constraintName, quoteColumns(columns)))
+	}
+
+	if len(commands) == 0 {
+		return nil
+	}
+
+	query := fmt.Sprintf(`ALTER TABLE "%v" %v`, table.Name, strings.Join(commands, ", "))
+
+	_, err := executor.Exec(query)
+	return err
+}
+
+func applyAddPrimaryKey(executor queryExecutor, snapshot *Snapshot, params AddPrimaryKeyParams) error {
+
 	table := getTableFromSnapshot(snapshot, params.Table)
 	if table == nil {
 		return fmt.Errorf("table '%v' doesn't exist", params.Table)
 	}
 
-	query := fmt.Sprintf(`
-			ALTER TABLE "%v"
-				DROP CONSTRAINT "%v"
-		`, params.Table, constraintName)
+	columns := []string{}
+	for _, key := range table.PrimaryKeys {
+		columns = append(columns, string(key))
+	}
+	columns = append(columns, params.Column)
 
-	_, err = transaction.Exec(query)
+	constraintName := table.PrimaryKeyName
+	if constraintName == "" {
+		constraintName = getDefaultPrimaryKeyName(table.Name)
+	}
+
+	err := alterPrimaryKey(executor, table, constraintName, columns)
 	if err != nil {
-		return err
+		return fmt.Errorf("can't add primary key '%v' to table '%v': %v\n", params.Column, params.Table, err)
 	}
 
-	keys := ""
+	return nil
+}
+
+// applyDeletePrimaryKey recreates the rest of the key under the legacy name, as earlier versions did
+func applyDeletePrimaryKey(executor queryExecutor, snapshot *Snapshot, params DeletePrimaryKeyParams) error {
+
+	table := getTableFromSnapshot(snapshot, params.Table)
+	if table == nil {
+		return fmt.Errorf("table '%v' doesn't exist", params.Table)
+	}
+
+	columns := []string{}
 	for _, key := range table.PrimaryKeys {
-		if key == ColumnName(params.Column) {
-			continue
+		if key != ColumnName(params.Column) {
+			columns = append(columns, string(key))
 		}
+	}
 
-		if keys == "" {
-			keys = fmt.Sprintf(`"%v"`, key)
-		} else {
-			keys += fmt.Sprintf(`, "%v"`, key)
-		}
+	err := alterPrimaryKey(executor, table, legacyPrimaryKeyName, columns)
+	if err != nil {
+		return fmt.Errorf("can't delete primary key '%v' from table '%v': %v\n", params.Column, params.Table, err)
+	}
+
+	return nil
+}
 
+func applySetPrimaryKey(executor queryExecutor, snapshot *Snapshot, params SetPrimaryKeyParams) error {
+
+	table := getTableFromSnapshot(snapshot, params.Table)
+	if table == nil {
+		return fmt.Errorf("table '%v' doesn't exist", params.Table)
 	}
 
-	query = fmt.Sprintf(`
-		ALTER TABLE "%v"
-			ADD CONSTRAINT pkey PRIMARY KEY (%v);
-	`, params.Table, keys)
+	constraintName := params.Name
+	if strings.TrimSpace(constraintName) == "" {
+		constraintName = getDefaultPrimaryKeyName(table.Name)
+	}
 
-	_, err = transaction.Exec(query)
+	err := alterPrimaryKey(executor, table, constraintName, params.Columns)
 	if err != nil {
-		return fmt.Errorf("can't add primary key '%v' to table '%v': %v\n", params.Column, params.Table, err)
+		return fmt.Errorf("can't set primary key of table '%v': %v\n", params.Table, err)
 	}
 
 	return nil
 }
 
-func applyAddRelation(transaction *sql.Tx, params AddRelationParams) error {
+func applyDropPrimaryKey(executor queryExecutor, snapshot *Snapshot, params DropPrimaryKeyParams) error {
 
-	columns := ""
-	remoteColumns := ""
+	table := getTableFromSnapshot(snapshot, params.Table)
+	if table == nil {
+		return fmt.Errorf("table '%v' doesn't exist", params.Table)
+	}
+
+	err := alterPrimaryKey(executor, table, "", []string{})
+	if err != nil {
+		return fmt.Errorf("can't drop primary key of table '%v': %v\n", params.Table, err)
+	}
+
+	return nil
+}
+
+// applyAddRelation creates the foreign key of the relation, an array relation
+// has it in the remote table, unless it is linked to an existing object relation
+func applyAddRelation(executor queryExecutor, snapshot *Snapshot, params AddRelationParams) error {
+
+	table := params.Table
+	remoteTable := params.RemoteTable
+	columns := []string{}
+	remoteColumns := []string{}
 
 	for _, mapping := range params.ColumnsMapping {
-		if columns == "" {
-			columns = fmt.Sprintf(`"%v"`, mapping.Column)
-			remoteColumns = fmt.Sprintf(`"%v"`, mapping.RemoteColumn)
-		} else {
-			columns += fmt.Sprintf(`, "%v"`, mapping.Column)
-			remoteColumns += fmt.Sprintf(`, "%v"`, mapping.RemoteColumn)
+		columns = append(columns, mapping.Column)
+		remoteColumns = append(remoteColumns, mapping.RemoteColumn)
+	}
+
+	if params.Type == Array {
+		remoteTableSnapshot := getTableFromSnapshot(snapshot, params.RemoteTable)
+		if remoteTableSnapshot != nil && findLinkedObjectRelation(remoteTableSnapshot, params) != "" {
+			return nil
 		}
+
+		table, remoteTable = remoteTable, table
+		columns, remoteColumns = remoteColumns, columns
 	}
 
 	query := fmt.Sprintf(`
@@ -215,9 +598,9 @@ func applyAddRelation(transaction *sql.Tx, params AddRelationParams) error {
 			REFERENCES "%v" (%v) MATCH SIMPLE
 			ON UPDATE NO ACTION
 			ON DELETE NO ACTION;
-	`, params.Table, params.Name, columns, params.RemoteTable, remoteColumns)
+	`, table, params.Name, quoteColumns(columns), remoteTable, quoteColumns(remoteColumns))
 
-	_, err := transaction.Exec(query)
+	_, err := executor.Exec(query)
 	if err != nil {
 		return fmt.Errorf("can't add relation '%v' to table '%v': %v\n", params.Name, params.Table, err)
 	}
@@ -225,7 +608,7 @@ func applyAddRelation(transaction *sql.Tx, params AddRelationParams) error {
 	return nil
 }
 
-func applyAddUniqueConstraint(transaction *sql.Tx, params AddUniqueConstraintParams) error {
+func applyAddUniqueConstraint(executor queryExecutor, params AddUniqueConstraintParams) error {
 
 	columns := ""
 
@@ -242,7 +625,7 @@ func applyAddUniqueConstraint(transaction *sql.Tx, params AddUniqueConstraintPar
 			ADD CONSTRAINT "%v" UNIQUE (%v)
 	`, params.Table, params.Name, columns)
 
-	_, err := transaction.Exec(query)
+	_, err := executor.Exec(query)
 	if err != nil {
 		return fmt.Errorf("can't add unique constraint '%v' to table '%v': %v\n", params.Name, params.Table, err)
 	}
@@ -250,14 +633,28 @@ func applyAddUniqueConstraint(transaction *sql.Tx, params AddUniqueConstraintPar
 	return nil
 }
 
-func applyDeleteRelation(transaction *sql.Tx, params DeleteRelationParams) error {
+func applyDeleteRelation(executor queryExecutor, snapshot *Snapshot, params DeleteRelationParams) error {
+
+	constraintTable := params.Table
+
+	table := getTableFromSnapshot(snapshot, params.Table)
+	if table != nil {
+		relation := getRelationFromTable(table, params.Name)
+		if relation != nil && relation.Type == Array {
+			if relation.LinkedRelation != "" {
+				return nil
+			}
+
+			constraintTable = relation.RemoteTable
+		}
+	}
 
 	query := fmt.Sprintf(`
 		ALTER TABLE "%v"
 			DROP CONSTRAINT "%v"
-	`, params.Table, params.Name)
+	`, constraintTable, params.Name)
 
-	_, err := transaction.Exec(query)
+	_, err := executor.Exec(query)
 	if err != nil {
 		return fmt.Errorf("can't delete relation '%v' to table '%v': %v\n", params.Name, params.Table, err)
 	}
@@ -265,14 +662,14 @@ func applyDeleteRelation(transaction *sql.Tx, params DeleteRelationParams) error
 	return nil
 }
 
-func applyDeleteUniqueConstraint(transaction *sql.Tx, params DeleteUniqueConstraintParams) error {
+func applyDeleteUniqueConstraint(executor queryExecutor, params DeleteUniqueConstraintParams) error {
 
 	query := fmt.Sprintf(`
 		ALTER TABLE "%v"
 			DROP CONSTRAINT "%v"
 	`, params.Table, params.Name)
 
-	_, err := transaction.Exec(query)
+	_, err := executor.Exec(query)
 	if err != nil {
 		return fmt.Errorf("can't delete unique constraint '%v' to table '%v': %v\n", params.Name, params.Table, err)
 	}
@@ -280,104 +677,497 @@ func applyDeleteUniqueConstraint(transaction *sql.Tx, params DeleteUniqueConstra
 	return nil
 }
 
-func Sync() error {
+func applyAddIndex(executor queryExecutor, params AddIndexParams) error {
+
+	unique := ""
+	if params.IsUnique {
+		unique = "UNIQUE "
+	}
+
+	concurrently := ""
+	if params.Concurrently {
+		concurrently = "CONCURRENTLY "
+	}
+
+	query := fmt.Sprintf(`CREATE %vINDEX %v"%v" ON "%v" (%v)`,
+		unique, concurrently, params.Name, params.Table, quoteColumns(params.Columns))
 
-	migrations, err := GetList()
+	_, err := executor.Exec(query)
 	if err != nil {
-		return fmt.Errorf("can't read migrations: %v\n", err)
+		return fmt.Errorf("can't add index '%v' to table '%v': %v\n", params.Name, params.Table, err)
 	}
 
-	dbConnectionString := fmt.Sprintf("user=%v password=%v dbname=%v host=%v port=%v sslmode=disable",
-		"admin",
-		"123456",
-		"timeio",
-		"localhost",
-		5432)
+	return nil
+}
+
+func applyDeleteIndex(executor queryExecutor, params DeleteIndexParams) error {
+
+	concurrently := ""
+	if params.Concurrently {
+		concurrently = "CONCURRENTLY "
+	}
 
-	db, err := sql.Open("postgres", dbConnectionString)
+	query := fmt.Sprintf(`DROP INDEX %v"%v"`, concurrently, params.Name)
+
+	_, err := executor.Exec(query)
 	if err != nil {
-		return fmt.Errorf("can't connect to db: %v", err)
+		return fmt.Errorf("can't delete index '%v' from table '%v': %v\n", params.Name, params.Table, err)
 	}
-	defer func() { db.Close() }()
 
-	err = db.Ping()
+	return nil
+}
+
+type TransactionMode string
+
+const (
+	TransactionAll          = TransactionMode("all")
+	TransactionPerMigration = TransactionMode("per-migration")
+	TransactionNone         = TransactionMode("none")
+)
+
+type SyncOptions struct {
+	Transaction      TransactionMode
+	LockTimeout      string
+	StatementTimeout string
+
+	// LockName separates sync locks of projects sharing a database, usually the project name
+	LockName string
+	// LockWaitTimeout limits waiting for another sync, zero waits forever
+	LockWaitTimeout time.Duration
+	// Progress receives sync events, they are printed to stdout if it is nil
+	Progress ProgressFunc
+	// Schema is set as the search path of the sync session, so tables and the migrations
+	// table are created in it. The current schema of the connection is used if it is empty.
+	Schema string
+}
+
+// queryExecutor is implemented by transactions and by connectionExecutor for actions applied outside of transactions
+type queryExecutor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+type connectionExecutor struct {
+	connection *sql.Conn
+}
+
+func (e connectionExecutor) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return e.connection.ExecContext(context.Background(), query, args...)
+}
+
+func (e connectionExecutor) QueryRow(query string, args ...interface{}) *sql.Row {
+	return e.connection.QueryRowContext(context.Background(), query, args...)
+}
+
+type syncState struct {
+	lastMigrationId       string
+	partialMigrationId    string
+	partialAppliedActions int
+}
+
+type pendingMigration struct {
+	migration  Migration
+	startIndex int
+}
+
+// Sync applies pending migrations of the project to the database of the profile
+func Sync(profile Profile, options SyncOptions) error {
+
+	migrator, db, err := OpenProjectMigrator(profile, options)
 	if err != nil {
-		return fmt.Errorf("can't connect to db: %v", err)
+		return err
 	}
+	defer func() { db.Close() }()
 
 	log.Println("Connected to db")
-	transaction, err := db.Begin()
+	return migrator.Sync()
+}
+
+// SyncMigrations applies migrations which are not synced yet to the database.
+// Progress is stored after every committed part, so a failed sync continues
+// from the last committed action on the next run.
+func SyncMigrations(db *sql.DB, migrations []Migration, options SyncOptions) error {
+
+	transactionMode := options.Transaction
+	if transactionMode == "" {
+		transactionMode = TransactionAll
+	}
+
+	if transactionMode != TransactionAll && transactionMode != TransactionPerMigration && transactionMode != TransactionNone {
+		return fmt.Errorf("wrong transaction mode '%v', expected '%v', '%v' or '%v'",
+			transactionMode, TransactionAll, TransactionPerMigration, TransactionNone)
+	}
+
+	allActions := []Action{}
+	for _, migration := range migrations {
+		allActions = append(allActions, migration.Actions...)
+	}
+
+	_, err := GetSnapshot(allActions)
 	if err != nil {
-		transaction.Rollback()
-		return fmt.Errorf("can't start transaction: %v", err)
+		return err
 	}
 
-	err = addMigrationsTableIfNotExist(transaction)
+	connection, release, err := openSyncSession(db, options)
 	if err != nil {
-		transaction.Rollback()
-		return fmt.Errorf("can't add migration table: %v", err)
+		return err
 	}
+	defer release()
+
+	executor := connectionExecutor{connection: connection}
+	progress := options.getProgress()
 
-	currentMigrationId, err := getCurrentSyncedMigrationId(transaction)
+	state, err := getSyncState(executor)
 	if err != nil {
-		transaction.Rollback()
 		return fmt.Errorf("can't read current migration state: %v", err)
 	}
 
-	_, err = GetCurrentSnapshot()
+	// The snapshot follows the applied actions, so actions that depend on the table state don't replay the history
+	snapshot := newSnapshot()
+	pending := []pendingMigration{}
+
+	isCurrentMigrationPassed := state.lastMigrationId == ""
+
+	for _, migration := range migrations {
+
+		if !isCurrentMigrationPassed {
+			err = applyActionsToSnapshot(snapshot, migration.Actions)
+			if err != nil {
+				return err
+			}
+
+			if migration.Id == state.lastMigrationId {
+				isCurrentMigrationPassed = true
+			}
+
+			continue
+		}
+
+		startIndex := 0
+		if migration.Id == state.partialMigrationId {
+			startIndex = state.partialAppliedActions
+		}
+
+		pending = append(pending, pendingMigration{
+			migration:  migration,
+			startIndex: startIndex,
+		})
+	}
+
+	if !isCurrentMigrationPassed {
+		return fmt.Errorf("synced migration %v doesn't exist in migrations", state.lastMigrationId)
+	}
+
+	if state.partialMigrationId != "" {
+		if len(pending) == 0 || pending[0].migration.Id != state.partialMigrationId {
+			return fmt.Errorf("migration %v is partially applied, but it isn't the next migration to apply", state.partialMigrationId)
+		}
+
+		if pending[0].startIndex > len(pending[0].migration.Actions) {
+			return fmt.Errorf("migration %v has less actions than already applied", state.partialMigrationId)
+		}
+
+		err = applyActionsToSnapshot(snapshot, pending[0].migration.Actions[:pending[0].startIndex])
+		if err != nil {
+			return err
+		}
+	}
+
+	switch transactionMode {
+	case TransactionPerMigration:
+		return syncPerMigration(connection, executor, snapshot, pending, progress)
+	case TransactionNone:
+		return syncWithoutTransaction(executor, snapshot, pending, progress)
+	}
+
+	return syncInOneTransaction(connection, snapshot, pending, progress)
+}
+
+// openSyncSession returns a connection holding the sync lock with timeouts
+// set and the migrations table created, release unlocks and closes it
+func openSyncSession(db *sql.DB, options SyncOptions) (*sql.Conn, func(), error) {
+
+	connection, err := db.Conn(context.Background())
 	if err != nil {
-		return err
+		return nil, nil, fmt.Errorf("can't connect to db: %v", err)
 	}
 
-	isCurrentMigrationPassed := currentMigrationId == ""
+	lockKey := getSyncLockKey(options.LockName)
+	executor := connectionExecutor{connection: connection}
+	isLocked := false
+
+	release := func() {
+		if isLocked {
+			releaseSyncLock(executor, lockKey)
+		}
 
-	for _, migration := range *migrations {
+		// The connection goes back to the pool of the caller, so the schema,
+		// timeouts and the application name of the sync are reset
+		executor.Exec("RESET ALL")
+		connection.Close()
+	}
 
-		if migration.Id == currentMigrationId {
-			isCurrentMigrationPassed = true
-			continue
+	err = setApplicationName(executor)
+	if err != nil {
+		release()
+		return nil, nil, fmt.Errorf("can't set application name: %v", err)
+	}
+
+	if options.Schema != "" {
+		_, err = executor.Exec(fmt.Sprintf(`SET search_path TO %v`, quoteIdentifier(options.Schema)))
+		if err != nil {
+			release()
+			return nil, nil, fmt.Errorf("can't set schema '%v': %v", options.Schema, err)
 		}
+	}
 
-		if !isCurrentMigrationPassed {
-			continue
+	// The lock is held by the session, so it covers all transactions of the sync
+	err = acquireSyncLock(executor, lockKey, options.LockWaitTimeout, options.getProgress())
+	if err != nil {
+		release()
+		return nil, nil, fmt.Errorf("can't take sync lock: %v", err)
+	}
+
+	isLocked = true
+
+	err = setTimeouts(executor, options)
+	if err != nil {
+		release()
+		return nil, nil, fmt.Errorf("can't set timeouts: %v", err)
+	}
+
+	err = addMigrationsTableIfNotExist(executor)
+	if err != nil {
+		release()
+		return nil, nil, fmt.Errorf("can't add migration table: %v", err)
+	}
+
+	return connection, release, nil
+}
+
+func setTimeouts(executor queryExecutor, options SyncOptions) error {
+
+	if options.LockTimeout != "" {
+		_, err := executor.Exec(fmt.Sprintf("SET lock_timeout = %v", quoteLiteral(options.LockTimeout)))
+		if err != nil {
+			return err
+		}
+	}
+
+	if options.StatementTimeout != "" {
+		_, err := executor.Exec(fmt.Sprintf("SET statement_timeout = %v", quoteLiteral(options.StatementTimeout)))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func syncInOneTransaction(connection *sql.Conn, snapshot *Snapshot, pending []pendingMigration, progress ProgressFunc) error {
+
+	for _, item := range pending {
+		for index, action := range item.migration.Actions[item.startIndex:] {
+			isNonTransactional, err := isNonTransactionalAction(action)
+			if err != nil {
+				return err
+			}
+
+			if isNonTransactional {
+				return fmt.Errorf("action #%v \"%v\" of migration %v can't run in a transaction, use '%v' or '%v' transaction mode",
+					item.startIndex+index, action.Method, item.migration.Id, TransactionPerMigration, TransactionNone)
+			}
 		}
+	}
+
+	transaction, err := connection.BeginTx(context.Background(), nil)
+	if err != nil {
+		return fmt.Errorf("can't start transaction: %v", err)
+	}
+
+	for _, item := range pending {
+		migration := item.migration
+		progress(ProgressEvent{Type: ProgressMigrationStarted, MigrationId: migration.Id, ActionIndex: item.startIndex})
 
-		err = applyMigrationActions(transaction, migration)
+		err = applyMigrationActions(transaction, snapshot, migration, item.startIndex, len(migration.Actions), progress)
 		if err != nil {
 			transaction.Rollback()
 			return fmt.Errorf("can't apply migration %v: %v\n", migration.Id, err)
 		}
 
-		addMigrationToMigrationsTable(transaction, migration)
+		err = setMigrationProgress(transaction, migration, len(migration.Actions), true)
 		if err != nil {
 			transaction.Rollback()
 			return fmt.Errorf("can't add migration to migrations table %v: %v\n", migration.Id, err)
 		}
+
+		progress(ProgressEvent{Type: ProgressMigrationCompleted, MigrationId: migration.Id})
 	}
 
 	return transaction.Commit()
 }
 
-func getCurrentSyncedMigrationId(transaction *sql.Tx) (string, error) {
+// syncPerMigration commits every migration separately, a migration is split
+// into several commits when it has actions that can't run in a transaction
+func syncPerMigration(connection *sql.Conn, executor queryExecutor, snapshot *Snapshot, pending []pendingMigration, progress ProgressFunc) error {
+
+	for _, item := range pending {
+		migration := item.migration
+		actionsCount := len(migration.Actions)
+		index := item.startIndex
+
+		progress(ProgressEvent{Type: ProgressMigrationStarted, MigrationId: migration.Id, ActionIndex: item.startIndex})
+
+		for {
+			if index < actionsCount {
+				isNonTransactional, err := isNonTransactionalAction(migration.Actions[index])
+				if err != nil {
+					return err
+				}
+
+				if isNonTransactional {
+					err = applyMigrationActions(executor, snapshot, migration, index, index+1, progress)
+					if err != nil {
+						return fmt.Errorf("can't apply migration %v: %v\n", migration.Id, err)
+					}
+
+					index++
+
+					err = setMigrationProgress(executor, migration, index, index == actionsCount)
+					if err != nil {
+						return fmt.Errorf("can't save progress of migration %v: %v\n", migration.Id, err)
+					}
+
+					if index == actionsCount {
+						break
+					}
+
+					continue
+				}
+			}
+
+			end := index
+			for end < actionsCount {
+				isNonTransactional, err := isNonTransactionalAction(migration.Actions[end])
+				if err != nil {
+					return err
+				}
+
+				if isNonTransactional {
+					break
+				}
+
+				end++
+			}
+
+			transaction, err := connection.BeginTx(context.Background(), nil)
+			if err != nil {
+				return fmt.Errorf("can't start transaction: %v", err)
+			}
+
+			err = applyMigrationActions(transaction, snapshot, migration, index, end, progress)
+			if err != nil {
+				transaction.Rollback()
+				return fmt.Errorf("can't apply migration %v: %v\n", migration.Id, err)
+			}
+
+			err = setMigrationProgress(transaction, migration, end, end == actionsCount)
+			if err != nil {
+				transaction.Rollback()
+				return fmt.Errorf("can't save progress of migration %v: %v\n", migration.Id, err)
+			}
+
+			err = transaction.Commit()
+			if err != nil {
+				return fmt.Errorf("can't commit migration %v: %v\n", migration.Id, err)
+			}
+
+			index = end
+			if index == actionsCount {
+				break
+			}
+		}
+
+		progress(ProgressEvent{Type: ProgressMigrationCompleted, MigrationId: migration.Id})
+	}
+
+	return nil
+}
 
-	row := transaction.QueryRow("SELECT id FROM _migrations  ORDER BY id DESC  LIMIT 1")
+// syncWithoutTransaction applies every action separately and saves progress after each of them
+func syncWithoutTransaction(executor queryExecutor, snapshot *Snapshot, pending []pendingMigration, progress ProgressFunc) error {
 
-	var migrationId string
-	err := row.Scan(&migrationId)
-	if err == sql.ErrNoRows {
-		return "", nil
+	for _, item := range pending {
+		migration := item.migration
+		actionsCount := len(migration.Actions)
+
+		progress(ProgressEvent{Type: ProgressMigrationStarted, MigrationId: migration.Id, ActionIndex: item.startIndex})
+
+		for index := item.startIndex; index < actionsCount; index++ {
+			err := applyMigrationActions(executor, snapshot, migration, index, index+1, progress)
+			if err != nil {
+				return fmt.Errorf("can't apply migration %v: %v\n", migration.Id, err)
+			}
+
+			err = setMigrationProgress(executor, migration, index+1, index+1 == actionsCount)
+			if err != nil {
+				return fmt.Errorf("can't save progress of migration %v: %v\n", migration.Id, err)
+			}
+		}
+
+		if item.startIndex >= actionsCount {
+			err := setMigrationProgress(executor, migration, actionsCount, true)
+			if err != nil {
+				return fmt.Errorf("can't save progress of migration %v: %v\n", migration.Id, err)
+			}
+		}
+
+		progress(ProgressEvent{Type: ProgressMigrationCompleted, MigrationId: migration.Id})
 	}
 
-	return migrationId, err
+	return nil
 }
 
-func applyMigrationActions(transaction *sql.Tx, migration Migration) error {
+func getSyncState(executor queryExecutor) (*syncState, error) {
 
-	fmt.Println(migration.Id)
+	state := syncState{}
 
-	for index, action := range migration.Actions {
+	row := executor.QueryRow("SELECT id FROM _migrations WHERE is_complete ORDER BY id DESC LIMIT 1")
+	err := row.Scan(&state.lastMigrationId)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
 
-		var err error
+	row = executor.QueryRow("SELECT id, COALESCE(applied_actions, 0) FROM _migrations WHERE NOT is_complete ORDER BY id LIMIT 1")
+	err = row.Scan(&state.partialMigrationId, &state.partialAppliedActions)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+func isNonTransactionalAction(action Action) (bool, error) {
+
+	method, params, err := decodeAction(action.Method, action.Params)
+	if err != nil {
+		return false, fmt.Errorf("can't decode action %v\n", err)
+	}
+
+	switch method {
+	case "addIndex":
+		return params.(AddIndexParams).Concurrently, nil
+	case "deleteIndex":
+		return params.(DeleteIndexParams).Concurrently, nil
+	}
+
+	return false, nil
+}
+
+func applyMigrationActions(executor queryExecutor, snapshot *Snapshot, migration Migration, from int, to int, progress ProgressFunc) error {
+
+	for index := from; index < to; index++ {
+		action := migration.Actions[index]
 
 		method, params, err := decodeAction(action.Method, action.Params)
 		if err != nil {
@@ -386,46 +1176,98 @@ func applyMigrationActions(transaction *sql.Tx, migration Migration) error {
 
 		switch method {
 		case "addTable":
-			err = applyAddTable(transaction, params.(AddTableParams))
+			err = applyAddTable(executor, params.(AddTableParams))
 			break
 		case "deleteTable":
-			err = applyDeleteTable(transaction, params.(DeleteTableParams))
+			err = applyDeleteTable(executor, params.(DeleteTableParams))
+			break
+		case "setTableComment":
+			err = applySetTableComment(executor, params.(SetTableCommentParams))
+			break
+		case "setColumnComment":
+			err = applySetColumnComment(executor, params.(SetColumnCommentParams))
 			break
 		case "addColumn":
-			err = applyAddColumn(transaction, params.(AddColumnParams))
+			err = applyAddColumn(executor, params.(AddColumnParams))
 			break
 		case "deleteColumn":
-			err = applyDeleteColumn(transaction, params.(DeleteColumnParams))
+			err = applyDeleteColumn(executor, params.(DeleteColumnParams))
+			break
+		case "addSequence":
+			err = applyAddSequence(executor, params.(AddSequenceParams))
+			break
+		case "deleteSequence":
+			err = applyDeleteSequence(executor, params.(DeleteSequenceParams))
 			break
 		case "addPrimaryKey":
-			err = applyAddPrimaryKey(transaction, migration.Id, index, params.(AddPrimaryKeyParams))
+			err = applyAddPrimaryKey(executor, snapshot, params.(AddPrimaryKeyParams))
 			break
 		case "deletePrimaryKey":
-			err = applyDeletePrimaryKey(transaction, migration.Id, index, params.(DeletePrimaryKeyParams))
+			err = applyDeletePrimaryKey(executor, snapshot, params.(DeletePrimaryKeyParams))
+			break
+		case "setPrimaryKey":
+			err = applySetPrimaryKey(executor, snapshot, params.(SetPrimaryKeyParams))
+			break
+		case "dropPrimaryKey":
+			err = applyDropPrimaryKey(executor, snapshot, params.(DropPrimaryKeyParams))
 			break
 		case "addRelation":
-			err = applyAddRelation(transaction, params.(AddRelationParams))
+			err = applyAddRelation(executor, snapshot, params.(AddRelationParams))
 			break
 		case "deleteRelation":
-			err = applyDeleteRelation(transaction, params.(DeleteRelationParams))
+			err = applyDeleteRelation(executor, snapshot, params.(DeleteRelationParams))
 			break
 		case "addUniqueConstraint":
-			err = applyAddUniqueConstraint(transaction, params.(AddUniqueConstraintParams))
+			err = applyAddUniqueConstraint(executor, params.(AddUniqueConstraintParams))
 			break
 		case "deleteUniqueConstraint":
-			err = applyDeleteUniqueConstraint(transaction, params.(DeleteUniqueConstraintParams))
+			err = applyDeleteUniqueConstraint(executor, params.(DeleteUniqueConstraintParams))
+			break
+		case "addIndex":
+			err = applyAddIndex(executor, params.(AddIndexParams))
+			break
+		case "deleteIndex":
+			err = applyDeleteIndex(executor, params.(DeleteIndexParams))
+			break
+		case "renameTable":
+			err = applyRenameTable(executor, snapshot, params.(RenameTableParams))
+			break
+		case "renameColumn":
+			err = applyRenameColumn(executor, snapshot, params.(RenameColumnParams))
+			break
+		case "setUpdatedAtTrigger":
+			err = applySetUpdatedAtTrigger(executor, params.(SetUpdatedAtTriggerParams))
+			break
+		case "dropUpdatedAtTrigger":
+			err = applyDropUpdatedAtTrigger(executor, params.(DropUpdatedAtTriggerParams))
+			break
+		case "setChangeNotify":
+			err = applySetChangeNotify(executor, params.(SetChangeNotifyParams))
+			break
+		case "dropChangeNotify":
+			err = applyDropChangeNotify(executor, params.(DropChangeNotifyParams))
+			break
+		case "enableAudit":
+			err = applyEnableAudit(executor, params.(EnableAuditParams))
+			break
+		case "disableAudit":
+			err = applyDisableAudit(executor, params.(DisableAuditParams))
 			break
 		}
 
 		if err != nil {
-			fmt.Println("#"+strconv.Itoa(index), method, "error")
+			progress(ProgressEvent{Type: ProgressActionFailed, MigrationId: migration.Id, ActionIndex: index, Method: method, Err: err})
 			return fmt.Errorf("can't apply action #%v=\"%v\": %v\n", index, method, err)
-		} else {
-			fmt.Println("#"+strconv.Itoa(index), method, "success", "")
 		}
-	}
 
-	fmt.Println()
+		progress(ProgressEvent{Type: ProgressActionApplied, MigrationId: migration.Id, ActionIndex: index, Method: method})
+
+		// Actions read the snapshot before they are applied, it follows the database after each action
+		err = applyActionsToSnapshot(snapshot, []Action{action})
+		if err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
@@ -452,6 +1294,24 @@ func decodeAction(method string, params json.RawMessage) (string, interface{}, e
 
 		return method, deleteTableParams, nil
 
+	case "setTableComment":
+		var setTableCommentParams SetTableCommentParams
+		err = json.Unmarshal(params, &setTableCommentParams)
+		if err != nil {
+			return "", nil, err
+		}
+
+		return method, setTableCommentParams, nil
+
+	case "setColumnComment":
+		var setColumnCommentParams SetColumnCommentParams
+		err = json.Unmarshal(params, &setColumnCommentParams)
+		if err != nil {
+			return "", nil, err
+		}
+
+		return method, setColumnCommentParams, nil
+
 	case "addColumn":
 		var addColumnParams AddColumnParams
 		err = json.Unmarshal(params, &addColumnParams)
@@ -470,6 +1330,24 @@ func decodeAction(method string, params json.RawMessage) (string, interface{}, e
 
 		return method, deleteColumnParams, nil
 
+	case "addSequence":
+		var addSequenceParams AddSequenceParams
+		err = json.Unmarshal(params, &addSequenceParams)
+		if err != nil {
+			return "", nil, err
+		}
+
+		return method, addSequenceParams, nil
+
+	case "deleteSequence":
+		var deleteSequenceParams DeleteSequenceParams
+		err = json.Unmarshal(params, &deleteSequenceParams)
+		if err != nil {
+			return "", nil, err
+		}
+
+		return method, deleteSequenceParams, nil
+
 	case "addPrimaryKey":
 		var addPrimaryKeyParams AddPrimaryKeyParams
 		err = json.Unmarshal(params, &addPrimaryKeyParams)
@@ -488,6 +1366,24 @@ func decodeAction(method string, params json.RawMessage) (string, interface{}, e
 
 		return method, deletePrimaryKeyParams, nil
 
+	case "setPrimaryKey":
+		var setPrimaryKeyParams SetPrimaryKeyParams
+		err = json.Unmarshal(params, &setPrimaryKeyParams)
+		if err != nil {
+			return "", nil, err
+		}
+
+		return method, setPrimaryKeyParams, nil
+
+	case "dropPrimaryKey":
+		var dropPrimaryKeyParams DropPrimaryKeyParams
+		err = json.Unmarshal(params, &dropPrimaryKeyParams)
+		if err != nil {
+			return "", nil, err
+		}
+
+		return method, dropPrimaryKeyParams, nil
+
 	case "addRelation":
 		var addRelationParams AddRelationParams
 		err = json.Unmarshal(params, &addRelationParams)
@@ -523,24 +1419,130 @@ func decodeAction(method string, params json.RawMessage) (string, interface{}, e
 		}
 
 		return method, deleteUniqueConstraintParams, nil
+
+	case "addIndex":
+		var addIndexParams AddIndexParams
+		err = json.Unmarshal(params, &addIndexParams)
+		if err != nil {
+			return "", nil, err
+		}
+
+		return method, addIndexParams, nil
+
+	case "deleteIndex":
+		var deleteIndexParams DeleteIndexParams
+		err = json.Unmarshal(params, &deleteIndexParams)
+		if err != nil {
+			return "", nil, err
+		}
+
+		return method, deleteIndexParams, nil
+
+	case "renameTable":
+		var renameTableParams RenameTableParams
+		err = json.Unmarshal(params, &renameTableParams)
+		if err != nil {
+			return "", nil, err
+		}
+
+		return method, renameTableParams, nil
+
+	case "renameColumn":
+		var renameColumnParams RenameColumnParams
+		err = json.Unmarshal(params, &renameColumnParams)
+		if err != nil {
+			return "", nil, err
+		}
+
+		return method, renameColumnParams, nil
+
+	case "setUpdatedAtTrigger":
+		var setUpdatedAtTriggerParams SetUpdatedAtTriggerParams
+		err = json.Unmarshal(params, &setUpdatedAtTriggerParams)
+		if err != nil {
+			return "", nil, err
+		}
+
+		return method, setUpdatedAtTriggerParams, nil
+
+	case "dropUpdatedAtTrigger":
+		var dropUpdatedAtTriggerParams DropUpdatedAtTriggerParams
+		err = json.Unmarshal(params, &dropUpdatedAtTriggerParams)
+		if err != nil {
+			return "", nil, err
+		}
+
+		return method, dropUpdatedAtTriggerParams, nil
+
+	case "setChangeNotify":
+		var setChangeNotifyParams SetChangeNotifyParams
+		err = json.Unmarshal(params, &setChangeNotifyParams)
+		if err != nil {
+			return "", nil, err
+		}
+
+		return method, setChangeNotifyParams, nil
+
+	case "dropChangeNotify":
+		var dropChangeNotifyParams DropChangeNotifyParams
+		err = json.Unmarshal(params, &dropChangeNotifyParams)
+		if err != nil {
+			return "", nil, err
+		}
+
+		return method, dropChangeNotifyParams, nil
+
+	case "enableAudit":
+		var enableAuditParams EnableAuditParams
+		err = json.Unmarshal(params, &enableAuditParams)
+		if err != nil {
+			return "", nil, err
+		}
+
+		return method, enableAuditParams, nil
+
+	case "disableAudit":
+		var disableAuditParams DisableAuditParams
+		err = json.Unmarshal(params, &disableAuditParams)
+		if err != nil {
+			return "", nil, err
+		}
+
+		return method, disableAuditParams, nil
 	}
 
 	return "", nil, nil
 }
 
-func addMigrationsTableIfNotExist(transaction *sql.Tx) error {
-	_, err := transaction.Exec(`
+func addMigrationsTableIfNotExist(executor queryExecutor) error {
+	_, err := executor.Exec(`
 		CREATE TABLE IF NOT EXISTS _migrations (
         	id varchar(255) NOT NULL,
         	data text NOT NULL,
+        	applied_actions integer,
+        	is_complete boolean NOT NULL DEFAULT true,
         	PRIMARY KEY (id)
     )`)
+	if err != nil {
+		return err
+	}
+
+	// Tables created by older versions don't have progress columns
+	_, err = executor.Exec(`
+		ALTER TABLE _migrations
+			ADD COLUMN IF NOT EXISTS applied_actions integer,
+			ADD COLUMN IF NOT EXISTS is_complete boolean NOT NULL DEFAULT true
+	`)
 
 	return err
 }
 
-func addMigrationToMigrationsTable(transaction *sql.Tx, migration Migration) error {
+func setMigrationProgress(executor queryExecutor, migration Migration, appliedActions int, isComplete bool) error {
 	packedMigration, _ := json.Marshal(migration)
-	_, err := transaction.Exec("INSERT INTO _migrations (id, data) VALUES ($1, $2)", migration.Id, packedMigration)
+	_, err := executor.Exec(`
+		INSERT INTO _migrations (id, data, applied_actions, is_complete) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (id) DO UPDATE
+			SET data = EXCLUDED.data, applied_actions = EXCLUDED.applied_actions, is_complete = EXCLUDED.is_complete
+	`, migration.Id, packedMigration, appliedActions, isComplete)
 	return err
 }
@@ -0,0 +1,129 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// TenantOptions selects schemas of tenants, every schema gets the same
+// migrations and its own migrations table
+type TenantOptions struct {
+	// SchemaPattern is a LIKE pattern of schema names, for example 'tenant_%'
+	SchemaPattern string
+	// SchemaQuery returns schema names in the first column, it is used instead of the pattern
+	SchemaQuery string
+	// Parallelism limits the number of schemas synced at the same time, one if it is less than one
+	Parallelism int
+}
+
+type TenantResult struct {
+	Schema string
+	Err    error
+}
+
+func (o TenantOptions) getParallelism() int {
+	if o.Parallelism < 1 {
+		return 1
+	}
+
+	return o.Parallelism
+}
+
+func getTenantSchemas(db *sql.DB, tenantOptions TenantOptions) ([]string, error) {
+
+	var rows *sql.Rows
+	var err error
+
+	if tenantOptions.SchemaQuery != "" {
+		rows, err = db.Query(tenantOptions.SchemaQuery)
+	} else if tenantOptions.SchemaPattern != "" {
+		rows, err = db.Query("SELECT nspname FROM pg_namespace WHERE nspname LIKE $1", tenantOptions.SchemaPattern)
+	} else {
+		return nil, fmt.Errorf("schema pattern or query of tenants is required")
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("can't read tenant schemas: %v", err)
+	}
+	defer rows.Close()
+
+	schemas := []string{}
+	for rows.Next() {
+		var schema string
+
+		err = rows.Scan(&schema)
+		if err != nil {
+			return nil, fmt.Errorf("can't read tenant schemas: %v", err)
+		}
+
+		schemas = append(schemas, schema)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("can't read tenant schemas: %v", err)
+	}
+
+	sort.Strings(schemas)
+	return schemas, nil
+}
+
+// SyncTenants applies migrations to every tenant schema, a failed tenant doesn't
+// stop others. Results are sorted by schema, the error is returned only if
+// schemas can't be listed. Progress events aren't printed unless options have
+// Progress, the caller reports results instead.
+func SyncTenants(db *sql.DB, migrations []Migration, tenantOptions TenantOptions, options SyncOptions) ([]TenantResult, error) {
+
+	schemas, err := getTenantSchemas(db, tenantOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]TenantResult, len(schemas))
+	indexes := make(chan int)
+
+	var workers sync.WaitGroup
+	for worker := 0; worker < tenantOptions.getParallelism(); worker++ {
+		workers.Add(1)
+
+		go func() {
+			defer workers.Done()
+
+			for index := range indexes {
+				schema := schemas[index]
+				results[index] = TenantResult{
+					Schema: schema,
+					Err:    SyncMigrations(db, migrations, getTenantSyncOptions(options, schema)),
+				}
+			}
+		}()
+	}
+
+	for index := range schemas {
+		indexes <- index
+	}
+	close(indexes)
+
+	workers.Wait()
+	return results, nil
+}
+
+// getTenantSyncOptions sets the schema, the lock of every schema is separate, so schemas are synced in parallel
+func getTenantSyncOptions(options SyncOptions, schema string) SyncOptions {
+
+	tenantOptions := options
+	tenantOptions.Schema = schema
+	tenantOptions.LockName = options.LockName + ":" + schema
+
+	progress := options.Progress
+	tenantOptions.Progress = func(event ProgressEvent) {
+		if progress != nil {
+			event.Schema = schema
+			progress(event)
+		}
+	}
+
+	return tenantOptions
+}
@@ -0,0 +1,285 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+type MigrationFormat string
+
+const (
+	MigrationJson = MigrationFormat("json")
+	MigrationYaml = MigrationFormat("yaml")
+)
+
+var migrationFileExtensions = []string{".json", ".yaml", ".yml"}
+
+func ParseMigrationFormat(format string) (MigrationFormat, error) {
+	switch MigrationFormat(format) {
+	case "", MigrationJson:
+		return MigrationJson, nil
+	case MigrationYaml, "yml":
+		return MigrationYaml, nil
+	}
+
+	return "", fmt.Errorf("unknown migration format '%v', use json or yaml", format)
+}
+
+func (f MigrationFormat) getExtension() string {
+	if f == MigrationYaml {
+		return ".yaml"
+	}
+
+	return ".json"
+}
+
+func getMigrationFileFormat(fileName string) MigrationFormat {
+	switch filepath.Ext(fileName) {
+	case ".yaml", ".yml":
+		return MigrationYaml
+	}
+
+	return MigrationJson
+}
+
+func isMigrationFile(fileName string) bool {
+	for _, extension := range migrationFileExtensions {
+		if strings.HasSuffix(fileName, extension) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// YamlAction keeps params as a yaml mapping instead of the escaped json of Action
+type YamlAction struct {
+	Method string                 `yaml:"method"`
+	Params map[string]interface{} `yaml:"params"`
+}
+
+type yamlMigration struct {
+	SchemaVersion string       `yaml:"schemaVersion"`
+	Id            string       `yaml:"id"`
+	Description   string       `yaml:"description"`
+	Actions       []YamlAction `yaml:"actions"`
+}
+
+// yamlOutputAction keeps the order of params, so yaml files follow the order of json files
+type yamlOutputAction struct {
+	Method string        `yaml:"method"`
+	Params yaml.MapSlice `yaml:"params"`
+}
+
+type yamlOutputMigration struct {
+	SchemaVersion string             `yaml:"schemaVersion"`
+	Id            string             `yaml:"id"`
+	Description   string             `yaml:"description"`
+	Actions       []yamlOutputAction `yaml:"actions"`
+}
+
+// getAction checks the method and names of params, params are stored in the json form of Action
+func (a YamlAction) getAction() (*Action, error) {
+
+	params, err := convertYamlValue(a.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	packedParams, err := json.MarshalIndent(params, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	method, decodedParams, err := decodeAction(a.Method, packedParams)
+	if err != nil {
+		return nil, fmt.Errorf("wrong params of '%v': %v", a.Method, err)
+	}
+
+	if method == "" {
+		return nil, fmt.Errorf("unknown method '%v'", a.Method)
+	}
+
+	// Params are decoded again to report misspelled names, they are silently skipped by decodeAction
+	strictParams := reflect.New(reflect.TypeOf(decodedParams)).Interface()
+	decoder := json.NewDecoder(bytes.NewReader(packedParams))
+	decoder.DisallowUnknownFields()
+
+	err = decoder.Decode(strictParams)
+	if err != nil {
+		return nil, fmt.Errorf("wrong params of '%v': %v", a.Method, err)
+	}
+
+	packedParams, _ = json.MarshalIndent(strictParams, "", "  ")
+	return &Action{Method: method, Params: (json.RawMessage)(packedParams)}, nil
+}
+
+func parseYamlMigration(rawMigration []byte) (*Migration, error) {
+
+	var source yamlMigration
+	err := yaml.UnmarshalStrict(rawMigration, &source)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse migration: %v/n", err)
+	}
+
+	migration := Migration{
+		SchemaVersion: source.SchemaVersion,
+		Id:            source.Id,
+		Description:   source.Description,
+		Actions:       []Action{},
+	}
+
+	for index, yamlAction := range source.Actions {
+		action, err := yamlAction.getAction()
+		if err != nil {
+			return nil, fmt.Errorf("can't parse migration %v action #%v: %v/n", source.Id, index, err)
+		}
+
+		migration.Actions = append(migration.Actions, *action)
+	}
+
+	return &migration, nil
+}
+
+func marshalMigration(migration Migration, format MigrationFormat) ([]byte, error) {
+
+	if format != MigrationYaml {
+		return json.MarshalIndent(migration, "", "  ")
+	}
+
+	output := yamlOutputMigration{
+		SchemaVersion: migration.SchemaVersion,
+		Id:            migration.Id,
+		Description:   migration.Description,
+		Actions:       []yamlOutputAction{},
+	}
+
+	for _, action := range migration.Actions {
+		// Json is a subset of yaml, top level params keep their order in MapSlice
+		var params yaml.MapSlice
+		err := yaml.Unmarshal(action.Params, &params)
+		if err != nil {
+			return nil, fmt.Errorf("can't convert params of '%v': %v", action.Method, err)
+		}
+
+		output.Actions = append(output.Actions, yamlOutputAction{Method: action.Method, Params: params})
+	}
+
+	return yaml.Marshal(output)
+}
+
+// convertYamlValue replaces yaml maps with string keys maps, so the value can be encoded to json
+func convertYamlValue(value interface{}) (interface{}, error) {
+
+	switch typedValue := value.(type) {
+	case map[interface{}]interface{}:
+		result := map[string]interface{}{}
+		for key, item := range typedValue {
+			stringKey, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("key '%v' should be a string", key)
+			}
+
+			convertedItem, err := convertYamlValue(item)
+			if err != nil {
+				return nil, err
+			}
+
+			result[stringKey] = convertedItem
+		}
+		return result, nil
+
+	case map[string]interface{}:
+		result := map[string]interface{}{}
+		for key, item := range typedValue {
+			convertedItem, err := convertYamlValue(item)
+			if err != nil {
+				return nil, err
+			}
+
+			result[key] = convertedItem
+		}
+		return result, nil
+
+	case []interface{}:
+		result := []interface{}{}
+		for _, item := range typedValue {
+			convertedItem, err := convertYamlValue(item)
+			if err != nil {
+				return nil, err
+			}
+
+			result = append(result, convertedItem)
+		}
+		return result, nil
+	}
+
+	return value, nil
+}
+
+// ConvertMigrations rewrites migration files in the format, ids and file names
+// without extensions are kept. All migrations are converted if ids are empty.
+func ConvertMigrations(format MigrationFormat, ids []string) ([]string, error) {
+
+	files, err := getMigrationFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	selectedIds := map[string]bool{}
+	for _, id := range ids {
+		selectedIds[id] = true
+	}
+
+	converted := []string{}
+
+	for _, migrationPath := range files {
+		if getMigrationFileFormat(migrationPath) == format {
+			continue
+		}
+
+		rawMigration, err := ioutil.ReadFile(migrationPath)
+		if err != nil {
+			return converted, fmt.Errorf("can't read migration %v", err)
+		}
+
+		migration, err := parseMigration(rawMigration)
+		if err != nil {
+			return converted, err
+		}
+
+		if len(selectedIds) > 0 && !selectedIds[migration.Id] {
+			continue
+		}
+
+		packedMigration, err := marshalMigration(*migration, format)
+		if err != nil {
+			return converted, err
+		}
+
+		convertedPath := strings.TrimSuffix(migrationPath, filepath.Ext(migrationPath)) + format.getExtension()
+
+		err = writeFileAtomically(convertedPath, packedMigration)
+		if err != nil {
+			return converted, fmt.Errorf("can't write migration %v", err)
+		}
+
+		err = os.Remove(migrationPath)
+		if err != nil {
+			return converted, fmt.Errorf("can't remove migration %v", err)
+		}
+
+		_, fileName := filepath.Split(convertedPath)
+		converted = append(converted, fileName)
+	}
+
+	return converted, nil
+}
@@ -0,0 +1,97 @@
+package db
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestYamlMigrationRoundTrip(t *testing.T) {
+
+	migration := Migration{
+		SchemaVersion: "1",
+		Id:            "0001",
+		Description:   "add users",
+		Actions: []Action{
+			newAction("addTable", AddTableParams{Name: "users"}),
+			newAction("addColumn", AddColumnParams{
+				Table:   "users",
+				Column:  "status",
+				Type:    "varchar(20)",
+				Default: &Default{Kind: DefaultLiteral, Value: "it's: new"},
+			}),
+			newAction("setPrimaryKey", SetPrimaryKeyParams{Table: "users", Columns: []string{"status"}}),
+			newAction("setTableComment", SetTableCommentParams{Table: "users", Comment: "line one\nline two"}),
+		},
+	}
+
+	packedMigration, err := marshalMigration(migration, MigrationYaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsedMigration, err := parseYamlMigration(packedMigration)
+	if err != nil {
+		t.Fatalf("can't parse marshaled migration: %v\n%s", err, packedMigration)
+	}
+
+	if parsedMigration.SchemaVersion != migration.SchemaVersion || parsedMigration.Id != migration.Id || parsedMigration.Description != migration.Description {
+		t.Fatalf("migration header is changed: %+v", parsedMigration)
+	}
+
+	if len(parsedMigration.Actions) != len(migration.Actions) {
+		t.Fatalf("expected %v actions, got %v", len(migration.Actions), len(parsedMigration.Actions))
+	}
+
+	for index, action := range migration.Actions {
+		parsedAction := parsedMigration.Actions[index]
+
+		var params, parsedParams interface{}
+		json.Unmarshal(action.Params, &params)
+		json.Unmarshal(parsedAction.Params, &parsedParams)
+
+		if parsedAction.Method != action.Method || !reflect.DeepEqual(params, parsedParams) {
+			t.Errorf("action #%v is changed: %v %s, expected %v %s", index, parsedAction.Method, parsedAction.Params, action.Method, action.Params)
+		}
+	}
+}
+
+func TestParseYamlMigrationErrors(t *testing.T) {
+
+	tests := []struct {
+		name string
+		yaml string
+		err  string
+	}{
+		{
+			name: "unknown method",
+			yaml: "id: \"0001\"\nactions:\n- method: addTables\n  params:\n    name: users\n",
+			err:  "unknown method 'addTables'",
+		},
+		{
+			name: "misspelled param",
+			yaml: "id: \"0001\"\nactions:\n- method: addTable\n  params:\n    nmae: users\n",
+			err:  "wrong params of 'addTable'",
+		},
+		{
+			name: "wrong param type",
+			yaml: "id: \"0001\"\nactions:\n- method: addColumn\n  params:\n    table: users\n    column: id\n    type: integer\n    isNullable: maybe\n",
+			err:  "wrong params of 'addColumn'",
+		},
+		{
+			name: "unknown field",
+			yaml: "id: \"0001\"\nversion: 2\nactions: []\n",
+			err:  "can't parse migration",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := parseYamlMigration([]byte(test.yaml))
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected error %q, got %v", test.err, err)
+			}
+		})
+	}
+}
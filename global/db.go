@@ -0,0 +1,316 @@
+package global
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/akaumov/cubes/db"
+	"github.com/akaumov/cubes/utils"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	docker_client "github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+	"golang.org/x/net/context"
+)
+
+const dbImage = "postgres"
+const dbProfileName = "dev"
+const dbUser = "cubes"
+const dbPassword = "cubes"
+const dbPort = 5432
+const dbStartTimeout = 60 * time.Second
+
+func getDbContainerName(config *ProjectConfig) string {
+	return config.Name + "_db"
+}
+
+func getDbVolumeName(config *ProjectConfig) string {
+	return config.Name + "_db_data"
+}
+
+func getDbProfile(config *ProjectConfig) db.Profile {
+	return db.Profile{
+		Host:     "localhost",
+		Port:     dbPort,
+		User:     dbUser,
+		Password: dbPassword,
+		Database: config.Name,
+		SslMode:  "disable",
+	}
+}
+
+func StartDb() error {
+	log.Println("Running db")
+
+	err := utils.PullImage(dbImage)
+	if err != nil {
+		return fmt.Errorf("can't run db: %v", err)
+	}
+
+	config, err := GetConfig()
+	if err != nil {
+		return fmt.Errorf("can't read project config: %v", err)
+	}
+
+	err = ensurePrivateNetwork(config)
+	if err != nil {
+		return fmt.Errorf("can't create private network: %v", err)
+	}
+
+	err = runDb(config)
+	if err != nil {
+		return fmt.Errorf("can't run db: %v", err)
+	}
+
+	profile := getDbProfile(config)
+
+	err = registerDbProfile(config, profile)
+	if err != nil {
+		return fmt.Errorf("can't register db profile: %v", err)
+	}
+
+	log.Println("Waiting for db")
+	return db.WaitForConnection(profile, dbStartTimeout)
+}
+
+func StopDb() error {
+	config, err := GetConfig()
+	if err != nil {
+		return fmt.Errorf("can't read project config: %v", err)
+	}
+
+	ctx := context.Background()
+	client, err := docker_client.NewEnvClient()
+	if err != nil {
+		return fmt.Errorf("can't connect to docker service: %v", err)
+	}
+
+	defer client.Close()
+
+	return removeDbContainer(ctx, client, config)
+}
+
+// ResetDb drops the db volume and applies all migrations to a new database.
+// Named databases kept in the project db are created again and synced too,
+// databases of other servers aren't changed.
+func ResetDb() error {
+	config, err := GetConfig()
+	if err != nil {
+		return fmt.Errorf("can't read project config: %v", err)
+	}
+
+	ctx := context.Background()
+	client, err := docker_client.NewEnvClient()
+	if err != nil {
+		return fmt.Errorf("can't connect to docker service: %v", err)
+	}
+
+	defer client.Close()
+
+	err = removeDbContainer(ctx, client, config)
+	if err != nil {
+		return err
+	}
+
+	err = client.VolumeRemove(ctx, getDbVolumeName(config), true)
+	if err != nil && !docker_client.IsErrNotFound(err) {
+		return fmt.Errorf("can't remove db volume: %v", err)
+	}
+
+	err = StartDb()
+	if err != nil {
+		return err
+	}
+
+	names, err := GetDatabaseNames()
+	if err != nil {
+		return err
+	}
+
+	selectedDatabase := db.GetSelectedDatabase()
+	defer db.SelectDatabase(selectedDatabase)
+
+	for _, name := range names {
+		err = db.SelectDatabase(name)
+		if err != nil {
+			return err
+		}
+
+		profile := getDbProfile(config)
+		if name != "" {
+			namedProfile, err := GetDbProfile("")
+			if err != nil {
+				log.Printf("database %v is skipped: %v", name, err)
+				continue
+			}
+
+			if !isProjectDbProfile(*namedProfile) {
+				log.Printf("database %v is skipped, it isn't kept in the project db", name)
+				continue
+			}
+
+			if namedProfile.Database == config.Name {
+				return fmt.Errorf("database %v uses the db of the default database, their migrations would be mixed in one migrations table", name)
+			}
+
+			err = createProjectDatabase(config, namedProfile.Database)
+			if err != nil {
+				return fmt.Errorf("can't create database %v: %v", name, err)
+			}
+
+			profile = *namedProfile
+		}
+
+		lockName, err := GetSyncLockName()
+		if err != nil {
+			return err
+		}
+
+		err = db.Sync(profile, db.SyncOptions{
+			Transaction: db.TransactionPerMigration,
+			LockName:    lockName,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isProjectDbProfile checks that the profile connects to the db started by StartDb
+func isProjectDbProfile(profile db.Profile) bool {
+	return (profile.Host == "localhost" || profile.Host == "127.0.0.1") &&
+		profile.Port == dbPort &&
+		profile.User == dbUser
+}
+
+// createProjectDatabase creates a database in the project db unless it exists
+func createProjectDatabase(config *ProjectConfig, databaseName string) error {
+	connection, err := db.Connect(getDbProfile(config))
+	if err != nil {
+		return err
+	}
+
+	defer connection.Close()
+
+	var isExist bool
+	err = connection.QueryRow("SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)", databaseName).Scan(&isExist)
+	if err != nil || isExist {
+		return err
+	}
+
+	_, err = connection.Exec(fmt.Sprintf(`CREATE DATABASE "%v"`, strings.Replace(databaseName, `"`, `""`, -1)))
+	return err
+}
+
+func registerDbProfile(config *ProjectConfig, profile db.Profile) error {
+	if config.DbProfiles == nil {
+		config.DbProfiles = map[string]db.Profile{}
+	}
+
+	config.DbProfiles[dbProfileName] = profile
+
+	if config.DefaultDbProfile == "" {
+		config.DefaultDbProfile = dbProfileName
+	}
+
+	return saveConfig(*config)
+}
+
+func ensurePrivateNetwork(config *ProjectConfig) error {
+	ctx := context.Background()
+	client, err := docker_client.NewEnvClient()
+	if err != nil {
+		return fmt.Errorf("can't connect to docker service: %v", err)
+	}
+
+	defer client.Close()
+
+	networkName := config.Name + "_network"
+
+	_, err = client.NetworkInspect(ctx, networkName)
+	if err == nil {
+		return nil
+	}
+
+	if !docker_client.IsErrNetworkNotFound(err) {
+		return err
+	}
+
+	_, err = client.NetworkCreate(ctx, networkName, types.NetworkCreate{
+		Driver: "bridge",
+	})
+
+	return err
+}
+
+func removeDbContainer(ctx context.Context, client *docker_client.Client, config *ProjectConfig) error {
+	timeout := 30 * time.Second
+
+	err := client.ContainerStop(ctx, getDbContainerName(config), &timeout)
+	if err != nil && !docker_client.IsErrContainerNotFound(err) {
+		return fmt.Errorf("can't stop db container: %v", err)
+	}
+
+	err = client.ContainerRemove(ctx, getDbContainerName(config), types.ContainerRemoveOptions{})
+	if err != nil && !docker_client.IsErrContainerNotFound(err) {
+		return fmt.Errorf("can't remove db container: %v", err)
+	}
+
+	return nil
+}
+
+func runDb(config *ProjectConfig) error {
+	ctx := context.Background()
+	client, err := docker_client.NewEnvClient()
+	if err != nil {
+		return fmt.Errorf("can't connect to docker service: %v", err)
+	}
+
+	defer client.Close()
+
+	err = removeDbContainer(ctx, client, config)
+	if err != nil {
+		return err
+	}
+
+	port := nat.Port(fmt.Sprintf("%v/tcp", dbPort))
+
+	resp, err := client.ContainerCreate(ctx, &container.Config{
+		Image: dbImage,
+		Tty:   true,
+		Env: []string{
+			"POSTGRES_USER=" + dbUser,
+			"POSTGRES_PASSWORD=" + dbPassword,
+			"POSTGRES_DB=" + config.Name,
+		},
+		ExposedPorts: nat.PortSet{
+			port: struct{}{},
+		},
+	}, &container.HostConfig{
+		NetworkMode: container.NetworkMode(config.Name + "_network"),
+		Binds:       []string{getDbVolumeName(config) + ":/var/lib/postgresql/data"},
+		PortBindings: nat.PortMap{
+			port: []nat.PortBinding{
+				{
+					HostIP:   "",
+					HostPort: fmt.Sprintf("%v", dbPort),
+				},
+			},
+		},
+	}, nil, getDbContainerName(config))
+
+	if err != nil {
+		return fmt.Errorf("can't create db container: %v", err)
+	}
+
+	err = client.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{})
+	if err != nil {
+		return fmt.Errorf("can't start db container: %v", err)
+	}
+
+	return nil
+}
@@ -1,6 +1,7 @@
 package global
 
 import (
+	"github.com/akaumov/cubes/db"
 	"github.com/akaumov/cubes/utils"
 	"github.com/akaumov/cubes/instance"
 	"github.com/akaumov/cube_executor"
@@ -13,6 +14,7 @@ import (
 	"log"
 	"path/filepath"
 	"strings"
+	"sort"
 	"os"
 	"encoding/json"
 	"io/ioutil"
@@ -21,8 +23,19 @@ import (
 const busImage = "nats"
 
 type ProjectConfig struct {
-	Name        string `json:"name"`
-	Description string `json:"description"`
+	Name             string                     `json:"name"`
+	Description      string                     `json:"description"`
+	DefaultDbProfile string                     `json:"defaultDbProfile,omitempty"`
+	DbProfiles       map[string]db.Profile      `json:"dbProfiles,omitempty"`
+	Databases        map[string]ProjectDatabase `json:"databases,omitempty"`
+	TablePresets     map[string]db.TablePreset  `json:"tablePresets,omitempty"`
+	MigrationFormat  string                     `json:"migrationFormat,omitempty"`
+}
+
+// ProjectDatabase keeps profiles of a named database, its migrations are in migrations/<name>
+type ProjectDatabase struct {
+	DefaultDbProfile string                `json:"defaultDbProfile,omitempty"`
+	DbProfiles       map[string]db.Profile `json:"dbProfiles,omitempty"`
 }
 
 type InstanceInfo struct {
@@ -131,6 +144,181 @@ func GetConfig() (*ProjectConfig, error) {
 	return &config, nil
 }
 
+// saveConfig writes db profiles of the config, other keys of project.json are kept as they are
+func saveConfig(config ProjectConfig) error {
+	configPath, err := getProjectConfigPath()
+	if err != nil {
+		return err
+	}
+
+	rawConfig, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return err
+	}
+
+	fields := map[string]json.RawMessage{}
+	err = json.Unmarshal(rawConfig, &fields)
+	if err != nil {
+		return fmt.Errorf("can't parse project config: %v/n", err)
+	}
+
+	delete(fields, "dbProfiles")
+	if len(config.DbProfiles) > 0 {
+		packedProfiles, _ := json.Marshal(config.DbProfiles)
+		fields["dbProfiles"] = packedProfiles
+	}
+
+	delete(fields, "defaultDbProfile")
+	if config.DefaultDbProfile != "" {
+		packedDefaultProfile, _ := json.Marshal(config.DefaultDbProfile)
+		fields["defaultDbProfile"] = packedDefaultProfile
+	}
+
+	packedConfig, _ := json.MarshalIndent(fields, "", "  ")
+	return ioutil.WriteFile(configPath, packedConfig, 0777)
+}
+
+// getDatabaseProfiles returns the default profile name and profiles of the database selected in db package
+func (c *ProjectConfig) getDatabaseProfiles() (string, map[string]db.Profile, error) {
+	databaseName := db.GetSelectedDatabase()
+	if databaseName == "" {
+		return c.DefaultDbProfile, c.DbProfiles, nil
+	}
+
+	database, ok := c.Databases[databaseName]
+	if !ok {
+		return "", nil, fmt.Errorf("database '%v' is not defined in project.json", databaseName)
+	}
+
+	return database.DefaultDbProfile, database.DbProfiles, nil
+}
+
+// GetDbProfile returns the profile of the database selected in db package
+func GetDbProfile(name string) (*db.Profile, error) {
+	config, err := GetConfig()
+	if err != nil {
+		return nil, fmt.Errorf("can't read project config: %v", err)
+	}
+
+	defaultName, profiles, err := config.getDatabaseProfiles()
+	if err != nil {
+		return nil, err
+	}
+
+	if name == "" {
+		name = defaultName
+	}
+
+	if name == "" {
+		return nil, fmt.Errorf("db profile is not defined, run 'cubes db start' or add a profile to project.json")
+	}
+
+	profile, ok := profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("db profile '%v' doesn't exist", name)
+	}
+
+	return &profile, nil
+}
+
+// GetDatabaseNames returns the default database, its name is empty, and named databases of the project
+func GetDatabaseNames() ([]string, error) {
+	config, err := GetConfig()
+	if err != nil {
+		return nil, fmt.Errorf("can't read project config: %v", err)
+	}
+
+	names := []string{}
+	for name := range config.Databases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return append([]string{""}, names...), nil
+}
+
+// GetSyncLockName returns the name of the sync lock of the database selected in db package
+func GetSyncLockName() (string, error) {
+	config, err := GetConfig()
+	if err != nil {
+		return "", fmt.Errorf("can't read project config: %v", err)
+	}
+
+	if db.GetSelectedDatabase() == "" {
+		return config.Name, nil
+	}
+
+	return config.Name + "/" + db.GetSelectedDatabase(), nil
+}
+
+// CheckMigrationIsNotApplied checks databases of all profiles of the selected database and their tenant schemas,
+// an unreachable database is an error unless force is set, then it's reported and skipped.
+// A database without the migrations table has no applied migrations
+func CheckMigrationIsNotApplied(migrationId string, force bool) error {
+	config, err := GetConfig()
+	if err != nil {
+		return fmt.Errorf("can't read project config: %v", err)
+	}
+
+	_, profiles, err := config.getDatabaseProfiles()
+	if err != nil {
+		return err
+	}
+
+	names := []string{}
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		isApplied, err := db.IsMigrationApplied(profiles[name], migrationId)
+		if err != nil {
+			if !force {
+				return fmt.Errorf("can't check db profile '%v': %v, use --force to skip it", name, err)
+			}
+
+			log.Printf("can't check db profile '%v': %v", name, err)
+			continue
+		}
+
+		if isApplied {
+			return fmt.Errorf("migration %v is applied to db profile '%v'", migrationId, name)
+		}
+	}
+
+	return nil
+}
+
+// GetMigrationFormat returns the format of new migration files, json is the default
+func GetMigrationFormat() (db.MigrationFormat, error) {
+	config, err := GetConfig()
+	if err != nil {
+		return "", fmt.Errorf("can't read project config: %v", err)
+	}
+
+	return db.ParseMigrationFormat(config.MigrationFormat)
+}
+
+// GetTablePreset returns the preset of project.json, it overrides a built-in preset with the same name
+func GetTablePreset(name string) (*db.TablePreset, error) {
+	config, err := GetConfig()
+	if err != nil {
+		return nil, fmt.Errorf("can't read project config: %v", err)
+	}
+
+	preset, ok := config.TablePresets[name]
+	if !ok {
+		preset, ok = db.BuiltinTablePresets[name]
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("table preset '%v' doesn't exist", name)
+	}
+
+	return &preset, nil
+}
+
 func InitProject(name string, description string) error {
 	configPath, err := getProjectConfigPath()
 	if err != nil {
@@ -153,7 +341,30 @@ func InitProject(name string, description string) error {
 		return err
 	}
 
-	return nil
+	return addToGitignore(filepath.Dir(configPath), db.CacheDirectoryName+"/")
+}
+
+// addToGitignore adds the pattern to .gitignore of the project unless it's there
+func addToGitignore(projectDirectory string, pattern string) error {
+	gitignorePath := filepath.Join(projectDirectory, ".gitignore")
+
+	content, err := ioutil.ReadFile(gitignorePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		if strings.TrimSpace(line) == pattern {
+			return nil
+		}
+	}
+
+	if len(content) > 0 && !strings.HasSuffix(string(content), "\n") {
+		content = append(content, '\n')
+	}
+
+	content = append(content, []byte(pattern+"\n")...)
+	return ioutil.WriteFile(gitignorePath, content, 0666)
 }
 
 func StartProject() error {